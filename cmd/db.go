@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+var (
+	// dryRun prints the statements of the migrations instead of running them
+	dryRun bool
+
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Manages the Udash database",
+	}
+
+	dbMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Manages the database schema migrations",
+		Long: `Manages the database schema migrations embedded in udash.
+
+A migration which fails halfway leaves the schema dirty: no other migration runs until
+the schema was fixed by hand and its version recorded with "udash db migrate force".`,
+	}
+
+	dbMigrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Shows the schema version and the pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDatabase(func(ctx context.Context) error {
+				status, err := database.GetMigrationStatus(ctx)
+				if err != nil {
+					return err
+				}
+
+				expected, err := database.ExpectedSchemaVersion()
+				if err != nil {
+					return err
+				}
+
+				dirty := ""
+				if status.Dirty {
+					dirty = " (dirty)"
+				}
+
+				cmd.Printf("Schema version:\t%d%s\n", status.Version, dirty)
+				cmd.Printf("Latest version:\t%d\n", expected)
+
+				if status.Version > expected {
+					cmd.Println("The schema was migrated by a newer udash, which must be used instead")
+					return nil
+				}
+
+				if len(status.Pending) == 0 {
+					cmd.Println("No pending migration")
+					return nil
+				}
+
+				cmd.Println("Pending migrations:")
+				for _, m := range status.Pending {
+					cmd.Printf("  %d\t%s\n", m.Version, m.Name)
+				}
+
+				return nil
+			})
+		},
+	}
+
+	dbMigrateUpCmd = &cobra.Command{
+		Use:   "up [VERSION]",
+		Short: "Applies the pending migrations, up to VERSION when set",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDatabase(func(ctx context.Context) error {
+				target, err := database.ExpectedSchemaVersion()
+				if err != nil {
+					return err
+				}
+
+				if len(args) == 1 {
+					if target, err = parseVersion(args[0]); err != nil {
+						return err
+					}
+				}
+
+				return migrateTo(ctx, cmd, target, true)
+			})
+		},
+	}
+
+	dbMigrateDownCmd = &cobra.Command{
+		Use:   "down VERSION",
+		Short: "Reverts the migrations applied after VERSION, every one with 0",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := parseVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			return withDatabase(func(ctx context.Context) error {
+				return migrateTo(ctx, cmd, target, false)
+			})
+		},
+	}
+
+	dbMigrateForceCmd = &cobra.Command{
+		Use:   "force VERSION",
+		Short: "Records VERSION as the schema version and clears the dirty flag, without running any migration",
+		Long: `Records VERSION as the schema version and clears the dirty flag, without running any migration.
+
+VERSION -1 records that no migration was applied, which clears a migration dirty before
+the first one. It is read as a flag unless it follows "--":
+
+  udash db migrate force -- -1`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid version %q: %w", args[0], err)
+			}
+
+			return withDatabase(func(ctx context.Context) error {
+				if err := database.ForceMigrationVersion(ctx, version); err != nil {
+					return err
+				}
+
+				cmd.Printf("Schema version forced to %d\n", version)
+
+				return nil
+			})
+		},
+	}
+)
+
+var (
+	// repair recomputes the drifted columns found by the check
+	repair bool
+	// checkBatchSize is the number of reports checked at once
+	checkBatchSize int
+
+	dbCheckCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Verifies the report columns denormalized from the report payloads",
+		Long: `Verifies the report columns denormalized from the report payloads, such as the
+pipeline result or the ids of its scms, against the ones computed when a report is published.
+
+With --repair, the drifted columns are recomputed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDatabase(func(ctx context.Context) error {
+				result, err := database.CheckReports(ctx, database.CheckReportsOptions{
+					Repair:    repair,
+					BatchSize: checkBatchSize,
+				})
+				if err != nil {
+					return err
+				}
+
+				for _, drift := range result.Reports {
+					incomplete := ""
+					if drift.Incomplete {
+						incomplete = " (refers to missing rows)"
+					}
+					cmd.Printf("%s\t%s%s\n", drift.ID, strings.Join(drift.Columns, ", "), incomplete)
+				}
+
+				if len(result.Reports) < result.Drifted {
+					cmd.Printf("... and %d more\n", result.Drifted-len(result.Reports))
+				}
+
+				cmd.Printf("Checked %d reports, %d drifted, %d repaired\n", result.Checked, result.Drifted, result.Repaired)
+
+				return nil
+			})
+		},
+	}
+)
+
+func init() {
+	dbCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "set config file")
+
+	for _, c := range []*cobra.Command{dbMigrateUpCmd, dbMigrateDownCmd} {
+		c.Flags().BoolVar(&dryRun, "dry-run", false, "print the statements of the migrations instead of running them")
+	}
+
+	dbMigrateCmd.AddCommand(
+		dbMigrateStatusCmd,
+		dbMigrateUpCmd,
+		dbMigrateDownCmd,
+		dbMigrateForceCmd,
+	)
+
+	dbCheckCmd.Flags().BoolVar(&repair, "repair", false, "recompute the drifted columns")
+	dbCheckCmd.Flags().IntVar(&checkBatchSize, "batch-size", 500, "number of reports checked, and repaired, at once")
+
+	dbCmd.AddCommand(
+		dbMigrateCmd,
+		dbCheckCmd,
+	)
+}
+
+// withDatabase connects to the database of the configuration, then runs f.
+func withDatabase(f func(ctx context.Context) error) error {
+	// The database may also be configured by environment variables alone.
+	var notFound viper.ConfigFileNotFoundError
+	if err := viper.ReadInConfig(); err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("reading the configuration: %w", err)
+	}
+
+	o, err := loadOptions()
+	if err != nil {
+		return fmt.Errorf("decoding the configuration: %w", err)
+	}
+
+	ctx := context.Background()
+
+	if err := database.Connect(ctx, o.Database); err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	defer database.Close()
+
+	return f(ctx)
+}
+
+// migrateTo migrates the schema to the target version, which must be above the current one
+// when up is set and below it otherwise, or prints the statements doing so on a dry run.
+func migrateTo(ctx context.Context, cmd *cobra.Command, target uint, up bool) error {
+	status, err := database.GetMigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case up && target < status.Version:
+		return fmt.Errorf("the schema is at version %d, above %d: use \"down\" to revert migrations", status.Version, target)
+	case !up && target > status.Version:
+		return fmt.Errorf("the schema is at version %d, below %d: use \"up\" to apply migrations", status.Version, target)
+	}
+
+	steps, err := database.PlanMigration(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if len(steps) == 0 {
+		cmd.Printf("The schema is already at version %d\n", status.Version)
+		return nil
+	}
+
+	if dryRun {
+		for _, step := range steps {
+			direction := "down"
+			if step.Up {
+				direction = "up"
+			}
+
+			cmd.Printf("-- %d_%s.%s.sql\n%s\n", step.Version, step.Name, direction, step.SQL)
+		}
+
+		return nil
+	}
+
+	if err := database.MigrateTo(ctx, target); err != nil {
+		return err
+	}
+
+	cmd.Printf("Schema migrated to version %d\n", target)
+
+	return nil
+}
+
+// parseVersion parses a migration version given on the command line.
+func parseVersion(s string) (uint, error) {
+	version, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q: %w", s, err)
+	}
+
+	return uint(version), nil
+}
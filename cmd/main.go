@@ -36,6 +36,7 @@ func init() {
 	rootCmd.AddCommand(
 		versionCmd,
 		serverCmd,
+		dbCmd,
 	)
 }
 
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -24,11 +26,6 @@ var (
 			// Find and read the config file
 			cobra.CheckErr(viper.ReadInConfig())
 
-			viper.OnConfigChange(func(e fsnotify.Event) {
-				logrus.Infof("Config file changed: %q", e.Name)
-			})
-			viper.WatchConfig()
-
 			cobra.CheckErr(run())
 		},
 	}
@@ -41,10 +38,42 @@ func init() {
 	)
 }
 
-func run() error {
+// loadOptions decodes the configuration read by viper.
+func loadOptions() (engine.Options, error) {
 	var o engine.Options
 
 	if err := viper.Unmarshal(&o); err != nil {
+		return o, err
+	}
+
+	// The --debug flag wins over the configured level.
+	if verbose {
+		o.Logging.Level = "debug"
+	}
+
+	return o, nil
+}
+
+// reload applies the configuration file again after it changed.
+func reload(e *engine.Engine) error {
+	// viper already read the file before calling back, but it keeps the previous
+	// configuration without telling when the new one cannot be parsed. It is read again
+	// to find out.
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading the configuration: %w", err)
+	}
+
+	o, err := loadOptions()
+	if err != nil {
+		return fmt.Errorf("decoding the configuration: %w", err)
+	}
+
+	return e.Reload(o)
+}
+
+func run() error {
+	o, err := loadOptions()
+	if err != nil {
 		return err
 	}
 
@@ -52,5 +81,14 @@ func run() error {
 		Options: o,
 	}
 
+	viper.OnConfigChange(func(ev fsnotify.Event) {
+		logrus.Infof("Config file changed: %q", ev.Name)
+
+		if err := reload(&e); err != nil {
+			logrus.Errorf("Keeping the current configuration: %s", err)
+		}
+	})
+	viper.WatchConfig()
+
 	return e.Start()
 }
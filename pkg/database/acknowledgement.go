@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidAcknowledgement is returned when creating an acknowledgement from invalid
+// parameters.
+var ErrInvalidAcknowledgement = errors.New("invalid acknowledgement")
+
+// activeAcknowledgementSQLExpr is true of the acknowledgements which did not expire yet.
+const activeAcknowledgementSQLExpr = "(expires_at IS NULL OR expires_at > now())"
+
+// acknowledgedSQLExpr is true of the reports of a pipeline acknowledged right now. The
+// selector of an acknowledgement is matched against the labels of the report payload,
+// which are the ones the report was published with.
+const acknowledgedSQLExpr = `EXISTS (
+	SELECT 1 FROM acknowledgements
+	WHERE (acknowledgements.expires_at IS NULL OR acknowledgements.expires_at > now())
+		AND (
+			(acknowledgements.pipeline_id <> '' AND acknowledgements.pipeline_id = pipelineReports.pipeline_id)
+			OR (acknowledgements.pipeline_id = '' AND pipelineReports.data -> 'Labels' @> acknowledgements.labels)
+		)
+)`
+
+// Acknowledgement mutes a pipeline whose failure is known and accepted.
+type Acknowledgement struct {
+	ID uuid.UUID `json:"id"`
+	// PipelineID selects a single pipeline, Labels the pipelines carrying every one of
+	// them. Only one of the two is set.
+	PipelineID string            `json:"pipeline_id,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// Reason tells why the failure is accepted, and Author who accepted it.
+	Reason string `json:"reason"`
+	Author string `json:"author"`
+	// ExpiresAt is when the acknowledgement stops applying, never when nil.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NewAcknowledgement describes an acknowledgement to record.
+type NewAcknowledgement struct {
+	// PipelineID and Labels select the pipelines, exactly one of them is required.
+	PipelineID string
+	Labels     map[string]string
+	Reason     string
+	Author     string
+	// ExpiresAt may be nil, the acknowledgement then applies until deleted.
+	ExpiresAt *time.Time
+}
+
+// Matches reports whether the acknowledgement selects a pipeline, by its id or by the
+// labels of its report.
+func (a Acknowledgement) Matches(pipelineID string, labels map[string]string) bool {
+	if a.PipelineID != "" {
+		return a.PipelineID == pipelineID
+	}
+
+	if len(a.Labels) == 0 {
+		return false
+	}
+
+	for key, value := range a.Labels {
+		if v, found := labels[key]; !found || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// acknowledgementColumns are the columns scanned by scanAcknowledgement, in its order.
+const acknowledgementColumns = "id, pipeline_id, labels, reason, author, expires_at, created_at"
+
+func scanAcknowledgement(row pgx.Row) (Acknowledgement, error) {
+	a := Acknowledgement{}
+
+	err := row.Scan(
+		&a.ID,
+		&a.PipelineID,
+		&a.Labels,
+		&a.Reason,
+		&a.Author,
+		&a.ExpiresAt,
+		&a.CreatedAt,
+	)
+
+	return a, err
+}
+
+// CreateAcknowledgement records an acknowledgement, which applies right away.
+func CreateAcknowledgement(ctx context.Context, n NewAcknowledgement) (Acknowledgement, error) {
+	switch {
+	case n.PipelineID == "" && len(n.Labels) == 0:
+		return Acknowledgement{}, fmt.Errorf("%w: a pipeline id or labels are required", ErrInvalidAcknowledgement)
+	case n.PipelineID != "" && len(n.Labels) > 0:
+		return Acknowledgement{}, fmt.Errorf("%w: a pipeline id and labels cannot be combined", ErrInvalidAcknowledgement)
+	case n.Reason == "":
+		return Acknowledgement{}, fmt.Errorf("%w: a reason is required", ErrInvalidAcknowledgement)
+	case n.Author == "":
+		return Acknowledgement{}, fmt.Errorf("%w: an author is required", ErrInvalidAcknowledgement)
+	case n.ExpiresAt != nil && !n.ExpiresAt.After(time.Now()):
+		return Acknowledgement{}, fmt.Errorf("%w: the expiry is in the past", ErrInvalidAcknowledgement)
+	}
+
+	for key := range n.Labels {
+		if key == "" {
+			return Acknowledgement{}, fmt.Errorf("%w: label key cannot be empty", ErrInvalidAcknowledgement)
+		}
+	}
+
+	labels := n.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	// The expiry is passed as a timestamptz so that it is stored in the time zone of the
+	// session, as now() is.
+	a, err := scanAcknowledgement(DB.QueryRow(ctx, `
+		INSERT INTO acknowledgements (pipeline_id, labels, reason, author, expires_at)
+		VALUES ($1, $2, $3, $4, $5::timestamptz)
+		RETURNING `+acknowledgementColumns,
+		n.PipelineID, labels, n.Reason, n.Author, n.ExpiresAt,
+	))
+	if err != nil {
+		return a, fmt.Errorf("recording acknowledgement: %w", err)
+	}
+
+	return a, nil
+}
+
+// ListAcknowledgements returns the acknowledgements which did not expire, latest first,
+// the expired ones too when expired is true.
+func ListAcknowledgements(ctx context.Context, expired bool) ([]Acknowledgement, error) {
+	query := "SELECT " + acknowledgementColumns + " FROM acknowledgements"
+	if !expired {
+		query += " WHERE " + activeAcknowledgementSQLExpr
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := DB.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("listing acknowledgements: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Acknowledgement, error) {
+		return scanAcknowledgement(row)
+	})
+}
+
+// FindAcknowledgement returns the oldest acknowledgement applying to a pipeline, by its id
+// or by the labels of its report, nil when none does.
+func FindAcknowledgement(ctx context.Context, pipelineID string, labels map[string]string) (*Acknowledgement, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	a, err := scanAcknowledgement(DB.QueryRow(ctx, `
+		SELECT `+acknowledgementColumns+`
+		FROM acknowledgements
+		WHERE `+activeAcknowledgementSQLExpr+`
+			AND ((pipeline_id <> '' AND pipeline_id = $1) OR (pipeline_id = '' AND labels <@ $2::jsonb))
+		ORDER BY created_at
+		LIMIT 1`,
+		pipelineID, labels,
+	))
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading the acknowledgement of pipeline %q: %w", pipelineID, err)
+	}
+
+	return &a, nil
+}
+
+// DeleteAcknowledgement deletes an acknowledgement, pgx.ErrNoRows if there is none.
+func DeleteAcknowledgement(ctx context.Context, id string) error {
+	tag, err := DB.Exec(ctx, "DELETE FROM acknowledgements WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("deleting acknowledgement %s: %w", id, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// acknowledgementOf returns the oldest of the provided acknowledgements applying to a
+// pipeline, nil when none does. The acknowledgements are the ones listed by
+// ListAcknowledgements, latest first.
+func acknowledgementOf(acknowledgements []Acknowledgement, pipelineID string, labels map[string]string) *Acknowledgement {
+	for i := len(acknowledgements) - 1; i >= 0; i-- {
+		if acknowledgements[i].Matches(pipelineID, labels) {
+			return &acknowledgements[i]
+		}
+	}
+
+	return nil
+}
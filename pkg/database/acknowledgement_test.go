@@ -0,0 +1,29 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcknowledgementMatches(t *testing.T) {
+	byID := Acknowledgement{PipelineID: "venom"}
+	byLabels := Acknowledgement{Labels: map[string]string{"team": "qa", "env": "prod"}}
+
+	assert.True(t, byID.Matches("venom", nil))
+	assert.False(t, byID.Matches("other", map[string]string{"team": "qa", "env": "prod"}))
+	assert.False(t, byID.Matches("", nil))
+
+	assert.True(t, byLabels.Matches("", map[string]string{"team": "qa", "env": "prod", "os": "linux"}))
+	assert.False(t, byLabels.Matches("venom", map[string]string{"team": "qa"}))
+	assert.False(t, byLabels.Matches("venom", map[string]string{"team": "qa", "env": "dev"}))
+
+	// An acknowledgement without any selector selects nothing.
+	assert.False(t, Acknowledgement{}.Matches("", nil))
+
+	// The oldest one applying wins, they are listed latest first.
+	older := Acknowledgement{PipelineID: "venom", Reason: "older"}
+	newer := Acknowledgement{PipelineID: "venom", Reason: "newer"}
+	assert.Equal(t, "older", acknowledgementOf([]Acknowledgement{newer, byLabels, older}, "venom", nil).Reason)
+	assert.Nil(t, acknowledgementOf([]Acknowledgement{newer, older}, "other", nil))
+}
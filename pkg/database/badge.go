@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+)
+
+// CountLatestResultsParams selects the pipelines counted by CountLatestResults.
+type CountLatestResultsParams struct {
+	// PipelineID restricts the count to a single pipeline.
+	PipelineID string
+	// Labels restricts the count to the pipelines whose reports carry every one of them,
+	// with the same value.
+	Labels map[string]string
+	// Days restricts the count to the pipelines which reported over that many days, zero
+	// does not filter anything out.
+	Days int
+}
+
+// CountLatestResults returns the number of pipelines per result of their latest report,
+// such as {"✔": 3, "✗": 1}. It returns an empty map when no pipeline matches.
+func CountLatestResults(ctx context.Context, params CountLatestResultsParams) (map[string]int, error) {
+	query := psql.Select(
+		sm.Distinct("pipeline_id"),
+		sm.Columns("pipeline_id", "pipeline_result"),
+		sm.From("pipelineReports"),
+		sm.Where(psql.Raw("pipeline_id <> ''")),
+		sm.OrderBy("pipeline_id"),
+		sm.OrderBy(psql.Quote("updated_at")).Desc(),
+	)
+
+	if params.PipelineID != "" {
+		query.Apply(sm.Where(psql.Quote("pipeline_id").EQ(psql.Arg(params.PipelineID))))
+	}
+
+	// The labels are matched against the payload, as the acknowledgements are, so that an
+	// unknown label matches no pipeline rather than failing.
+	if len(params.Labels) > 0 {
+		query.Apply(sm.Where(psql.Raw("data -> 'Labels' @> ?::jsonb", psql.Arg(params.Labels))))
+	}
+
+	if err := applyRangeFilter("updated_at", dateRangeFilterParams{
+		Query:         &query,
+		DateRangeDays: params.Days,
+	}); err != nil {
+		return nil, fmt.Errorf("applying updated_at range filter: %w", err)
+	}
+
+	queryString, args, err := query.Build(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
+	}
+
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying the latest result of the pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+
+	for rows.Next() {
+		pipelineID, result := "", ""
+		if err := rows.Scan(&pipelineID, &result); err != nil {
+			return nil, fmt.Errorf("parsing the latest result of a pipeline: %w", err)
+		}
+
+		counts[result]++
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading the latest result of the pipelines: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+const (
+	// defaultCheckBatchSize is the number of reports checked, and repaired, at once.
+	defaultCheckBatchSize = 500
+	// maxListedDrifts caps the drifted reports listed by CheckReports, the others are
+	// only counted.
+	maxListedDrifts = 100
+)
+
+// CheckReportsOptions configures CheckReports.
+type CheckReportsOptions struct {
+	// Repair recomputes the drifted columns.
+	Repair bool
+	// BatchSize is the number of reports read, and repaired, at once.
+	// Default to 500
+	BatchSize int
+}
+
+// ReportDrift is a report whose denormalized columns differ from its payload.
+type ReportDrift struct {
+	ID uuid.UUID `json:"id"`
+	// Columns are the names of the columns which differ.
+	Columns []string `json:"columns"`
+	// Incomplete is set when a scm, a config or a label the report refers to does not
+	// exist, the repair inserts it.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// CheckReportsResult is the outcome of CheckReports.
+type CheckReportsResult struct {
+	Checked  int `json:"checked"`
+	Drifted  int `json:"drifted"`
+	Repaired int `json:"repaired"`
+	// Reports are the first drifted reports, the others are only counted.
+	Reports []ReportDrift `json:"reports"`
+}
+
+// storedReport is a report as read by CheckReports.
+type storedReport struct {
+	id      uuid.UUID
+	report  reports.Report
+	columns reportColumns
+}
+
+// CheckReports verifies the columns of every report denormalized from its payload, the ones
+// migration 000010 had to fix, against the columns InsertReport computes from it today.
+// With Repair set, the drifted ones are recomputed.
+//
+// A column only the repair can fix since it requires a scm, a config or a label to be
+// inserted is reported as drifted: a check alone never writes anything.
+func CheckReports(ctx context.Context, o CheckReportsOptions) (CheckReportsResult, error) {
+	result := CheckReportsResult{Reports: []ReportDrift{}}
+
+	if DB == nil {
+		return result, ErrNotConnected
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultCheckBatchSize
+	}
+
+	// The scms, configs and labels are looked up before being inserted, see InsertReport.
+	ctx = WithPrimary(ctx)
+
+	after := uuid.Nil
+
+	for {
+		batch, err := readReportBatch(ctx, after, o.BatchSize, reportFilter{})
+		if err != nil {
+			return result, err
+		}
+
+		if len(batch) == 0 {
+			return result, nil
+		}
+		after = batch[len(batch)-1].id
+
+		repairs := map[uuid.UUID]reportColumns{}
+
+		for _, r := range batch {
+			result.Checked++
+
+			computed, complete, err := buildReportColumns(ctx, r.report, &r.columns, o.Repair)
+			if err != nil {
+				return result, fmt.Errorf("computing the columns of report %s: %w", r.id, err)
+			}
+
+			drifted := driftedColumns(r.columns, computed)
+			if len(drifted) == 0 && complete {
+				continue
+			}
+
+			result.Drifted++
+			if len(result.Reports) < maxListedDrifts {
+				result.Reports = append(result.Reports, ReportDrift{
+					ID:         r.id,
+					Columns:    drifted,
+					Incomplete: !complete,
+				})
+			}
+
+			if o.Repair && len(drifted) > 0 {
+				repairs[r.id] = computed
+			}
+		}
+
+		if err := repairReportColumns(ctx, repairs); err != nil {
+			return result, err
+		}
+		result.Repaired += len(repairs)
+
+		logrus.WithContext(ctx).Debugf("checked %d reports, %d drifted", result.Checked, result.Drifted)
+	}
+}
+
+// reportFilter restricts the reports read by readReportBatch, as the reports search does.
+type reportFilter struct {
+	StartTime string
+	EndTime   string
+	Labels    map[string]string
+}
+
+// filteredReports returns the query selecting the provided columns of the reports matching
+// filter.
+func filteredReports(ctx context.Context, filter reportFilter, columns ...any) (bob.BaseQuery[*dialect.SelectQuery], error) {
+	query := psql.Select(
+		sm.Columns(columns...),
+		sm.From("pipelineReports"),
+	)
+
+	if err := applyRangeFilter("updated_at", dateRangeFilterParams{
+		Query:     &query,
+		StartTime: filter.StartTime,
+		EndTime:   filter.EndTime,
+	}); err != nil {
+		return query, fmt.Errorf("applying updated_at range filter: %w", err)
+	}
+
+	if err := applyLabelFilter(labelFilterParams{
+		Query:     &query,
+		Labels:    filter.Labels,
+		StartTime: filter.StartTime,
+		EndTime:   filter.EndTime,
+		Ctx:       ctx,
+	}); err != nil {
+		return query, fmt.Errorf("applying label filter: %w", err)
+	}
+
+	return query, nil
+}
+
+// countReports returns the number of reports matching filter.
+func countReports(ctx context.Context, filter reportFilter) (int, error) {
+	query, err := filteredReports(ctx, filter, "count(*)")
+	if err != nil {
+		return 0, err
+	}
+
+	queryString, args, err := query.Build(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
+	}
+
+	total := 0
+	if err := DB.QueryRow(ctx, queryString, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("counting reports: %w", err)
+	}
+
+	return total, nil
+}
+
+// readReportBatch reads the reports matching filter following the provided id, in the order
+// of their id.
+func readReportBatch(ctx context.Context, after uuid.UUID, size int, filter reportFilter) ([]storedReport, error) {
+	query, err := filteredReports(ctx, filter,
+		"id", "data", "pipeline_id", "pipeline_result", "pipeline_name", "target_db_scm_ids",
+		"config_source_ids", "config_condition_ids", "config_target_ids", "label_ids")
+	if err != nil {
+		return nil, err
+	}
+
+	query.Apply(
+		sm.Where(psql.Quote("id").GT(psql.Arg(after))),
+		sm.OrderBy(psql.Quote("id")),
+		sm.Limit(size),
+	)
+
+	queryString, args, err := query.Build(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
+	}
+
+	rows, err := DB.Query(ctx, queryString, args...)
+	if err != nil {
+		return nil, fmt.Errorf("reading reports: %w", err)
+	}
+
+	batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storedReport, error) {
+		r := storedReport{}
+		err := row.Scan(
+			&r.id,
+			&r.report,
+			&r.columns.PipelineID,
+			&r.columns.PipelineResult,
+			&r.columns.PipelineName,
+			&r.columns.TargetDBScmIDs,
+			&r.columns.ConfigSourceIDs,
+			&r.columns.ConfigConditionIDs,
+			&r.columns.ConfigTargetIDs,
+			&r.columns.LabelIDs,
+		)
+		return r, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading reports: %w", err)
+	}
+
+	return batch, nil
+}
+
+// repairReportColumns stores the provided columns, in a single transaction.
+func repairReportColumns(ctx context.Context, repairs map[uuid.UUID]reportColumns) error {
+	if len(repairs) == 0 {
+		return nil
+	}
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("repairing reports: %w", err)
+	}
+	defer func() {
+		// A no-op once committed.
+		_ = tx.Rollback(context.Background())
+	}()
+
+	for id, c := range repairs {
+		_, err := tx.Exec(ctx, `
+			UPDATE pipelineReports
+			SET pipeline_id = $2, pipeline_result = $3, pipeline_name = $4, target_db_scm_ids = $5,
+				config_source_ids = $6, config_condition_ids = $7, config_target_ids = $8, label_ids = $9
+			WHERE id = $1`,
+			id, c.PipelineID, c.PipelineResult, c.PipelineName, c.TargetDBScmIDs,
+			c.ConfigSourceIDs, c.ConfigConditionIDs, c.ConfigTargetIDs, c.LabelIDs,
+		)
+		if err != nil {
+			return fmt.Errorf("repairing report %s: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("repairing reports: %w", err)
+	}
+
+	return nil
+}
@@ -55,7 +55,7 @@ func InsertConfigResource(ctx context.Context, resourceType, resourceKind string
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return "", err
 	}
 
@@ -65,7 +65,7 @@ func InsertConfigResource(ctx context.Context, resourceType, resourceKind string
 	)
 
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return "", err
 	}
 
@@ -94,13 +94,13 @@ func DeleteConfigResource(ctx context.Context, resourceType string, id string) e
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return err
 	}
 
 	_, err = DB.Exec(ctx, queryString, args...)
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return err
 	}
 
@@ -131,13 +131,13 @@ func GetConfigKind(ctx context.Context, resourceType string) ([]string, error) {
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return nil, err
 	}
 
-	rows, err := DB.Query(ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -147,14 +147,14 @@ func GetConfigKind(ctx context.Context, resourceType string) ([]string, error) {
 		var kind string
 		err := rows.Scan(&kind)
 		if err != nil {
-			logrus.Errorf("parsing config source kind result: %s", err)
+			logrus.WithContext(ctx).Errorf("parsing config source kind result: %s", err)
 			return nil, err
 		}
 		results = append(results, kind)
 	}
 
 	if err := rows.Err(); err != nil {
-		logrus.Errorf("reading config kinds: %s", err)
+		logrus.WithContext(ctx).Errorf("reading config kinds: %s", err)
 		return nil, err
 	}
 
@@ -191,6 +191,7 @@ func GetSourceConfigs(ctx context.Context, kind, id, config string, limit, page
 
 	query.Apply(
 		sm.OrderBy(psql.Quote("updated_at")).Desc(),
+		sm.OrderBy(psql.Quote("id")),
 	)
 
 	// Get total count of results
@@ -198,28 +199,28 @@ func GetSourceConfigs(ctx context.Context, kind, id, config string, limit, page
 	totalQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
 	totalQueryString, totalArgs, err := totalQuery.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
+		logrus.WithContext(ctx).Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
 		return nil, 0, err
 	}
 
-	if err = DB.QueryRow(ctx, totalQueryString, totalArgs...).Scan(
+	if err = readDB(ctx).QueryRow(ctx, totalQueryString, totalArgs...).Scan(
 		&totalCount,
 	); err != nil {
-		logrus.Errorf("parsing total count result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing total count result: %s", err)
 	}
 
 	applyPagination(&query, limit, page)
 
 	queryString, args, err := query.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 
-	rows, err := DB.Query(ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 	defer rows.Close()
@@ -233,13 +234,13 @@ func GetSourceConfigs(ctx context.Context, kind, id, config string, limit, page
 
 		err := rows.Scan(&r.ID, &r.Kind, &r.Created_at, &r.Updated_at, &config)
 		if err != nil {
-			logrus.Errorf("parsing Source result: %s", err)
+			logrus.WithContext(ctx).Errorf("parsing Source result: %s", err)
 			return nil, 0, err
 		}
 
 		err = json.Unmarshal([]byte(config), &r.Config)
 		if err != nil {
-			logrus.Errorf("parsing config source result: %s\n\t%s", r.ID, err)
+			logrus.WithContext(ctx).Errorf("parsing config source result: %s\n\t%s", r.ID, err)
 			continue
 		}
 
@@ -247,7 +248,7 @@ func GetSourceConfigs(ctx context.Context, kind, id, config string, limit, page
 	}
 
 	if err := rows.Err(); err != nil {
-		logrus.Errorf("reading config sources: %s", err)
+		logrus.WithContext(ctx).Errorf("reading config sources: %s", err)
 		return nil, 0, err
 	}
 
@@ -284,34 +285,35 @@ func GetConditionConfigs(ctx context.Context, kind, id, config string, limit, pa
 
 	query.Apply(
 		sm.OrderBy(psql.Quote("updated_at")).Desc(),
+		sm.OrderBy(psql.Quote("id")),
 	)
 
 	totalCount := 0
 	totalQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
 	totalQueryString, totalArgs, err := totalQuery.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
+		logrus.WithContext(ctx).Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
 		return nil, 0, err
 	}
 
-	if err = DB.QueryRow(ctx, totalQueryString, totalArgs...).Scan(
+	if err = readDB(ctx).QueryRow(ctx, totalQueryString, totalArgs...).Scan(
 		&totalCount,
 	); err != nil {
-		logrus.Errorf("parsing total count result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing total count result: %s", err)
 	}
 
 	applyPagination(&query, limit, page)
 
 	queryString, args, err := query.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 
-	rows, err := DB.Query(ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 	defer rows.Close()
@@ -327,14 +329,14 @@ func GetConditionConfigs(ctx context.Context, kind, id, config string, limit, pa
 		err := rows.Scan(&r.ID, &r.Kind, &r.Created_at, &r.Updated_at, &config)
 		if err != nil {
 
-			logrus.Errorf("Query: %q\n\t%s", queryString, err)
-			logrus.Errorf("parsing  condition result: %s", err)
+			logrus.WithContext(ctx).Errorf("Query: %q\n\t%s", queryString, err)
+			logrus.WithContext(ctx).Errorf("parsing  condition result: %s", err)
 			return nil, 0, err
 		}
 
 		err = json.Unmarshal([]byte(config), &r.Config)
 		if err != nil {
-			logrus.Errorf("parsing config condition result: %s\n\t%s", r.ID, err)
+			logrus.WithContext(ctx).Errorf("parsing config condition result: %s\n\t%s", r.ID, err)
 			continue
 		}
 
@@ -342,7 +344,7 @@ func GetConditionConfigs(ctx context.Context, kind, id, config string, limit, pa
 	}
 
 	if err := rows.Err(); err != nil {
-		logrus.Errorf("reading config conditions: %s", err)
+		logrus.WithContext(ctx).Errorf("reading config conditions: %s", err)
 		return nil, 0, err
 	}
 
@@ -379,34 +381,35 @@ func GetTargetConfigs(ctx context.Context, kind, id, config string, limit, page
 
 	query.Apply(
 		sm.OrderBy(psql.Quote("updated_at")).Desc(),
+		sm.OrderBy(psql.Quote("id")),
 	)
 
 	totalCount := 0
 	totalQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
 	totalQueryString, totalArgs, err := totalQuery.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
+		logrus.WithContext(ctx).Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
 		return nil, 0, err
 	}
 
-	if err = DB.QueryRow(ctx, totalQueryString, totalArgs...).Scan(
+	if err = readDB(ctx).QueryRow(ctx, totalQueryString, totalArgs...).Scan(
 		&totalCount,
 	); err != nil {
-		logrus.Errorf("parsing total count result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing total count result: %s", err)
 	}
 
 	applyPagination(&query, limit, page)
 
 	queryString, args, err := query.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 
-	rows, err := DB.Query(ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 	defer rows.Close()
@@ -420,14 +423,14 @@ func GetTargetConfigs(ctx context.Context, kind, id, config string, limit, page
 
 		err := rows.Scan(&r.ID, &r.Kind, &r.Created_at, &r.Updated_at, &config)
 		if err != nil {
-			logrus.Errorf("Query: %q\n\t%s", queryString, err)
-			logrus.Errorf("parsing target result: %s", err)
+			logrus.WithContext(ctx).Errorf("Query: %q\n\t%s", queryString, err)
+			logrus.WithContext(ctx).Errorf("parsing target result: %s", err)
 			return nil, 0, err
 		}
 
 		err = json.Unmarshal([]byte(config), &r.Config)
 		if err != nil {
-			logrus.Errorf("parsing config source result: %s\n\t%s", r.ID, err)
+			logrus.WithContext(ctx).Errorf("parsing config source result: %s\n\t%s", r.ID, err)
 			continue
 		}
 
@@ -435,7 +438,7 @@ func GetTargetConfigs(ctx context.Context, kind, id, config string, limit, page
 	}
 
 	if err := rows.Err(); err != nil {
-		logrus.Errorf("reading config targets: %s", err)
+		logrus.WithContext(ctx).Errorf("reading config targets: %s", err)
 		return nil, 0, err
 	}
 
@@ -2,19 +2,19 @@ package database
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"context"
 
-	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-
-	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
 const (
@@ -28,14 +28,144 @@ var (
 	fs embed.FS
 )
 
+const (
+	// defaultApplicationName is the application_name of the connections, shown by
+	// pg_stat_activity, when neither the options nor the URI set one.
+	defaultApplicationName = "udash"
+	// defaultStartupTimeout is how long the database is waited for on startup.
+	defaultStartupTimeout = time.Minute
+	// startupRetryMaxDelay caps the delay between two connection attempts on startup.
+	startupRetryMaxDelay = 10 * time.Second
+)
+
 type Options struct {
 	// URI defines the DB URI
 	URI               string
 	MigrationDisabled bool
+	// MaxConns is the maximum number of connections of the pool.
+	// Default to the pool_max_conns URI parameter, then to the greater of 4 and the number of CPUs
+	MaxConns int32
+	// MinConns is the number of connections the pool keeps open, even idle.
+	// Default to the pool_min_conns URI parameter, then to 0
+	MinConns int32
+	// MaxConnLifetime is how long a connection is used before it is replaced.
+	// Default to the pool_max_conn_lifetime URI parameter, then to 1h
+	MaxConnLifetime time.Duration
+	// MaxConnIdleTime is how long an idle connection is kept open.
+	// Default to the pool_max_conn_idle_time URI parameter, then to 30m
+	MaxConnIdleTime time.Duration
+	// StatementTimeout aborts, on the database side, any statement running longer.
+	// Default to the statement_timeout URI parameter, then to the one of the database
+	StatementTimeout time.Duration
+	// ApplicationName identifies the connections of udash in pg_stat_activity.
+	// Default to the application_name URI parameter, then to "udash"
+	ApplicationName string
+	// QueryTimeout bounds the time the queries of a single API request may take altogether.
+	// Default to 0, which does not time out
+	QueryTimeout time.Duration
+	// StartupTimeout is how long the database is waited for on startup, retrying with a
+	// backoff, before giving up.
+	// Default to 1m
+	StartupTimeout time.Duration
+	// ReplicaURI is the postgresql URI of a read replica the searches are routed to, using
+	// the pool options of the primary. The replica is optional on startup: until it is
+	// found healthy, and whenever it is not, the searches run on the primary. Its user needs
+	// the pg_read_all_stats role for the replica to be found streaming from the primary.
+	// Default to the UDASH_DB_REPLICA_URI environment variable
+	ReplicaURI string
+	// ReplicaMaxLag is how far behind the primary the replica may be before the searches
+	// fall back to the primary.
+	// Default to 30s
+	ReplicaMaxLag time.Duration
+	// MigrationTimeout is how long the lock held by another udash migrating the schema is
+	// waited for on startup, or, when the migrations are disabled, how long the schema is
+	// waited for to reach the version of the embedded migrations.
+	// Default to 5m
+	MigrationTimeout time.Duration
+}
+
+// Validate reports the options which cannot be applied.
+func (o Options) Validate() error {
+	errs := []error{}
+
+	if o.MaxConns < 0 || o.MinConns < 0 {
+		errs = append(errs, errors.New("the number of connections cannot be negative"))
+	}
+
+	if o.MaxConns > 0 && o.MinConns > o.MaxConns {
+		errs = append(errs, fmt.Errorf("the minimum number of connections %d exceeds the maximum %d", o.MinConns, o.MaxConns))
+	}
+
+	durations := map[string]time.Duration{
+		"maxconnlifetime":  o.MaxConnLifetime,
+		"maxconnidletime":  o.MaxConnIdleTime,
+		"statementtimeout": o.StatementTimeout,
+		"querytimeout":     o.QueryTimeout,
+		"startuptimeout":   o.StartupTimeout,
+		"replicamaxlag":    o.ReplicaMaxLag,
+		"migrationtimeout": o.MigrationTimeout,
+	}
+	for name, d := range durations {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s cannot be negative", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// poolConfig returns the configuration of the pool, the URI overridden by the options set.
+func (o Options) poolConfig(uri string) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URI: %w", err)
+	}
+
+	if o.MaxConns > 0 {
+		config.MaxConns = o.MaxConns
+	}
+
+	if o.MinConns > 0 {
+		config.MinConns = o.MinConns
+	}
+
+	if config.MinConns > config.MaxConns {
+		return nil, fmt.Errorf("the minimum number of connections %d exceeds the maximum %d", config.MinConns, config.MaxConns)
+	}
+
+	if o.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = o.MaxConnLifetime
+	}
+
+	if o.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = o.MaxConnIdleTime
+	}
+
+	params := config.ConnConfig.RuntimeParams
+
+	if o.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(o.StatementTimeout.Milliseconds(), 10)
+	}
+
+	switch {
+	case o.ApplicationName != "":
+		params["application_name"] = o.ApplicationName
+	case params["application_name"] == "":
+		params["application_name"] = defaultApplicationName
+	}
+
+	config.ConnConfig.Tracer = queryTracer{}
+
+	return config, nil
 }
 
-func Connect(o Options) error {
-	var err error
+// Connect creates the connection pool, and waits for the database to accept connections:
+// in a docker compose deployment, udash commonly starts before Postgres is ready. It retries
+// with an exponential backoff for up to the startup timeout, or until ctx is cancelled.
+func Connect(ctx context.Context, o Options) error {
+	if err := o.Validate(); err != nil {
+		return fmt.Errorf("invalid database options: %w", err)
+	}
 
 	if o.URI != "" {
 		if URI != "" {
@@ -44,43 +174,115 @@ func Connect(o Options) error {
 		URI = o.URI
 	}
 
-	poolConfig, err := pgxpool.ParseConfig(URI)
+	poolConfig, err := o.poolConfig(URI)
 	if err != nil {
-		return fmt.Errorf("failed to parse database URI: %w", err)
+		return err
 	}
 
-	DB, err = pgxpool.NewWithConfig(context.Background(), poolConfig)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create pgx pool: %w", err)
 	}
 
+	startupTimeout := o.StartupTimeout
+	if startupTimeout == 0 {
+		startupTimeout = defaultStartupTimeout
+	}
+
+	if err := waitForDatabase(ctx, pool, startupTimeout); err != nil {
+		pool.Close()
+		return err
+	}
+
+	replicaURI := o.ReplicaURI
+	if replicaURI == "" {
+		replicaURI = os.Getenv(ReplicaURIEnvVariableName)
+	}
+
+	if replicaURI != "" {
+		replicaConfig, err := o.poolConfig(replicaURI)
+		if err != nil {
+			pool.Close()
+			return fmt.Errorf("read replica: %w", err)
+		}
+
+		maxLag := o.ReplicaMaxLag
+		if maxLag == 0 {
+			maxLag = defaultReplicaMaxLag
+		}
+
+		replica, err = newReplicaPool(replicaConfig, maxLag)
+		if err != nil {
+			pool.Close()
+			return err
+		}
+	}
+
+	DB = pool
+	queryTimeout = o.QueryTimeout
+
+	migrationTimeout = o.MigrationTimeout
+	if migrationTimeout == 0 {
+		migrationTimeout = defaultMigrationTimeout
+	}
+
 	logrus.Infoln("database connected")
 
 	return nil
 }
 
-func RunMigrationUp() error {
-	logrus.Debugln("Running Database migration")
-	d, err := iofs.New(fs, "migrations")
-	if err != nil {
-		return fmt.Errorf("reading migrations: %w", err)
+// waitForDatabase pings the database until it answers, doubling the delay between two
+// attempts up to startupRetryMaxDelay.
+func waitForDatabase(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		logrus.Warnf("database not ready, attempt %d: %s", attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not ready after %s: %w", timeout, err)
+		case <-time.After(delay):
+		}
+
+		delay = min(2*delay, startupRetryMaxDelay)
 	}
+}
 
-	m, err := migrate.NewWithSourceInstance(
-		"iofs",
-		d,
-		URI,
-	)
-	if err != nil {
-		return fmt.Errorf("loading migration: %w", err)
+// queryTimeout is the QueryTimeout of the options the pool was created with.
+var queryTimeout time.Duration
+
+// WithQueryTimeout returns a copy of ctx bounded by the configured query timeout, derived
+// from the context of the request so that the queries are also cancelled when the client
+// goes away. It returns ctx unchanged when no timeout is configured.
+func WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// Close closes every connection of the pools, waiting for the ones in use to be released.
+func Close() {
+	if replica != nil {
+		replica.close()
+		replica = nil
 	}
 
-	err = m.Up()
-	if err != nil && err.Error() != migrate.ErrNoChange.Error() {
-		return fmt.Errorf("running migration: %w", err)
+	if DB == nil {
+		return
 	}
 
-	return nil
+	DB.Close()
+	logrus.Infoln("database connection closed")
 }
 
 func stringPtr(s string) *string {
@@ -2,9 +2,13 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/updatecli/udash/test"
@@ -24,11 +28,30 @@ func TestDatabase(t *testing.T) {
 	dbURL, err := postgresContainer.ConnectionString(ctx, "sslmode=disable")
 	require.NoError(t, err)
 
-	require.NoError(t, Connect(Options{URI: dbURL}))
+	require.NoError(t, Connect(ctx, Options{URI: dbURL}))
 	t.Log("Postgres Container connected")
-	require.NoError(t, RunMigrationUp())
+	require.NoError(t, RunMigrationUp(ctx))
 	t.Log("Postgres Container migrations run")
 
+	t.Run("schema is at the version of the embedded migrations", func(t *testing.T) {
+		expected, err := ExpectedSchemaVersion()
+		require.NoError(t, err)
+		assert.NotZero(t, expected)
+
+		current, dirty, err := SchemaVersion(ctx)
+		require.NoError(t, err)
+		assert.False(t, dirty)
+		assert.Equal(t, expected, current)
+
+		require.NoError(t, Ping(ctx))
+	})
+
+	t.Run("a database out of recovery has no replication lag", func(t *testing.T) {
+		lag, err := replicationLag(ctx, DB)
+		require.NoError(t, err)
+		assert.Zero(t, lag)
+	})
+
 	t.Run("truncateToBucket matches date_trunc", func(t *testing.T) {
 		// The summary zero fills its buckets from truncateToBucket while the counted
 		// rows are bucketed by date_trunc. Any divergence between the two silently
@@ -250,4 +273,516 @@ func TestDatabase(t *testing.T) {
 
 		assert.True(t, indexed)
 	})
+
+	t.Run("fleet metrics read the latest report of every pipeline", func(t *testing.T) {
+		url := "https://example.com/fleet-metrics.git"
+		target := map[string]*result.Target{
+			"default": {
+				Scm: result.SCM{
+					URL: url,
+					Branch: struct {
+						Source  string
+						Working string
+						Target  string
+					}{Source: "main", Working: "main", Target: "main"},
+				},
+			},
+		}
+
+		published := []reports.Report{
+			{Name: "fleet", Result: result.FAILURE, ID: "fleet-metrics", Targets: target},
+			{
+				Name:    "fleet",
+				Result:  result.SUCCESS,
+				ID:      "fleet-metrics",
+				Targets: target,
+				Actions: map[string]*reports.Action{
+					"default": {ID: "default", Link: "https://example.com/fleet-metrics/pull/1"},
+				},
+			},
+		}
+
+		for _, report := range published {
+			id, err := InsertReport(ctx, report)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_, err := DB.Exec(ctx, "DELETE FROM pipelineReports WHERE id = $1", id)
+				assert.NoError(t, err)
+			})
+		}
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "DELETE FROM scms WHERE url = $1", url)
+			assert.NoError(t, err)
+		})
+
+		snapshot, err := readFleetSnapshot(ctx)
+		require.NoError(t, err)
+
+		var pipeline *pipelineState
+		for i := range snapshot.pipelines {
+			if snapshot.pipelines[i].ID == "fleet-metrics" {
+				pipeline = &snapshot.pipelines[i]
+			}
+		}
+
+		require.NotNil(t, pipeline)
+		assert.Equal(t, result.SUCCESS, pipeline.Result)
+		assert.True(t, pipeline.OpenAction)
+		// The age is computed by the database, whatever the time zone of its session.
+		assert.WithinDuration(t, time.Now(), pipeline.LastReport, time.Minute)
+		assert.Equal(t, 1, snapshot.openActions[scmKey{URL: url, Branch: "main"}])
+	})
+
+	t.Run("the latest migration can be reverted and applied again", func(t *testing.T) {
+		expected, err := ExpectedSchemaVersion()
+		require.NoError(t, err)
+
+		steps, err := PlanMigration(ctx, expected-1)
+		require.NoError(t, err)
+		require.Len(t, steps, 1)
+		assert.False(t, steps[0].Up)
+		assert.Equal(t, expected, steps[0].Version)
+		assert.NotEmpty(t, steps[0].SQL)
+
+		require.NoError(t, MigrateTo(ctx, expected-1))
+
+		status, err := GetMigrationStatus(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, expected-1, status.Version)
+		require.Len(t, status.Pending, 1)
+		assert.Equal(t, expected, status.Pending[0].Version)
+
+		require.NoError(t, MigrateTo(ctx, expected))
+
+		status, err = GetMigrationStatus(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, expected, status.Version)
+		assert.Empty(t, status.Pending)
+
+		_, err = PlanMigration(ctx, expected+1)
+		assert.Error(t, err, "no such migration")
+	})
+
+	t.Run("migrations are serialized by the migration lock", func(t *testing.T) {
+		defer func(d time.Duration) { migrationTimeout = d }(migrationTimeout)
+		migrationTimeout = 2 * time.Second
+
+		conn, err := DB.Acquire(ctx)
+		require.NoError(t, err)
+		defer conn.Release()
+
+		_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+		require.NoError(t, err)
+
+		assert.ErrorContains(t, RunMigrationUp(ctx), "still held")
+
+		_, err = conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+		require.NoError(t, err)
+
+		errs := make(chan error, 3)
+		for range 3 {
+			go func() { errs <- RunMigrationUp(ctx) }()
+		}
+		for range 3 {
+			assert.NoError(t, <-errs)
+		}
+
+		assert.NoError(t, WaitForSchema(ctx))
+	})
+
+	t.Run("a schema newer than the embedded migrations is rejected", func(t *testing.T) {
+		defer func(d time.Duration) { migrationTimeout = d }(migrationTimeout)
+		migrationTimeout = 2 * time.Second
+
+		_, err := DB.Exec(ctx, "UPDATE schema_migrations SET version = version + 1")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "UPDATE schema_migrations SET version = version - 1")
+			assert.NoError(t, err)
+		})
+
+		assert.ErrorIs(t, RunMigrationUp(ctx), ErrSchemaNewer)
+		assert.ErrorIs(t, WaitForSchema(ctx), ErrSchemaNewer)
+	})
+
+	t.Run("the check finds and repairs the drifted columns", func(t *testing.T) {
+		report := reports.Report{
+			Name:   "check",
+			Result: result.SUCCESS,
+			ID:     "check",
+			Labels: map[string]string{"team": "check"},
+			Conditions: map[string]*result.Condition{
+				"condition": {Config: map[string]any{"Kind": "shell", "Spec": map[string]any{"command": "true"}}},
+			},
+		}
+
+		first, err := InsertReport(ctx, report)
+		require.NoError(t, err)
+		second, err := InsertReport(ctx, report)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "DELETE FROM pipelineReports WHERE id = ANY($1)", []string{first, second})
+			assert.NoError(t, err)
+		})
+
+		// The conditions used to be looked up among the targets, so that every report
+		// inserted its condition config again.
+		var firstConditions, secondConditions string
+		require.NoError(t, DB.QueryRow(ctx,
+			"SELECT config_condition_ids::text FROM pipelineReports WHERE id = $1", first).Scan(&firstConditions))
+		require.NoError(t, DB.QueryRow(ctx,
+			"SELECT config_condition_ids::text FROM pipelineReports WHERE id = $1", second).Scan(&secondConditions))
+		assert.Equal(t, firstConditions, secondConditions)
+
+		// Other subtests may leave reports behind, only the ones of this one are looked at.
+		driftOf := func(checked CheckReportsResult, id string) *ReportDrift {
+			for _, drift := range checked.Reports {
+				if drift.ID.String() == id {
+					return &drift
+				}
+			}
+			return nil
+		}
+
+		checked, err := CheckReports(ctx, CheckReportsOptions{})
+		require.NoError(t, err)
+		assert.Nil(t, driftOf(checked, first))
+		assert.Nil(t, driftOf(checked, second))
+
+		_, err = DB.Exec(ctx,
+			"UPDATE pipelineReports SET pipeline_name = '', label_ids = NULL, config_condition_ids = NULL WHERE id = $1", first)
+		require.NoError(t, err)
+
+		checked, err = CheckReports(ctx, CheckReportsOptions{BatchSize: 1})
+		require.NoError(t, err)
+		assert.Zero(t, checked.Repaired)
+		drift := driftOf(checked, first)
+		require.NotNil(t, drift)
+		assert.ElementsMatch(t, []string{"pipeline_name", "config_condition_ids", "label_ids"}, drift.Columns)
+		assert.Nil(t, driftOf(checked, second))
+
+		checked, err = CheckReports(ctx, CheckReportsOptions{Repair: true, BatchSize: 1})
+		require.NoError(t, err)
+		assert.NotZero(t, checked.Repaired)
+
+		checked, err = CheckReports(ctx, CheckReportsOptions{})
+		require.NoError(t, err)
+		assert.Nil(t, driftOf(checked, first))
+
+		var name, conditions string
+		require.NoError(t, DB.QueryRow(ctx,
+			"SELECT pipeline_name, config_condition_ids::text FROM pipelineReports WHERE id = $1", first).Scan(&name, &conditions))
+		assert.Equal(t, "check", name)
+		assert.Equal(t, secondConditions, conditions)
+	})
+
+	t.Run("duplicated condition configs resolve to the most recently updated one", func(t *testing.T) {
+		config := map[string]any{"Kind": "shell", "Spec": map[string]any{"command": "duplicated"}}
+		data, err := json.Marshal(config)
+		require.NoError(t, err)
+
+		configIDs := []string{}
+		for i := range 3 {
+			id, err := InsertConfigResource(ctx, configConditionType, "shell", string(data))
+			require.NoError(t, err)
+			configIDs = append(configIDs, id)
+
+			_, err = DB.Exec(ctx, "UPDATE config_conditions SET updated_at = now() - make_interval(hours => $1) WHERE id = $2", 3-i, id)
+			require.NoError(t, err)
+		}
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "DELETE FROM config_conditions WHERE id = ANY($1)", configIDs)
+			assert.NoError(t, err)
+		})
+
+		reportID, err := InsertReport(ctx, reports.Report{
+			Name:       "duplicated",
+			Result:     result.SUCCESS,
+			ID:         "duplicated",
+			Conditions: map[string]*result.Condition{"condition": {Config: config}},
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "DELETE FROM pipelineReports WHERE id = $1", reportID)
+			assert.NoError(t, err)
+		})
+
+		conditions := pgtype.Hstore{}
+		require.NoError(t, DB.QueryRow(ctx,
+			"SELECT config_condition_ids FROM pipelineReports WHERE id = $1", reportID).Scan(&conditions))
+		require.Len(t, conditions, 1)
+		assert.Contains(t, conditions, configIDs[2])
+
+		// The check does not take the resolved config for a drift, nor wipes it on repair.
+		checked, err := CheckReports(ctx, CheckReportsOptions{Repair: true})
+		require.NoError(t, err)
+		for _, drift := range checked.Reports {
+			assert.NotEqual(t, reportID, drift.ID.String())
+		}
+
+		require.NoError(t, DB.QueryRow(ctx,
+			"SELECT config_condition_ids FROM pipelineReports WHERE id = $1", reportID).Scan(&conditions))
+		assert.Contains(t, conditions, configIDs[2])
+	})
+
+	t.Run("a reprocessing job recomputes the selected reports and resumes", func(t *testing.T) {
+		report := reports.Report{
+			Name:   "reprocess",
+			Result: result.SUCCESS,
+			ID:     "reprocess",
+			Labels: map[string]string{"job": "reprocess"},
+		}
+
+		ids := []string{}
+		for range 3 {
+			id, err := InsertReport(ctx, report)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "DELETE FROM pipelineReports WHERE id = ANY($1)", ids)
+			assert.NoError(t, err)
+		})
+
+		_, err := DB.Exec(ctx, "UPDATE pipelineReports SET pipeline_name = '' WHERE id = ANY($1)", ids)
+		require.NoError(t, err)
+
+		_, err = CreateReprocessJob(ctx, ReprocessJobParams{BatchSize: -1})
+		require.ErrorIs(t, err, ErrInvalidReprocessJob)
+
+		job, err := CreateReprocessJob(ctx, ReprocessJobParams{
+			Labels:     map[string]string{"job": "reprocess"},
+			BatchSize:  2,
+			BatchDelay: time.Millisecond,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ReprocessPending, job.Status)
+
+		// Interrupted after its first batch.
+		claimed, err := claimReprocessJob(ctx)
+		require.NoError(t, err)
+		require.Equal(t, job.ID, claimed.ID)
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		claimed.BatchDelayMs = 60_000
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runReprocessJob(jobCtx, claimed)
+		}()
+
+		require.Eventually(t, func() bool {
+			job, err = GetReprocessJob(ctx, job.ID.String())
+			return err == nil && job.Processed == 2
+		}, 10*time.Second, 10*time.Millisecond)
+		cancel()
+		<-done
+
+		job, err = GetReprocessJob(ctx, job.ID.String())
+		require.NoError(t, err)
+		assert.Equal(t, ReprocessPending, job.Status)
+		assert.Equal(t, 3, job.Total)
+		assert.Equal(t, 2, job.Updated)
+
+		// Resumed after the reports already processed.
+		claimed, err = claimReprocessJob(ctx)
+		require.NoError(t, err)
+		runReprocessJob(ctx, claimed)
+
+		job, err = GetReprocessJob(ctx, job.ID.String())
+		require.NoError(t, err)
+		assert.Equal(t, ReprocessCompleted, job.Status)
+		assert.Equal(t, 3, job.Processed)
+		assert.Equal(t, 3, job.Updated)
+		assert.Zero(t, job.Failed)
+
+		remaining := 0
+		require.NoError(t, DB.QueryRow(ctx,
+			"SELECT count(*) FROM pipelineReports WHERE id = ANY($1) AND pipeline_name = ''", ids).Scan(&remaining))
+		assert.Zero(t, remaining)
+
+		_, err = CancelReprocessJob(ctx, job.ID.String())
+		assert.ErrorIs(t, err, ErrReprocessJobDone)
+	})
+
+	t.Run("the listeners are told the previous state of the pipeline", func(t *testing.T) {
+		inserted := []InsertedReport{}
+		t.Cleanup(OnReportInserted(func(_ context.Context, r InsertedReport) {
+			if r.Report.ID == "listened" {
+				inserted = append(inserted, r)
+			}
+		}))
+
+		report := reports.Report{
+			Name:   "listened",
+			Result: result.SUCCESS,
+			ID:     "listened",
+		}
+
+		first, err := InsertReport(ctx, report)
+		require.NoError(t, err)
+
+		report.Result = result.FAILURE
+		second, err := InsertReport(ctx, report)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "DELETE FROM pipelineReports WHERE id = ANY($1)", []string{first, second})
+			assert.NoError(t, err)
+		})
+
+		require.Len(t, inserted, 2)
+		assert.Nil(t, inserted[0].Previous)
+		assert.Equal(t, second, inserted[1].ID)
+		require.NotNil(t, inserted[1].Previous)
+		assert.Equal(t, first, inserted[1].Previous.ReportID)
+		assert.Equal(t, result.SUCCESS, inserted[1].Previous.Result)
+		assert.Empty(t, inserted[1].Previous.ActionURLs)
+		assert.NoError(t, inserted[1].PreviousErr)
+
+		// Read again once inserted, the previous state leaves the inserted report out.
+		previous, err := PreviousPipelineState(ctx, inserted[1])
+		require.NoError(t, err)
+		require.NotNil(t, previous)
+		assert.Equal(t, first, previous.ReportID)
+	})
+
+	t.Run("a notification delivery is claimed once and retried", func(t *testing.T) {
+		d, err := InsertNotificationDelivery(ctx, NewNotificationDelivery{
+			Rule:       "retried",
+			Event:      "result_changed",
+			PipelineID: "retried",
+			Payload:    []byte(`{"rule":"retried"}`),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, DeliveryPending, d.Status)
+
+		claimed, err := ClaimNotificationDeliveries(ctx, 10, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, d.ID, claimed[0].ID)
+		assert.Equal(t, 1, claimed[0].Attempts)
+
+		// Leased, it is not claimed again meanwhile.
+		claimed, err = ClaimNotificationDeliveries(ctx, 10, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		d, err = RecordNotificationAttempt(ctx, d.ID, NotificationAttempt{ResponseStatus: 503, Error: "unavailable", RetryIn: time.Millisecond})
+		require.NoError(t, err)
+		assert.Equal(t, DeliveryPending, d.Status)
+		assert.Equal(t, 503, d.ResponseStatus)
+
+		require.Eventually(t, func() bool {
+			claimed, err = ClaimNotificationDeliveries(ctx, 10, time.Minute)
+			return err == nil && len(claimed) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 2, claimed[0].Attempts)
+
+		d, err = RecordNotificationAttempt(ctx, d.ID, NotificationAttempt{ResponseStatus: 200})
+		require.NoError(t, err)
+		assert.Equal(t, DeliveryDelivered, d.Status)
+		assert.NotNil(t, d.DeliveredAt)
+
+		listed, err := ListNotificationDeliveries(ctx, ListNotificationDeliveriesParams{Rule: "retried", Status: DeliveryDelivered})
+		require.NoError(t, err)
+		require.Len(t, listed, 1)
+		assert.Equal(t, d.ID, listed[0].ID)
+
+		pruned, err := PruneNotificationDeliveries(ctx, -time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), pruned)
+	})
+
+	t.Run("a digest finds the opened actions and the stale pipelines", func(t *testing.T) {
+		start := time.Now().UTC()
+
+		report := reports.Report{
+			Name:   "digest",
+			Result: result.FAILURE,
+			ID:     "digest",
+			Actions: map[string]*reports.Action{
+				"default": {Link: "https://github.com/updatecli/udash/pull/1"},
+			},
+		}
+
+		ids := []string{}
+		for _, links := range [][]string{
+			{"https://github.com/updatecli/udash/pull/1"},
+			{"https://github.com/updatecli/udash/pull/1", "https://github.com/updatecli/udash/pull/2"},
+		} {
+			report.Actions = map[string]*reports.Action{}
+			for i, link := range links {
+				report.Actions[fmt.Sprint(i)] = &reports.Action{Link: link}
+			}
+
+			id, err := InsertReport(ctx, report)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		t.Cleanup(func() {
+			_, err := DB.Exec(ctx, "DELETE FROM pipelineReports WHERE id = ANY($1)", ids)
+			assert.NoError(t, err)
+		})
+
+		// The first report predates the period of the digest.
+		_, err := DB.Exec(ctx, "UPDATE pipelineReports SET updated_at = updated_at - interval '1 day' WHERE id = $1", ids[0])
+		require.NoError(t, err)
+
+		opened, err := SearchOpenedActions(ctx, SearchOpenedActionsParams{
+			Start: start.Add(-time.Hour),
+			End:   time.Now().UTC().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		assert.Contains(t, opened, OpenedAction{PipelineID: "digest", PipelineName: "digest", URL: "https://github.com/updatecli/udash/pull/2"})
+		assert.NotContains(t, opened, OpenedAction{PipelineID: "digest", PipelineName: "digest", URL: "https://github.com/updatecli/udash/pull/1"})
+
+		stale, err := SearchStalePipelines(ctx, SearchStalePipelinesParams{StaleAfter: time.Hour})
+		require.NoError(t, err)
+		assert.False(t, slices.ContainsFunc(stale, func(p StalePipeline) bool { return p.ID == "digest" }))
+
+		_, err = DB.Exec(ctx, "UPDATE pipelineReports SET updated_at = updated_at - interval '2 hours' WHERE id = $1", ids[1])
+		require.NoError(t, err)
+
+		stale, err = SearchStalePipelines(ctx, SearchStalePipelinesParams{StaleAfter: time.Hour})
+		require.NoError(t, err)
+		assert.True(t, slices.ContainsFunc(stale, func(p StalePipeline) bool { return p.ID == "digest" && p.Result == result.FAILURE }))
+
+		// The reporting interval of a pipeline takes precedence over the stale duration.
+		interval, err := CreateReportingInterval(ctx, NewReportingInterval{PipelineID: "digest", Interval: 3 * time.Hour})
+		require.NoError(t, err)
+
+		stale, err = SearchStalePipelines(ctx, SearchStalePipelinesParams{StaleAfter: time.Hour})
+		require.NoError(t, err)
+		assert.False(t, slices.ContainsFunc(stale, func(p StalePipeline) bool { return p.ID == "digest" }))
+
+		stale, err = SearchStalePipelines(ctx, SearchStalePipelinesParams{StaleAfter: 24 * time.Hour})
+		require.NoError(t, err)
+		assert.False(t, slices.ContainsFunc(stale, func(p StalePipeline) bool { return p.ID == "digest" }))
+
+		_, err = DB.Exec(ctx, "UPDATE reporting_intervals SET interval_seconds = 3600 WHERE id = $1", interval.ID)
+		require.NoError(t, err)
+
+		stale, err = SearchStalePipelines(ctx, SearchStalePipelinesParams{StaleAfter: 24 * time.Hour})
+		require.NoError(t, err)
+		assert.True(t, slices.ContainsFunc(stale, func(p StalePipeline) bool { return p.ID == "digest" && p.Interval == time.Hour }))
+
+		_, err = DB.Exec(ctx, "DELETE FROM reporting_intervals WHERE id = $1", interval.ID)
+		require.NoError(t, err)
+
+		scheduledAt := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+		claimed, err := ClaimNotificationDigest(ctx, "weekly", scheduledAt)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+
+		claimed, err = ClaimNotificationDigest(ctx, "weekly", scheduledAt)
+		require.NoError(t, err)
+		assert.False(t, claimed)
+
+		require.NoError(t, RecordNotificationDigest(ctx, "weekly", scheduledAt, ""))
+
+		pruned, err := PruneNotificationDigests(ctx, -time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), pruned)
+	})
 }
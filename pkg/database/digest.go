@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+)
+
+const (
+	// DigestPending is the status of a digest being sent.
+	DigestPending = "pending"
+	// DigestSent is the status of a digest accepted by the SMTP server.
+	DigestSent = "sent"
+	// DigestFailed is the status of a digest which could not be sent.
+	DigestFailed = "failed"
+)
+
+// ClaimNotificationDigest records the run of a digest scheduled at the provided time, and
+// reports whether the caller is the one to send it: every udash computes the same
+// schedule, the first one to record the run sends it.
+func ClaimNotificationDigest(ctx context.Context, name string, scheduledAt time.Time) (bool, error) {
+	tag, err := DB.Exec(ctx, `
+		INSERT INTO notification_digests (name, scheduled_at)
+		VALUES ($1, $2)
+		ON CONFLICT (name, scheduled_at) DO NOTHING`,
+		name, scheduledAt.UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("claiming the %s digest of %s: %w", name, scheduledAt.UTC().Format(time.RFC3339), err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// RecordNotificationDigest records the outcome of sending a digest claimed by
+// ClaimNotificationDigest, sent unless errorMessage is set.
+func RecordNotificationDigest(ctx context.Context, name string, scheduledAt time.Time, errorMessage string) error {
+	status := DigestSent
+	if errorMessage != "" {
+		status = DigestFailed
+	}
+
+	_, err := DB.Exec(ctx, `
+		UPDATE notification_digests
+		SET status = $3, error = $4, sent_at = CASE WHEN $3 = $5 THEN now() END
+		WHERE name = $1 AND scheduled_at = $2`,
+		name, scheduledAt.UTC(), status, errorMessage, DigestSent,
+	)
+	if err != nil {
+		return fmt.Errorf("recording the %s digest of %s: %w", name, scheduledAt.UTC().Format(time.RFC3339), err)
+	}
+
+	return nil
+}
+
+// PruneNotificationDigests deletes the digest runs older than the provided duration, and
+// returns how many.
+func PruneNotificationDigests(ctx context.Context, olderThan time.Duration) (int64, error) {
+	tag, err := DB.Exec(ctx,
+		"DELETE FROM notification_digests WHERE created_at < now() - make_interval(secs => $1)",
+		olderThan.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("pruning notification digests: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// OpenedAction is an action, such as a pull request, opened by a pipeline.
+type OpenedAction struct {
+	PipelineID   string
+	PipelineName string
+	URL          string
+}
+
+// SearchOpenedActionsParams contains the filters of SearchOpenedActions.
+type SearchOpenedActionsParams struct {
+	// Start and End define the time range the actions were opened in.
+	Start time.Time
+	End   time.Time
+	// Labels restricts the search to the pipelines matching those labels.
+	Labels map[string]string
+}
+
+// SearchOpenedActions returns the actions left open by the latest report of every pipeline
+// within a time range, which its latest report before that range did not carry yet.
+func SearchOpenedActions(ctx context.Context, params SearchOpenedActionsParams) ([]OpenedAction, error) {
+	start, end := params.Start.UTC(), params.End.UTC()
+
+	// The action URLs are read with the same jsonpath as openActionSQLExpr.
+	query := psql.Select(
+		sm.Distinct("pipeline_id"),
+		sm.Columns("pipeline_id", "pipeline_name", "jsonb_path_query_array(data, '$.Actions.*.actionUrl')"),
+		sm.From("pipelineReports"),
+		sm.Where(psql.Raw("pipeline_id <> '' AND updated_at >= ? AND updated_at < ?", start, end)),
+		sm.Where(psql.Raw(openActionSQLExpr)),
+		sm.OrderBy("pipeline_id"),
+		sm.OrderBy(psql.Quote("updated_at")).Desc(),
+	)
+
+	if err := applyLabelFilter(labelFilterParams{
+		Ctx:    ctx,
+		Query:  &query,
+		Labels: params.Labels,
+	}); err != nil {
+		return nil, fmt.Errorf("applying label filter: %w", err)
+	}
+
+	queryString, args, err := query.Build(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
+	}
+
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying the actions of the pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	latest := []OpenedAction{}
+	pipelineIDs := []string{}
+
+	for rows.Next() {
+		pipelineID, pipelineName := "", ""
+		links := []string{}
+		if err := rows.Scan(&pipelineID, &pipelineName, &links); err != nil {
+			return nil, fmt.Errorf("parsing the actions of a pipeline: %w", err)
+		}
+
+		pipelineIDs = append(pipelineIDs, pipelineID)
+		for _, link := range links {
+			latest = append(latest, OpenedAction{PipelineID: pipelineID, PipelineName: pipelineName, URL: link})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading the actions of the pipelines: %w", err)
+	}
+
+	if len(latest) == 0 {
+		return latest, nil
+	}
+
+	// idx_pipelinereports_pipeline_id_updated_at makes this a single index scan per pipeline.
+	rows, err = readDB(ctx).Query(ctx, `
+		SELECT DISTINCT ON (pipeline_id) pipeline_id, jsonb_path_query_array(data, '$.Actions.*.actionUrl')
+		FROM pipelineReports
+		WHERE pipeline_id = ANY($1) AND updated_at < $2
+		ORDER BY pipeline_id, updated_at DESC`,
+		pipelineIDs, start,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying the previous actions of the pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	previous := map[string][]string{}
+	for rows.Next() {
+		pipelineID := ""
+		links := []string{}
+		if err := rows.Scan(&pipelineID, &links); err != nil {
+			return nil, fmt.Errorf("parsing the previous actions of a pipeline: %w", err)
+		}
+
+		previous[pipelineID] = links
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading the previous actions of the pipelines: %w", err)
+	}
+
+	return slices.DeleteFunc(latest, func(a OpenedAction) bool {
+		return slices.Contains(previous[a.PipelineID], a.URL)
+	}), nil
+}
+
+// StalePipeline is a pipeline which has not reported for a while.
+type StalePipeline struct {
+	ID     string
+	Name   string
+	Result string
+	// LastReportAt is when the latest report of the pipeline was published.
+	LastReportAt time.Time
+	// Interval is the reporting interval of the pipeline, zero when it has none and
+	// SearchStalePipelinesParams.StaleAfter applies instead.
+	Interval time.Duration
+}
+
+// SearchStalePipelinesParams contains the filters of SearchStalePipelines.
+type SearchStalePipelinesParams struct {
+	// StaleAfter is how long a pipeline without any reporting interval may go without
+	// reporting.
+	StaleAfter time.Duration
+	// Labels restricts the search to the pipelines matching those labels.
+	Labels map[string]string
+}
+
+// SearchStalePipelines returns the pipelines whose latest report is older than their
+// reporting interval, as staleSQL tells them, or than params.StaleAfter for the ones
+// without any, the longest silent first.
+func SearchStalePipelines(ctx context.Context, params SearchStalePipelinesParams) ([]StalePipeline, error) {
+	// The age is computed by the database, see readFleetSnapshot.
+	query := psql.Select(
+		sm.Distinct("pipeline_id"),
+		sm.Columns(
+			"pipeline_id",
+			"pipeline_name",
+			"pipeline_result",
+			"EXTRACT(EPOCH FROM (localtimestamp - updated_at))::float8",
+			expectedIntervalSQL("pipelineReports", payloadLabelsSQL("pipelineReports")),
+		),
+		sm.From("pipelineReports"),
+		sm.Where(psql.Raw("pipeline_id <> ''")),
+		sm.OrderBy("pipeline_id"),
+		sm.OrderBy(psql.Quote("updated_at")).Desc(),
+	)
+
+	if err := applyLabelFilter(labelFilterParams{
+		Ctx:    ctx,
+		Query:  &query,
+		Labels: params.Labels,
+	}); err != nil {
+		return nil, fmt.Errorf("applying label filter: %w", err)
+	}
+
+	queryString, args, err := query.Build(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
+	}
+
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying the latest report of every pipeline: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	stale := []StalePipeline{}
+
+	for rows.Next() {
+		p := StalePipeline{}
+		age := 0.0
+		var intervalSeconds *int64
+		if err := rows.Scan(&p.ID, &p.Name, &p.Result, &age, &intervalSeconds); err != nil {
+			return nil, fmt.Errorf("parsing the latest report of a pipeline: %w", err)
+		}
+
+		staleAfter := params.StaleAfter
+		if intervalSeconds != nil {
+			p.Interval = time.Duration(*intervalSeconds) * time.Second
+			staleAfter = p.Interval
+		}
+
+		ageDuration := time.Duration(age * float64(time.Second))
+		if ageDuration <= staleAfter {
+			continue
+		}
+
+		p.LastReportAt = now.Add(-ageDuration)
+		stale = append(stale, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading the latest report of every pipeline: %w", err)
+	}
+
+	slices.SortFunc(stale, func(a, b StalePipeline) int {
+		return a.LastReportAt.Compare(b.LastReportAt)
+	})
+
+	return stale, nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+)
+
+// FeedEntry is a change of a pipeline, told by the report which brought it.
+type FeedEntry struct {
+	// ReportID is the id of the report, which identifies the entry.
+	ReportID     string
+	PipelineID   string
+	PipelineName string
+	// Result is the result of the report, and PreviousResult the one of the report of the
+	// pipeline before it.
+	Result         string
+	PreviousResult string
+	// NewActionURLs are the actions the report carries which the previous one did not.
+	NewActionURLs []string
+	// ReportURL is the url of the report on the Updatecli side, if any.
+	ReportURL string
+	UpdatedAt time.Time
+}
+
+// SearchFeedEntriesParams contains the filters of SearchFeedEntries.
+type SearchFeedEntriesParams struct {
+	// Labels restricts the entries to the reports which carry every one of them, with the
+	// same value.
+	Labels map[string]string
+	// ScmID restricts the entries to the reports targeting that scm.
+	ScmID string
+	// Days restricts the entries to the reports published over that many days, zero does
+	// not filter anything out.
+	Days int
+	// Limit is the maximum number of entries to return.
+	Limit int
+}
+
+// SearchFeedEntries returns the reports which changed the result of their pipeline, or
+// opened a new action, latest first. As for the notifications, the first report of a
+// pipeline is not a change.
+func SearchFeedEntries(ctx context.Context, params SearchFeedEntriesParams) ([]FeedEntry, error) {
+	// The action URLs are read with the same jsonpath as openActionSQLExpr.
+	reports := psql.Select(
+		sm.Columns(
+			"id",
+			"pipeline_id",
+			"pipeline_name",
+			"pipeline_result",
+			"jsonb_path_query_array(data, '$.Actions.*.actionUrl') AS action_urls",
+			"COALESCE(data ->> 'ReportURL', '') AS report_url",
+			"updated_at",
+		),
+		sm.From("pipelineReports"),
+		sm.Where(psql.Raw("pipeline_id <> ''")),
+	)
+
+	// The labels are matched against the payload, as the acknowledgements are, so that an
+	// unknown label matches no report rather than failing.
+	if len(params.Labels) > 0 {
+		reports.Apply(sm.Where(psql.Raw("data -> 'Labels' @> ?::jsonb", psql.Arg(params.Labels))))
+	}
+
+	if params.ScmID != "" {
+		reports.Apply(sm.Where(psql.Raw("target_db_scm_ids && ?", psql.Arg(fmt.Sprintf("{%s}", params.ScmID)))))
+	}
+
+	if err := applyRangeFilter("updated_at", dateRangeFilterParams{
+		Query:         &reports,
+		DateRangeDays: params.Days,
+	}); err != nil {
+		return nil, fmt.Errorf("applying updated_at range filter: %w", err)
+	}
+
+	// idx_pipelinereports_pipeline_id_updated_at makes the previous report of every report a
+	// single index scan. The first report of a pipeline has none, the join drops it.
+	query := psql.Select(
+		sm.With("reports").As(reports),
+		sm.Columns(
+			"reports.id::text",
+			"reports.pipeline_id",
+			"reports.pipeline_name",
+			"reports.pipeline_result",
+			"previous.pipeline_result",
+			"reports.action_urls",
+			"previous.action_urls",
+			"reports.report_url",
+			"reports.updated_at",
+		),
+		sm.From(psql.Raw(`reports CROSS JOIN LATERAL (
+			SELECT pipeline_result, jsonb_path_query_array(data, '$.Actions.*.actionUrl') AS action_urls
+			FROM pipelineReports
+			WHERE pipeline_id = reports.pipeline_id AND (updated_at, id) < (reports.updated_at, reports.id)
+			ORDER BY updated_at DESC, id DESC
+			LIMIT 1
+		) AS previous`)),
+		sm.Where(psql.Raw(`reports.pipeline_result <> previous.pipeline_result OR EXISTS (
+			SELECT 1 FROM jsonb_array_elements(reports.action_urls) AS action(url)
+			WHERE NOT previous.action_urls @> jsonb_build_array(action.url)
+		)`)),
+		sm.OrderBy("reports.updated_at").Desc(),
+		sm.OrderBy("reports.id").Desc(),
+		sm.Limit(params.Limit),
+	)
+
+	queryString, args, err := query.Build(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
+	}
+
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying the changes of the pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []FeedEntry{}
+
+	for rows.Next() {
+		e := FeedEntry{NewActionURLs: []string{}}
+		actionURLs, previousActionURLs := []string{}, []string{}
+
+		if err := rows.Scan(
+			&e.ReportID,
+			&e.PipelineID,
+			&e.PipelineName,
+			&e.Result,
+			&e.PreviousResult,
+			&actionURLs,
+			&previousActionURLs,
+			&e.ReportURL,
+			&e.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("parsing the changes of a pipeline: %w", err)
+		}
+
+		for _, link := range actionURLs {
+			if !slices.Contains(previousActionURLs, link) {
+				e.NewActionURLs = append(e.NewActionURLs, link)
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading the changes of the pipelines: %w", err)
+	}
+
+	return entries, nil
+}
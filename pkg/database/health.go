@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationTableName is the table golang-migrate records the schema version in.
+const migrationTableName = "schema_migrations"
+
+// ErrNotConnected is returned when the database is used before Connect succeeded.
+var ErrNotConnected = errors.New("database not connected")
+
+// Ping acquires a connection from the pool and checks it is alive, which is what every
+// request needs to be served.
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return ErrNotConnected
+	}
+
+	conn, err := DB.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring a connection: %w", err)
+	}
+	defer conn.Release()
+
+	return conn.Ping(ctx)
+}
+
+// SchemaVersion returns the migration version the database schema is at, and whether the
+// migration to it failed halfway. A database no migration ever ran on is at version 0.
+func SchemaVersion(ctx context.Context) (uint, bool, error) {
+	if DB == nil {
+		return 0, false, ErrNotConnected
+	}
+
+	// The table is looked up first rather than relying on the error of a query against a
+	// missing table, which would also abort any transaction this ran in.
+	exists := false
+	if err := DB.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", migrationTableName).Scan(&exists); err != nil {
+		return 0, false, fmt.Errorf("looking up the migration table: %w", err)
+	}
+
+	if !exists {
+		return 0, false, nil
+	}
+
+	var version int64
+	dirty := false
+
+	err := DB.QueryRow(ctx, "SELECT version, dirty FROM "+migrationTableName+" LIMIT 1").Scan(&version, &dirty)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return 0, false, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("reading the schema version: %w", err)
+	}
+
+	return uint(version), dirty, nil
+}
+
+// ExpectedSchemaVersion returns the version of the latest migration embedded in the binary,
+// which is the version the schema must be at for every query to work.
+var ExpectedSchemaVersion = sync.OnceValues(func() (uint, error) {
+	migrations, err := EmbeddedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+})
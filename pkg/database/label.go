@@ -26,7 +26,7 @@ func InsertLabel(ctx context.Context, key, value string) (string, error) {
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return "", err
 	}
 
@@ -36,7 +36,7 @@ func InsertLabel(ctx context.Context, key, value string) (string, error) {
 	)
 
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return "", err
 	}
 
@@ -68,14 +68,14 @@ func GetLabelKeyOnlyRecords(ctx context.Context, startTime, endTime string, limi
 	totalQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
 	totalQueryString, totalArgs, err := totalQuery.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
+		logrus.WithContext(ctx).Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
 		return nil, 0, err
 	}
 
-	if err = DB.QueryRow(ctx, totalQueryString, totalArgs...).Scan(
+	if err = readDB(ctx).QueryRow(ctx, totalQueryString, totalArgs...).Scan(
 		&totalCount,
 	); err != nil {
-		logrus.Errorf("parsing total count result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing total count result: %s", err)
 	}
 
 	applyPagination(&query, limit, page)
@@ -83,13 +83,13 @@ func GetLabelKeyOnlyRecords(ctx context.Context, startTime, endTime string, limi
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 
-	rows, err := DB.Query(ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 	if err != nil {
-		logrus.Errorf("query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 	defer rows.Close()
@@ -101,7 +101,7 @@ func GetLabelKeyOnlyRecords(ctx context.Context, startTime, endTime string, limi
 
 		err = rows.Scan(&r.ID, &r.Key, &r.CreatedAt, &r.UpdatedAt, &r.LastPipelineReportAt)
 		if err != nil {
-			logrus.Errorf("scanning label row failed: %s", err)
+			logrus.WithContext(ctx).Errorf("scanning label row failed: %s", err)
 			continue
 		}
 
@@ -109,7 +109,7 @@ func GetLabelKeyOnlyRecords(ctx context.Context, startTime, endTime string, limi
 	}
 
 	if err := rows.Err(); err != nil {
-		logrus.Errorf("iterating label rows failed: %s", err)
+		logrus.WithContext(ctx).Errorf("iterating label rows failed: %s", err)
 		return nil, 0, err
 	}
 
@@ -158,14 +158,14 @@ func GetLabelRecords(ctx context.Context, id, key, value, startTime, endTime str
 	totalQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
 	totalQueryString, totalArgs, err := totalQuery.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
+		logrus.WithContext(ctx).Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
 		return nil, 0, err
 	}
 
-	if err = DB.QueryRow(ctx, totalQueryString, totalArgs...).Scan(
+	if err = readDB(ctx).QueryRow(ctx, totalQueryString, totalArgs...).Scan(
 		&totalCount,
 	); err != nil {
-		logrus.Errorf("parsing total count result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing total count result: %s", err)
 	}
 
 	applyPagination(&query, limit, page)
@@ -173,13 +173,13 @@ func GetLabelRecords(ctx context.Context, id, key, value, startTime, endTime str
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 
-	rows, err := DB.Query(ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 	if err != nil {
-		logrus.Errorf("query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 	defer rows.Close()
@@ -191,7 +191,7 @@ func GetLabelRecords(ctx context.Context, id, key, value, startTime, endTime str
 
 		err = rows.Scan(&r.ID, &r.Key, &r.Value, &r.CreatedAt, &r.UpdatedAt, &r.LastPipelineReportAt)
 		if err != nil {
-			logrus.Errorf("scanning label row failed: %s", err)
+			logrus.WithContext(ctx).Errorf("scanning label row failed: %s", err)
 			continue
 		}
 
@@ -199,7 +199,7 @@ func GetLabelRecords(ctx context.Context, id, key, value, startTime, endTime str
 	}
 
 	if err := rows.Err(); err != nil {
-		logrus.Errorf("iterating label rows failed: %s", err)
+		logrus.WithContext(ctx).Errorf("iterating label rows failed: %s", err)
 		return nil, 0, err
 	}
 
@@ -208,6 +208,9 @@ func GetLabelRecords(ctx context.Context, id, key, value, startTime, endTime str
 
 // InitLabels takes a map of labels and ensures that they exist in the database, creating them if necessary.
 func InitLabels(ctx context.Context, labels map[string]string) ([]uuid.UUID, error) {
+	// The labels are looked up before being inserted, on the primary, see InsertReport.
+	ctx = WithPrimary(ctx)
+
 	errs := []error{}
 	labelIDs := []uuid.UUID{}
 
@@ -250,14 +253,14 @@ func InitLabels(ctx context.Context, labels map[string]string) ([]uuid.UUID, err
 			}
 		default:
 			errMsg := fmt.Errorf("something went wrong multiple labels found for key %s", labelKey)
-			logrus.Error(errMsg)
+			logrus.WithContext(ctx).Error(errMsg)
 			errs = append(errs, errMsg)
 		}
 	}
 
 	if len(errs) > 0 {
 		for i := range errs {
-			logrus.Errorln(errs[i])
+			logrus.WithContext(ctx).Errorln(errs[i])
 		}
 		return nil, fmt.Errorf("something went wrong during label creation")
 	}
@@ -0,0 +1,383 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// metricsNamespace prefixes every metric udash exposes.
+	metricsNamespace = "udash"
+	// fleetMetricsTTL is how long the fleet metrics are served from memory. They are computed
+	// from the latest report of every pipeline, which is too expensive to run on every scrape,
+	// and several Prometheus replicas may scrape every few seconds.
+	fleetMetricsTTL = time.Minute
+	// fleetMetricsTimeout bounds how long a scrape may wait for the fleet queries.
+	fleetMetricsTimeout = 10 * time.Second
+)
+
+var (
+	reportsIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reports_ingested_total",
+		Help:      "Number of pipeline reports stored, per pipeline result.",
+	}, []string{"result"})
+
+	reportsIngestionFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reports_ingestion_failures_total",
+		Help:      "Number of pipeline reports which could not be stored.",
+	})
+
+	reportsIngestionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reports_ingestion_duration_seconds",
+		Help:      "Time taken to store a pipeline report, its scms, labels and resource configs included.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// IngestionCollectors returns the collectors counting the reports stored by InsertReport.
+// They are shared by every registry they are registered with.
+func IngestionCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		reportsIngested,
+		reportsIngestionFailures,
+		reportsIngestionDuration,
+	}
+}
+
+// observeIngestion records the outcome of an InsertReport call.
+func observeIngestion(start time.Time, result string, err error) {
+	reportsIngestionDuration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		reportsIngestionFailures.Inc()
+		return
+	}
+
+	reportsIngested.WithLabelValues(summaryResultKey(result)).Inc()
+}
+
+// poolCollector exposes the statistics of the connection pool.
+//
+// The pool is read on every collect rather than when the collector is built, so that it can
+// be registered before Connect is called, and keeps reporting the right pool afterwards.
+type poolCollector struct {
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	newConnsCount        *prometheus.Desc
+}
+
+// NewPoolCollector returns a collector exposing the statistics of the connection pool.
+func NewPoolCollector() prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		acquiredConns:        desc("acquired_connections", "Number of connections currently in use."),
+		idleConns:            desc("idle_connections", "Number of connections currently idle."),
+		constructingConns:    desc("constructing_connections", "Number of connections being established."),
+		totalConns:           desc("total_connections", "Number of connections currently open."),
+		maxConns:             desc("max_connections", "Maximum number of connections the pool may open."),
+		acquireCount:         desc("acquires_total", "Number of connections acquired from the pool."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Total time spent waiting for a connection."),
+		emptyAcquireCount:    desc("empty_acquires_total", "Number of acquires which had to wait for a connection because none was idle."),
+		canceledAcquireCount: desc("canceled_acquires_total", "Number of acquires cancelled before a connection was available."),
+		newConnsCount:        desc("new_connections_total", "Number of connections opened."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.constructingConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquireCount
+	ch <- c.canceledAcquireCount
+	ch <- c.newConnsCount
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	if DB == nil {
+		return
+	}
+
+	stat := DB.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.newConnsCount, prometheus.CounterValue, float64(stat.NewConnsCount()))
+}
+
+// pipelineState is the latest report of a pipeline, as far as the fleet metrics go.
+type pipelineState struct {
+	ID     string
+	Name   string
+	Result string
+	// LastReport is when the latest report was stored.
+	LastReport time.Time
+	OpenAction bool
+	ScmIDs     []uuid.UUID
+}
+
+// scmKey identifies a scm in the fleet metrics. The url and branch are used rather than the
+// scm id: the scms table may hold the same repository more than once, and two series with
+// the same labels would make the whole scrape fail.
+type scmKey struct {
+	URL    string
+	Branch string
+}
+
+// fleetSnapshot holds the fleet metrics computed from the database at a point in time.
+type fleetSnapshot struct {
+	pipelines   []pipelineState
+	openActions map[scmKey]int
+	takenAt     time.Time
+}
+
+// fleetCollector exposes the state of every pipeline known to udash, as of its latest report.
+type fleetCollector struct {
+	staleAfter time.Duration
+
+	latestResult   *prometheus.Desc
+	lastReport     *prometheus.Desc
+	pipelines      *prometheus.Desc
+	notReported    *prometheus.Desc
+	scmOpenActions *prometheus.Desc
+	scrapeErrors   prometheus.Counter
+
+	mu       sync.Mutex
+	snapshot *fleetSnapshot
+}
+
+// NewFleetCollector returns a collector exposing the latest result of every pipeline, the
+// open actions per scm, and how many pipelines have not reported for longer than staleAfter.
+func NewFleetCollector(staleAfter time.Duration) prometheus.Collector {
+	return &fleetCollector{
+		staleAfter: staleAfter,
+		latestResult: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "pipeline", "latest_result"),
+			"Result of the latest report of a pipeline, always 1.",
+			[]string{"pipeline_id", "pipeline_name", "result"}, nil,
+		),
+		lastReport: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "pipeline", "last_report_timestamp_seconds"),
+			"Unix time of the latest report of a pipeline.",
+			[]string{"pipeline_id", "pipeline_name"}, nil,
+		),
+		pipelines: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "pipelines"),
+			"Number of pipelines, per result of their latest report.",
+			[]string{"result"}, nil,
+		),
+		notReported: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "pipelines_not_reported"),
+			"Number of pipelines which have not reported for longer than the configured duration.",
+			nil, prometheus.Labels{"after": staleAfter.String()},
+		),
+		scmOpenActions: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "scm", "open_actions"),
+			"Number of pipelines whose latest report left an action, such as a pull request, open on a scm.",
+			[]string{"url", "branch"}, nil,
+		),
+		scrapeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "fleet_metrics_errors_total",
+			Help:      "Number of times the fleet metrics could not be read from the database.",
+		}),
+	}
+}
+
+func (c *fleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.latestResult
+	ch <- c.lastReport
+	ch <- c.pipelines
+	ch <- c.notReported
+	ch <- c.scmOpenActions
+	c.scrapeErrors.Describe(ch)
+}
+
+func (c *fleetCollector) Collect(ch chan<- prometheus.Metric) {
+	defer c.scrapeErrors.Collect(ch)
+
+	snapshot := c.currentSnapshot()
+	if snapshot == nil {
+		return
+	}
+
+	perResult := map[string]int{}
+	notReported := 0
+	for _, p := range snapshot.pipelines {
+		result := summaryResultKey(p.Result)
+		perResult[result]++
+
+		if snapshot.takenAt.Sub(p.LastReport) > c.staleAfter {
+			notReported++
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.latestResult, prometheus.GaugeValue, 1, p.ID, p.Name, result)
+		ch <- prometheus.MustNewConstMetric(c.lastReport, prometheus.GaugeValue, float64(p.LastReport.Unix()), p.ID, p.Name)
+	}
+
+	for result, count := range perResult {
+		ch <- prometheus.MustNewConstMetric(c.pipelines, prometheus.GaugeValue, float64(count), result)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.notReported, prometheus.GaugeValue, float64(notReported))
+
+	for scm, count := range snapshot.openActions {
+		ch <- prometheus.MustNewConstMetric(c.scmOpenActions, prometheus.GaugeValue, float64(count), scm.URL, scm.Branch)
+	}
+}
+
+// currentSnapshot returns the fleet metrics, reading them again from the database once they
+// are older than fleetMetricsTTL. The previous snapshot keeps being served when that fails,
+// as a gap in the fleet metrics would fire every alert built on them.
+func (c *fleetCollector) currentSnapshot() *fleetSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.snapshot != nil && time.Since(c.snapshot.takenAt) < fleetMetricsTTL {
+		return c.snapshot
+	}
+
+	if DB == nil {
+		return c.snapshot
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fleetMetricsTimeout)
+	defer cancel()
+
+	snapshot, err := readFleetSnapshot(ctx)
+	if err != nil {
+		logrus.Errorf("reading the fleet metrics: %s", err)
+		c.scrapeErrors.Inc()
+		return c.snapshot
+	}
+
+	c.snapshot = snapshot
+
+	return c.snapshot
+}
+
+// readFleetSnapshot reads the latest report of every pipeline, and the scms they target.
+func readFleetSnapshot(ctx context.Context) (*fleetSnapshot, error) {
+	// idx_pipelinereports_pipeline_id_updated_at makes this a single index scan.
+	//
+	// updated_at is a timestamp without time zone, written by now() in the time zone of the
+	// session. Its age is therefore computed by the database, against the same clock, rather
+	// than by comparing it to the time of this process.
+	rows, err := DB.Query(ctx, `
+		SELECT DISTINCT ON (pipeline_id)
+			pipeline_id, pipeline_name, pipeline_result,
+			EXTRACT(EPOCH FROM (localtimestamp - updated_at))::float8,
+			`+openActionSQLExpr+`,
+			COALESCE(target_db_scm_ids, ARRAY[]::UUID[])
+		FROM pipelineReports
+		WHERE pipeline_id <> ''
+		ORDER BY pipeline_id, updated_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("querying the latest report of every pipeline: %w", err)
+	}
+	defer rows.Close()
+
+	snapshot := fleetSnapshot{
+		openActions: map[scmKey]int{},
+		takenAt:     time.Now(),
+	}
+
+	for rows.Next() {
+		p := pipelineState{}
+		age := 0.0
+		if err := rows.Scan(&p.ID, &p.Name, &p.Result, &age, &p.OpenAction, &p.ScmIDs); err != nil {
+			return nil, fmt.Errorf("parsing the latest report of a pipeline: %w", err)
+		}
+
+		p.LastReport = snapshot.takenAt.Add(-time.Duration(age * float64(time.Second)))
+
+		snapshot.pipelines = append(snapshot.pipelines, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading the latest report of every pipeline: %w", err)
+	}
+
+	scms, err := readScmKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range snapshot.pipelines {
+		// A pipeline may target the same scm from several targets, or through duplicated
+		// scm rows, it is still a single pipeline waiting on it.
+		seen := map[scmKey]bool{}
+		for _, id := range p.ScmIDs {
+			scm, ok := scms[id]
+			if !ok || seen[scm] {
+				continue
+			}
+			seen[scm] = true
+
+			// Every scm targeted by a latest report is exposed, at 0 when nothing is
+			// open, so that an alert on it resolves rather than goes stale.
+			if p.OpenAction {
+				snapshot.openActions[scm]++
+			} else if _, ok := snapshot.openActions[scm]; !ok {
+				snapshot.openActions[scm] = 0
+			}
+		}
+	}
+
+	return &snapshot, nil
+}
+
+// readScmKeys returns the url and branch of every scm, per scm id.
+func readScmKeys(ctx context.Context) (map[uuid.UUID]scmKey, error) {
+	rows, err := DB.Query(ctx, "SELECT id, url, branch FROM scms")
+	if err != nil {
+		return nil, fmt.Errorf("querying the scms: %w", err)
+	}
+	defer rows.Close()
+
+	scms := map[uuid.UUID]scmKey{}
+	for rows.Next() {
+		var id uuid.UUID
+		scm := scmKey{}
+		if err := rows.Scan(&id, &scm.URL, &scm.Branch); err != nil {
+			return nil, fmt.Errorf("parsing a scm: %w", err)
+		}
+
+		scms[id] = scm
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading the scms: %w", err)
+	}
+
+	return scms, nil
+}
@@ -0,0 +1,456 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// migrationLockID is the key of the advisory lock held while migrating, "udash" in ASCII.
+	migrationLockID int64 = 0x7564617368
+	// defaultMigrationTimeout is how long the migration lock, or the schema migrated by
+	// another udash, is waited for.
+	defaultMigrationTimeout = 5 * time.Minute
+	// migrationPollInterval is how often the lock, or the schema version, is checked again.
+	migrationPollInterval = time.Second
+)
+
+// ErrSchemaNewer is returned when the database schema was migrated by a newer udash, whose
+// queries this one cannot be trusted to run.
+var ErrSchemaNewer = errors.New("database schema newer than the embedded migrations")
+
+// migrationTimeout is the MigrationTimeout of the options the pool was created with.
+var migrationTimeout = defaultMigrationTimeout
+
+// Migration is a schema migration embedded in the binary.
+type Migration struct {
+	Version uint
+	Name    string
+}
+
+// MigrationStep is a migration to apply, or to revert, with its statements.
+type MigrationStep struct {
+	Migration
+	// Up is false when the migration is reverted.
+	Up  bool
+	SQL string
+}
+
+// MigrationStatus describes the schema of the database against the embedded migrations.
+type MigrationStatus struct {
+	// Version is the version of the schema, 0 when no migration ever ran.
+	Version uint
+	// Dirty is set when the migration to Version failed halfway, which must be fixed by hand
+	// before forcing the version the schema is actually at.
+	Dirty bool
+	// Pending are the embedded migrations not applied yet.
+	Pending []Migration
+}
+
+// migrateLogger reports the progress of golang-migrate.
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...any) {
+	logrus.Infof(format, v...)
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
+
+func newMigrationSource() (source.Driver, error) {
+	d, err := iofs.New(fs, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	return d, nil
+}
+
+// newMigrate returns the golang-migrate instance applying the embedded migrations to the
+// database of URI. It must be closed.
+func newMigrate() (*migrate.Migrate, error) {
+	d, err := newMigrationSource()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", d, URI)
+	if err != nil {
+		return nil, fmt.Errorf("loading migration: %w", err)
+	}
+	m.Log = migrateLogger{}
+
+	return m, nil
+}
+
+func closeMigrate(m *migrate.Migrate) {
+	sourceErr, databaseErr := m.Close()
+	if err := errors.Join(sourceErr, databaseErr); err != nil {
+		logrus.Warnf("closing migration: %s", err)
+	}
+}
+
+// withMigrationLock runs f holding the migration lock, so that the replicas of udash starting
+// together do not migrate the schema at the same time. The lock is waited for up to the
+// migration timeout.
+//
+// It is held by a connection of its own rather than one of the pool: closing it releases the
+// lock whatever happened, where a pooled connection would be handed back still holding it.
+func withMigrationLock(ctx context.Context, f func() error) error {
+	if DB == nil {
+		return ErrNotConnected
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	conn, err := pgx.ConnectConfig(lockCtx, DB.Config().ConnConfig)
+	if err != nil {
+		return fmt.Errorf("connecting to acquire the migration lock: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	for attempt := 1; ; attempt++ {
+		locked := false
+		if err := conn.QueryRow(lockCtx, "SELECT pg_try_advisory_lock($1)", migrationLockID).Scan(&locked); err != nil {
+			if lockCtx.Err() != nil {
+				return fmt.Errorf("the migration lock is still held by another udash after %s", migrationTimeout)
+			}
+			return fmt.Errorf("acquiring the migration lock: %w", err)
+		}
+
+		if locked {
+			break
+		}
+
+		if attempt == 1 {
+			logrus.WithContext(ctx).Infoln("Waiting for another udash to complete the database migration")
+		}
+
+		select {
+		case <-lockCtx.Done():
+			return fmt.Errorf("the migration lock is still held by another udash after %s", migrationTimeout)
+		case <-time.After(migrationPollInterval):
+		}
+	}
+
+	return f()
+}
+
+// checkSchemaNotNewer returns ErrSchemaNewer when the database schema is at a version no
+// embedded migration has.
+func checkSchemaNotNewer(ctx context.Context) error {
+	version, _, err := SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected, err := ExpectedSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > expected {
+		return schemaNewerError(version, expected)
+	}
+
+	return nil
+}
+
+func schemaNewerError(version, expected uint) error {
+	return fmt.Errorf("%w: the schema is at version %d while this udash only knows up to version %d, upgrade udash",
+		ErrSchemaNewer, version, expected)
+}
+
+// RunMigrationUp applies every embedded migration not applied yet, holding the migration
+// lock. A replica which started along with another one waits for it to migrate, then finds
+// nothing left to do.
+func RunMigrationUp(ctx context.Context) error {
+	logrus.WithContext(ctx).Debugln("Running Database migration")
+
+	return withMigrationLock(ctx, func() error {
+		if err := checkSchemaNotNewer(ctx); err != nil {
+			return err
+		}
+
+		m, err := newMigrate()
+		if err != nil {
+			return err
+		}
+		defer closeMigrate(m)
+
+		err = m.Up()
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("running migration: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// WaitForSchema waits up to the migration timeout for the schema to be at the version of
+// the embedded migrations, as migrated by another udash. It is what a udash whose
+// migrations are disabled does before serving.
+func WaitForSchema(ctx context.Context) error {
+	expected, err := ExpectedSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		version, dirty, err := SchemaVersion(ctx)
+
+		switch {
+		case err != nil && ctx.Err() == nil:
+			return err
+		case err != nil:
+			// The deadline passed while reading the version, reported below.
+		case version > expected:
+			return schemaNewerError(version, expected)
+		// The schema is dirty while a migration runs, it is waited for as well.
+		case version == expected && !dirty:
+			return nil
+		}
+
+		if attempt == 1 {
+			logrus.WithContext(ctx).Infof("Waiting for the database schema to be migrated from version %d to %d", version, expected)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the database schema is still at version %d, dirty: %t, after %s, expecting version %d",
+				version, dirty, migrationTimeout, expected)
+		case <-time.After(migrationPollInterval):
+		}
+	}
+}
+
+// MigrateTo applies or reverts the embedded migrations until the schema is at the provided
+// version, holding the migration lock. Version 0 reverts every migration.
+func MigrateTo(ctx context.Context, version uint) error {
+	return withMigrationLock(ctx, func() error {
+		m, err := newMigrate()
+		if err != nil {
+			return err
+		}
+		defer closeMigrate(m)
+
+		if version == 0 {
+			err = m.Down()
+		} else {
+			err = m.Migrate(version)
+		}
+
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("migrating to version %d: %w", version, err)
+		}
+
+		return nil
+	})
+}
+
+// ForceMigrationVersion records the provided version as the one of the schema, and clears
+// the dirty flag, without running any migration. It is how a migration which failed halfway
+// is recovered from, once the schema was fixed by hand. Version -1 records no version.
+func ForceMigrationVersion(ctx context.Context, version int) error {
+	if version < -1 {
+		return fmt.Errorf("invalid version %d", version)
+	}
+
+	if version > 0 {
+		if _, err := embeddedMigration(uint(version)); err != nil {
+			return err
+		}
+	}
+
+	return withMigrationLock(ctx, func() error {
+		m, err := newMigrate()
+		if err != nil {
+			return err
+		}
+		defer closeMigrate(m)
+
+		if err := m.Force(version); err != nil {
+			return fmt.Errorf("forcing version %d: %w", version, err)
+		}
+
+		return nil
+	})
+}
+
+// EmbeddedMigrations returns the migrations embedded in the binary, in the order they apply.
+func EmbeddedMigrations() ([]Migration, error) {
+	d, err := newMigrationSource()
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	migrations := []Migration{}
+
+	version, err := d.First()
+	if err != nil {
+		return nil, fmt.Errorf("reading the first migration: %w", err)
+	}
+
+	for {
+		r, name, err := d.ReadUp(version)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %d: %w", version, err)
+		}
+		r.Close()
+
+		migrations = append(migrations, Migration{Version: version, Name: name})
+
+		next, err := d.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return migrations, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("reading the migration following %d: %w", version, err)
+		}
+
+		version = next
+	}
+}
+
+// embeddedMigration returns the embedded migration of the provided version.
+func embeddedMigration(version uint) (Migration, error) {
+	migrations, err := EmbeddedMigrations()
+	if err != nil {
+		return Migration{}, err
+	}
+
+	for _, m := range migrations {
+		if m.Version == version {
+			return m, nil
+		}
+	}
+
+	return Migration{}, fmt.Errorf("no embedded migration has version %d", version)
+}
+
+// GetMigrationStatus returns the version of the schema and the migrations pending.
+func GetMigrationStatus(ctx context.Context) (MigrationStatus, error) {
+	version, dirty, err := SchemaVersion(ctx)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	migrations, err := EmbeddedMigrations()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{
+		Version: version,
+		Dirty:   dirty,
+		Pending: []Migration{},
+	}
+
+	for _, m := range migrations {
+		if m.Version > version {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+
+	return status, nil
+}
+
+// PlanMigration returns the migrations MigrateTo would apply, or revert, to bring the schema
+// from its current version to the provided one, in the order they would run.
+func PlanMigration(ctx context.Context, version uint) ([]MigrationStep, error) {
+	status, err := GetMigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Dirty {
+		return nil, fmt.Errorf("the migration to version %d failed halfway, fix the schema then force its version", status.Version)
+	}
+
+	if version != 0 {
+		if _, err := embeddedMigration(version); err != nil {
+			return nil, err
+		}
+	}
+
+	migrations, err := EmbeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newMigrationSource()
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	steps := []MigrationStep{}
+
+	if version >= status.Version {
+		for _, m := range migrations {
+			if m.Version <= status.Version || m.Version > version {
+				continue
+			}
+
+			step, err := readMigrationStep(d, m, true)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+
+		return steps, nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > status.Version || m.Version <= version {
+			continue
+		}
+
+		step, err := readMigrationStep(d, m, false)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+func readMigrationStep(d source.Driver, m Migration, up bool) (MigrationStep, error) {
+	read := d.ReadDown
+	if up {
+		read = d.ReadUp
+	}
+
+	r, _, err := read(m.Version)
+	if err != nil {
+		return MigrationStep{}, fmt.Errorf("reading migration %d: %w", m.Version, err)
+	}
+	defer r.Close()
+
+	sql, err := io.ReadAll(r)
+	if err != nil {
+		return MigrationStep{}, fmt.Errorf("reading migration %d: %w", m.Version, err)
+	}
+
+	return MigrationStep{Migration: m, Up: up, SQL: string(sql)}, nil
+}
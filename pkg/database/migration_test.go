@@ -0,0 +1,32 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := EmbeddedMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Name, "migration %d", m.Version)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+
+	expected, err := ExpectedSchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, migrations[len(migrations)-1].Version, expected)
+
+	m, err := embeddedMigration(1)
+	require.NoError(t, err)
+	assert.Equal(t, "create_pipelineReports_tables", m.Name)
+
+	_, err = embeddedMigration(expected + 1)
+	assert.Error(t, err)
+}
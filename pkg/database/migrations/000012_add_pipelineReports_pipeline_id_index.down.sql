@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_pipelinereports_pipeline_id_updated_at;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- The fleet metrics read the latest report of every pipeline, and the reports of a pipeline
+-- are looked up by pipeline_id, latest first, by SearchLatestReportByPipelineID. Neither had
+-- an index to use and both scanned the whole table.
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_pipelinereports_pipeline_id_updated_at
+ON pipelineReports (pipeline_id, updated_at DESC);
+
+COMMIT;
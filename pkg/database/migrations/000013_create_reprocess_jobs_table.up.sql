@@ -0,0 +1,30 @@
+-- A reprocessing job recomputes the columns of the stored reports denormalized from their
+-- payload, once the code extracting them changed. It runs in the background of a live
+-- instance, a batch of reports at a time, and records the id of the last report it
+-- processed: the reports are processed in the order of their id, so that a job interrupted
+-- by a restart resumes where it stopped, on whichever replica claims it.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS reprocess_jobs (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    status text NOT NULL DEFAULT 'pending',
+    start_time text NOT NULL DEFAULT '',
+    end_time text NOT NULL DEFAULT '',
+    labels jsonb NOT NULL DEFAULT '{}',
+    batch_size integer NOT NULL,
+    batch_delay_ms integer NOT NULL,
+    last_report_id uuid,
+    total integer NOT NULL DEFAULT 0,
+    processed integer NOT NULL DEFAULT 0,
+    updated integer NOT NULL DEFAULT 0,
+    failed integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    heartbeat_at timestamp,
+    created_at timestamp NOT NULL DEFAULT now(),
+    updated_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reprocess_jobs_status_created_at
+ON reprocess_jobs (status, created_at);
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- A notification delivery is a webhook sent, or to be sent, to the endpoint of a
+-- notification rule. The deliveries are recorded before being sent, so that the retries of
+-- a failing endpoint survive a restart and are spread across the replicas, and kept
+-- afterwards as the log of what was sent.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    rule text NOT NULL,
+    event text NOT NULL,
+    pipeline_id text NOT NULL DEFAULT '',
+    report_id uuid,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    response_status integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    next_attempt_at timestamp NOT NULL DEFAULT now(),
+    delivered_at timestamp,
+    created_at timestamp NOT NULL DEFAULT now(),
+    updated_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_status_next_attempt_at
+ON notification_deliveries (status, next_attempt_at);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_created_at
+ON notification_deliveries (created_at);
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- A notification digest run records a scheduled digest email. Every replica computes the
+-- same schedule, the first one recording a run sends it and the others skip it.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS notification_digests (
+    name text NOT NULL,
+    scheduled_at timestamp NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    error text NOT NULL DEFAULT '',
+    sent_at timestamp,
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (name, scheduled_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_digests_created_at
+ON notification_digests (created_at);
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- An acknowledgement mutes a pipeline whose failure is known and accepted, selected either
+-- by its id or by its labels. It is surfaced on the reports and the scm summaries, keeps
+-- the pipeline out of the notifications, and may be left out of the reports summary.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS acknowledgements (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pipeline_id text NOT NULL DEFAULT '',
+    labels jsonb NOT NULL DEFAULT '{}',
+    reason text NOT NULL,
+    author text NOT NULL,
+    expires_at timestamp,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_acknowledgements_pipeline_id
+ON acknowledgements (pipeline_id);
+
+COMMIT;
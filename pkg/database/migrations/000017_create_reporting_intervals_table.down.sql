@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS stale_pipelines;
+DROP TABLE IF EXISTS reporting_intervals;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- A reporting interval is how often a pipeline, or the pipelines carrying some labels, or
+-- else every pipeline, is expected to publish a report. A pipeline whose latest report is
+-- older than its interval is stale: its CI job stopped running Updatecli, and its latest
+-- result no longer tells anything.
+--
+-- The stale pipelines notified are recorded along with their latest report, so that a
+-- pipeline is notified once whichever replica finds it, and again once it reported and
+-- went stale anew.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS reporting_intervals (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pipeline_id text NOT NULL DEFAULT '',
+    labels jsonb NOT NULL DEFAULT '{}',
+    interval_seconds integer NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reporting_intervals_pipeline_id
+ON reporting_intervals (pipeline_id);
+
+CREATE TABLE IF NOT EXISTS stale_pipelines (
+    pipeline_id text PRIMARY KEY,
+    report_id uuid NOT NULL,
+    notified_at timestamp NOT NULL DEFAULT now()
+);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_pipelinereports_created_at_id;
+
+COMMIT;
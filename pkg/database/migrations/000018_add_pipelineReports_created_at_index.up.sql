@@ -0,0 +1,9 @@
+-- The reports stream resumes after the last report a client received, replaying the reports
+-- inserted since in the order they were inserted. Without an index on that order, every
+-- reconnection scanned the whole table.
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_pipelinereports_created_at_id
+ON pipelineReports (created_at, id);
+
+COMMIT;
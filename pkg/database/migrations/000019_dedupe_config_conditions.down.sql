@@ -0,0 +1,5 @@
+-- Nothing is reverted: the duplicated condition configs carried nothing the one they were
+-- merged into does not.
+BEGIN;
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- The condition configs were looked up among the targets before they were resolved in
+-- their own table, so that an identical condition config was inserted for every report.
+-- The duplicates are merged into the one a report resolves today, the most recently
+-- updated, and the reports referring to them are pointed at it.
+BEGIN;
+
+CREATE TEMPORARY TABLE config_condition_duplicates ON COMMIT DROP AS
+SELECT duplicate.id, kept.id AS kept_id
+FROM config_conditions duplicate
+JOIN (
+    SELECT DISTINCT ON (kind, config) id, kind, config
+    FROM config_conditions
+    ORDER BY kind, config, updated_at DESC, id
+) kept ON kept.kind = duplicate.kind AND kept.config = duplicate.config AND kept.id <> duplicate.id;
+
+UPDATE pipelineReports
+SET config_condition_ids = (
+    SELECT hstore(array_agg(COALESCE(d.kept_id::text, e.key)), array_agg(e.value))
+    FROM each(pipelineReports.config_condition_ids) e
+    LEFT JOIN config_condition_duplicates d ON d.id::text = e.key
+)
+WHERE config_condition_ids ?| (SELECT array_agg(id::text) FROM config_condition_duplicates);
+
+DELETE FROM config_conditions
+WHERE id IN (SELECT id FROM config_condition_duplicates);
+
+COMMIT;
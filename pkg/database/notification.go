@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+)
+
+const (
+	// DeliveryPending is the status of a delivery waiting to be sent, or to be retried.
+	DeliveryPending = "pending"
+	// DeliveryDelivered is the status of a delivery accepted by its endpoint.
+	DeliveryDelivered = "delivered"
+	// DeliveryFailed is the status of a delivery given up on.
+	DeliveryFailed = "failed"
+
+	// defaultListedDeliveries is the number of deliveries listed by default.
+	defaultListedDeliveries = 50
+	// maxListedDeliveries caps the deliveries listed by ListNotificationDeliveries.
+	maxListedDeliveries = 500
+)
+
+// NotificationDelivery is a notification sent, or to be sent, to the endpoint of a rule.
+type NotificationDelivery struct {
+	ID uuid.UUID `json:"id"`
+	// Rule is the name of the notification rule the delivery was sent for.
+	Rule string `json:"rule"`
+	// Event is the kind of state change notified.
+	Event string `json:"event"`
+	// PipelineID and ReportID identify the report which changed the state of its pipeline,
+	// they are empty for a test delivery.
+	PipelineID string     `json:"pipeline_id,omitempty"`
+	ReportID   *uuid.UUID `json:"report_id,omitempty"`
+	// Payload is the body sent.
+	Payload json.RawMessage `json:"payload"`
+	Status  string          `json:"status"`
+	// Attempts is the number of times the delivery was sent. ResponseStatus and Error are
+	// the HTTP status and the error of the last attempt.
+	Attempts       int    `json:"attempts"`
+	ResponseStatus int    `json:"response_status,omitempty"`
+	Error          string `json:"error,omitempty"`
+	// NextAttemptAt is when a pending delivery is sent next.
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// NewNotificationDelivery describes a delivery to record.
+type NewNotificationDelivery struct {
+	Rule       string
+	Event      string
+	PipelineID string
+	// ReportID may be empty
+	ReportID string
+	Payload  []byte
+	// Lease claims the delivery for that long, as ClaimNotificationDeliveries does, for
+	// the caller sending it right away. A delivery without a lease is sent by whichever
+	// udash claims it first.
+	Lease time.Duration
+}
+
+// notificationDeliveryColumns are the columns scanned by scanNotificationDelivery, in its
+// order.
+const notificationDeliveryColumns = `id, rule, event, pipeline_id, report_id, payload, status, attempts,
+	response_status, error, next_attempt_at, delivered_at, created_at, updated_at`
+
+func scanNotificationDelivery(row pgx.Row) (NotificationDelivery, error) {
+	d := NotificationDelivery{}
+
+	err := row.Scan(
+		&d.ID,
+		&d.Rule,
+		&d.Event,
+		&d.PipelineID,
+		&d.ReportID,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.ResponseStatus,
+		&d.Error,
+		&d.NextAttemptAt,
+		&d.DeliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+
+	return d, err
+}
+
+// InsertNotificationDelivery records a delivery, due right away unless it is leased.
+func InsertNotificationDelivery(ctx context.Context, d NewNotificationDelivery) (NotificationDelivery, error) {
+	attempts := 0
+	if d.Lease > 0 {
+		attempts = 1
+	}
+
+	delivery, err := scanNotificationDelivery(DB.QueryRow(ctx, `
+		INSERT INTO notification_deliveries (rule, event, pipeline_id, report_id, payload, attempts, next_attempt_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, now() + make_interval(secs => $7))
+		RETURNING `+notificationDeliveryColumns,
+		d.Rule, d.Event, d.PipelineID, d.ReportID, d.Payload, attempts, d.Lease.Seconds(),
+	))
+	if err != nil {
+		return delivery, fmt.Errorf("recording notification delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// ClaimNotificationDeliveries returns up to limit deliveries due, counting an attempt for
+// each of them. They are leased for the provided duration: a delivery which is not
+// recorded by RecordNotificationAttempt by then, because the udash sending it stopped, is
+// due again.
+func ClaimNotificationDeliveries(ctx context.Context, limit int, lease time.Duration) ([]NotificationDelivery, error) {
+	rows, err := DB.Query(ctx, `
+		UPDATE notification_deliveries
+		SET attempts = attempts + 1, next_attempt_at = now() + make_interval(secs => $3), updated_at = now()
+		WHERE id IN (
+			SELECT id FROM notification_deliveries
+			WHERE status = $1 AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+notificationDeliveryColumns,
+		DeliveryPending, limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("claiming notification deliveries: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (NotificationDelivery, error) {
+		return scanNotificationDelivery(row)
+	})
+}
+
+// NotificationAttempt is the outcome of sending a delivery.
+type NotificationAttempt struct {
+	// ResponseStatus is the HTTP status answered by the endpoint, 0 when none answered.
+	ResponseStatus int
+	// Error is empty when the delivery was accepted.
+	Error string
+	// RetryIn is when a delivery which was not accepted is sent again, it is given up on
+	// when zero.
+	RetryIn time.Duration
+}
+
+// RecordNotificationAttempt records the outcome of sending a delivery claimed by
+// ClaimNotificationDeliveries, and returns the delivery as recorded.
+func RecordNotificationAttempt(ctx context.Context, id uuid.UUID, attempt NotificationAttempt) (NotificationDelivery, error) {
+	status := DeliveryDelivered
+	switch {
+	case attempt.Error == "":
+	case attempt.RetryIn > 0:
+		status = DeliveryPending
+	default:
+		status = DeliveryFailed
+	}
+
+	delivery, err := scanNotificationDelivery(DB.QueryRow(ctx, `
+		UPDATE notification_deliveries
+		SET status = $2, response_status = $3, error = $4,
+			next_attempt_at = now() + make_interval(secs => $5),
+			delivered_at = CASE WHEN $2 = $6 THEN now() END,
+			updated_at = now()
+		WHERE id = $1
+		RETURNING `+notificationDeliveryColumns,
+		id, status, attempt.ResponseStatus, attempt.Error, attempt.RetryIn.Seconds(), DeliveryDelivered,
+	))
+	if err != nil {
+		return delivery, fmt.Errorf("recording the attempt of notification delivery %s: %w", id, err)
+	}
+
+	return delivery, nil
+}
+
+// ListNotificationDeliveriesParams contains the filters of the delivery log.
+type ListNotificationDeliveriesParams struct {
+	// Rule restricts the log to the deliveries of a rule.
+	Rule string
+	// Status restricts the log to the deliveries of a status.
+	Status string
+	// Limit is the number of deliveries returned, 50 by default and at most 500.
+	Limit int
+}
+
+// ListNotificationDeliveries returns the latest deliveries, latest first.
+func ListNotificationDeliveries(ctx context.Context, params ListNotificationDeliveriesParams) ([]NotificationDelivery, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultListedDeliveries
+	}
+	limit = min(limit, maxListedDeliveries)
+
+	query := psql.Select(
+		sm.Columns(psql.Raw(notificationDeliveryColumns)),
+		sm.From("notification_deliveries"),
+		sm.OrderBy(psql.Quote("created_at")).Desc(),
+		sm.Limit(limit),
+	)
+
+	if params.Rule != "" {
+		query.Apply(sm.Where(psql.Quote("rule").EQ(psql.Arg(params.Rule))))
+	}
+
+	if params.Status != "" {
+		query.Apply(sm.Where(psql.Quote("status").EQ(psql.Arg(params.Status))))
+	}
+
+	queryString, args, err := query.Build(ctx)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
+		return nil, err
+	}
+
+	rows, err := DB.Query(ctx, queryString, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing notification deliveries: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (NotificationDelivery, error) {
+		return scanNotificationDelivery(row)
+	})
+}
+
+// PruneNotificationDeliveries deletes the deliveries which are no longer pending and are
+// older than the provided duration, and returns how many.
+func PruneNotificationDeliveries(ctx context.Context, olderThan time.Duration) (int64, error) {
+	tag, err := DB.Exec(ctx,
+		"DELETE FROM notification_deliveries WHERE status <> $1 AND created_at < now() - make_interval(secs => $2)",
+		DeliveryPending, olderThan.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("pruning notification deliveries: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ReplicaURIEnvVariableName is read when the options set no replica URI.
+	ReplicaURIEnvVariableName string = "UDASH_DB_REPLICA_URI"
+	// defaultReplicaMaxLag is how far behind the primary the replica may be before the
+	// searches fall back to the primary.
+	defaultReplicaMaxLag = 30 * time.Second
+	// replicaCheckInterval is how often the health and the lag of the replica are checked.
+	replicaCheckInterval = 10 * time.Second
+)
+
+// errReplicaNotStreaming tells the replica is in recovery without receiving the WAL of the
+// primary: it replayed everything it has, yet it may be any distance behind.
+var errReplicaNotStreaming = errors.New("read replica not streaming from the primary")
+
+// replica is the read replica the searches are routed to, nil when none is configured.
+var replica *replicaPool
+
+// replicaPool is a pool of connections to a read replica, checked in the background.
+type replicaPool struct {
+	pool   *pgxpool.Pool
+	maxLag time.Duration
+
+	// healthy is only set once the replica answered and was found caught up, so that the
+	// searches go to the primary until then.
+	healthy atomic.Bool
+	// checked is set once the replica was checked. Only the monitor reads and writes it.
+	checked bool
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func newReplicaPool(config *pgxpool.Config, maxLag time.Duration) (*replicaPool, error) {
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replica pgx pool: %w", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	r := &replicaPool{
+		pool:   pool,
+		maxLag: maxLag,
+		stop:   stop,
+		done:   make(chan struct{}),
+	}
+
+	go r.monitor(ctx)
+
+	return r, nil
+}
+
+// monitor checks the replica until ctx is cancelled.
+func (r *replicaPool) monitor(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		r.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check updates the health of the replica, logging whenever it changes.
+func (r *replicaPool) check(ctx context.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx, replicaCheckInterval)
+	lag, err := replicationLag(checkCtx, r.pool)
+	cancel()
+
+	if ctx.Err() != nil {
+		// Stopping, the pool is about to be closed.
+		return
+	}
+
+	healthy := err == nil && lag <= r.maxLag
+	wasHealthy := r.healthy.Swap(healthy)
+
+	// Only the changes are logged, and the outcome of the first check.
+	if r.checked && healthy == wasHealthy {
+		return
+	}
+	r.checked = true
+
+	switch {
+	case err != nil:
+		logrus.Warnf("read replica unhealthy, routing the searches to the primary: %s", err)
+	case !healthy:
+		logrus.Warnf("read replica %s behind, routing the searches to the primary", lag.Round(time.Second))
+	default:
+		logrus.Infof("read replica healthy, routing the searches to it")
+	}
+}
+
+// replicationLag returns how far behind the primary the replica is.
+//
+// The time since the last replayed transaction keeps growing while the primary is idle, so
+// a replica which replayed everything it received is considered caught up. That only holds
+// while it is receiving the WAL: a replica whose receiver is down replayed everything it
+// got before losing the primary, it is reported as not streaming instead. Reading the
+// status of the receiver requires the pg_read_all_stats role. A database which is not in
+// recovery, such as a pooler in front of the primary, has no lag.
+func replicationLag(ctx context.Context, pool *pgxpool.Pool) (time.Duration, error) {
+	var seconds float64
+	var streaming bool
+
+	err := pool.QueryRow(ctx, `
+		SELECT
+			CASE
+				WHEN NOT pg_is_in_recovery() THEN 0
+				WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM (now() - pg_last_xact_replay_timestamp())), 0)
+			END,
+			NOT pg_is_in_recovery() OR EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming')
+		`).Scan(&seconds, &streaming)
+	if err != nil {
+		return 0, err
+	}
+
+	if !streaming {
+		return 0, errReplicaNotStreaming
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (r *replicaPool) close() {
+	r.stop()
+	<-r.done
+	r.pool.Close()
+}
+
+type primaryKey struct{}
+
+// WithPrimary returns a copy of ctx whose searches read from the primary even when a
+// replica is healthy, so that a client reads what it has just written.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// IsPrimary reports whether the searches of ctx read from the primary, see WithPrimary.
+func IsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// readDB returns the pool the searches run on: the replica when one is configured, healthy
+// and not bypassed by WithPrimary, the primary otherwise.
+func readDB(ctx context.Context) *pgxpool.Pool {
+	if replica == nil || !replica.healthy.Load() {
+		return DB
+	}
+
+	if IsPrimary(ctx) {
+		return DB
+	}
+
+	return replica.pool
+}
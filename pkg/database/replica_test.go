@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDB(t *testing.T) {
+	defer func(db *pgxpool.Pool, r *replicaPool) { DB, replica = db, r }(DB, replica)
+
+	DB = &pgxpool.Pool{}
+	ctx := context.Background()
+
+	replica = nil
+	assert.Same(t, DB, readDB(ctx), "no replica")
+
+	replica = &replicaPool{pool: &pgxpool.Pool{}}
+	assert.Same(t, DB, readDB(ctx), "replica not checked yet")
+
+	replica.healthy.Store(true)
+	assert.Same(t, replica.pool, readDB(ctx), "healthy replica")
+	assert.Same(t, DB, readDB(WithPrimary(ctx)), "read your writes")
+}
@@ -2,10 +2,8 @@ package database
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -30,8 +28,9 @@ type SearchLatestReportData struct {
 	Name string
 	// Result represents the result of the report.
 	Result string
-	// Report contains the report data.
-	Report reports.Report
+	// Report contains the report data, left empty when the payload is excluded from the
+	// search, see SearchLatestReportsParams.ExcludePayload.
+	Report reports.Report `json:",omitzero"`
 	// FilteredResourceID contains the resource config ID that was filtered
 	// It allows to identify in the report which resource was used to filter the report.
 	FilteredResourceID string
@@ -45,6 +44,11 @@ type SearchLatestReportData struct {
 	ConditionConfigIDs pgtype.Hstore
 	// SourceConfigIDs contains the config source IDs associated with the report.
 	SourceConfigIDs pgtype.Hstore
+	// Acknowledgement is the acknowledgement muting the pipeline of the report, if any.
+	Acknowledgement *Acknowledgement
+	// Stale tells whether the pipeline of the report has not reported for longer than its
+	// reporting interval.
+	Stale bool
 }
 
 // ReportSearchOptions contains options for searching reports.
@@ -79,7 +83,7 @@ func SearchReport(ctx context.Context, id string) (*model.PipelineReport, error)
 		&report.SourceConfigIDs,
 	)
 	if err != nil {
-		logrus.Errorf("querying for report: %s", err)
+		logrus.WithContext(ctx).Errorf("querying for report: %s", err)
 		return nil, err
 	}
 
@@ -106,29 +110,97 @@ type SearchLatestReportsParams struct {
 	// a pull request still waiting to be merged, or to the ones which do not. A nil value
 	// does not filter anything out.
 	OpenAction *bool
+	// Stale restricts the search to the reports of the pipelines which have not reported
+	// for longer than their reporting interval, or to the ones of the pipelines which
+	// have. A nil value does not filter anything out.
+	Stale *bool
+	// ExcludePayload leaves the payload of the reports out of the search, which is most of
+	// their size: Report is left empty, Name and Result are read from their own columns and
+	// the labels through label_ids. Only the OpenAction filter still reads the payload.
+	ExcludePayload bool
 }
 
 // SearchLatestReports searches the latest reports according some parameters.
 func SearchLatestReports(params SearchLatestReportsParams) ([]SearchLatestReportData, int, error) {
-	queryString := ""
-	var args []any
+	query, resourceFilters, err := searchLatestReportsQuery(params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Total counter query must be built before applying pagination
+	// because it needs to count all the reports matching the query.
+	totalCountQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
+
+	totalCountQueryString, totalCountArgs, err := totalCountQuery.Build(params.Ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("building total count query failed: %s\n\t%s",
+			totalCountQueryString, err)
+	}
+
+	totalCount := 0
+	if err = readDB(params.Ctx).QueryRow(params.Ctx, totalCountQueryString, totalCountArgs...).Scan(
+		&totalCount,
+	); err != nil {
+		logrus.WithContext(params.Ctx).Errorf("get reports: %s", err)
+	}
+
+	applyPagination(&query, params.Limit, params.Page)
+
+	dataset := []SearchLatestReportData{}
+	err = readLatestReports(params.Ctx, query, resourceFilters, params.ExcludePayload, func(data SearchLatestReportData) error {
+		dataset = append(dataset, data)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return dataset, totalCount, nil
+}
+
+// StreamLatestReports calls fn with every report SearchLatestReports selects, ignoring the
+// pagination, as they are read from the database rather than once they all are. It stops
+// at the first error fn returns, and returns it.
+func StreamLatestReports(params SearchLatestReportsParams, fn func(SearchLatestReportData) error) error {
+	query, resourceFilters, err := searchLatestReportsQuery(params)
+	if err != nil {
+		return err
+	}
+
+	return readLatestReports(params.Ctx, query, resourceFilters, params.ExcludePayload, fn)
+}
+
+// searchLatestReportsQuery builds the query of SearchLatestReports, without its
+// pagination. It returns along the resource config filters whose columns the query
+// selects, in order, see readLatestReports.
+func searchLatestReportsQuery(params SearchLatestReportsParams) (bob.BaseQuery[*dialect.SelectQuery], []resourceConfigFilter, error) {
+	// Without the payload, the columns denormalized out of it are read instead, and the
+	// labels, which the acknowledgements and the reporting intervals are matched against,
+	// through label_ids: extracting anything out of the payload would decompress all of it.
+	// See readLatestReports for the scan of both.
+	pipelineID := "data -> 'ID'"
+	labels := payloadLabelsSQL("pipelineReports")
+	payloadColumns := []any{"data -> 'PipelineID'", "data -> 'Result'", "data"}
+	if params.ExcludePayload {
+		pipelineID = "pipeline_id"
+		labels = storedLabelsSQL("pipelineReports")
+		payloadColumns = []any{"pipeline_result", "pipeline_name", labels}
+	}
 
 	query := psql.Select(
 		sm.From("pipelineReports"),
+		sm.Columns(pipelineID, "ID"),
+		sm.Columns(payloadColumns...),
 		sm.Columns(
-			"data -> 'ID'",
-			"ID",
-			"data -> 'PipelineID'",
-			"data -> 'Result'",
-			"data",
 			"created_at",
 			"updated_at",
 			"config_target_ids", "config_condition_ids", "config_source_ids",
+			staleSQL("pipelineReports", labels),
 		),
 	)
 
 	if params.Latest {
-		query.Apply(sm.Distinct("data -> 'ID'"), sm.OrderBy("data -> 'ID'"))
+		query.Apply(sm.Distinct(pipelineID), sm.OrderBy(pipelineID))
 	}
 
 	if len(params.Labels) > 0 {
@@ -140,7 +212,7 @@ func SearchLatestReports(params SearchLatestReportsParams) ([]SearchLatestReport
 			Ctx:       params.Ctx,
 		})
 		if err != nil {
-			return nil, 0, err
+			return query, nil, err
 		}
 	}
 
@@ -154,7 +226,7 @@ func SearchLatestReports(params SearchLatestReportsParams) ([]SearchLatestReport
 			StartTime:     params.StartTime,
 			EndTime:       params.EndTime,
 		}); err != nil {
-		return nil, 0, fmt.Errorf("applying updated_at range filter: %w", err)
+		return query, nil, fmt.Errorf("applying updated_at range filter: %w", err)
 	}
 
 	// Every applied filter adds a column to the select, so the filters are collected
@@ -176,74 +248,83 @@ func SearchLatestReports(params SearchLatestReportsParams) ([]SearchLatestReport
 
 	for _, filter := range resourceFilters {
 		if err := applyResourceConfigFilter(&query, filter.ID, filter.Kind); err != nil {
-			return nil, 0, err
+			return query, nil, err
 		}
 	}
 
 	if err := applyScmFilter(params.Ctx, &query, params.ScmID); err != nil {
-		return nil, 0, err
+		return query, nil, err
 	}
 
 	applyResultFilter(&query, params.Results)
 	applyOpenActionFilter(&query, params.OpenAction)
+	applyStaleFilter(&query, params.Stale, labels)
 
-	// Total counter query must be built before applying pagination
-	// because it needs to count all the reports matching the query.
-	totalCountQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
+	return query, resourceFilters, nil
+}
 
-	totalCountQueryString, totalCountArgs, err := totalCountQuery.Build(params.Ctx)
+// readLatestReports runs a query built by searchLatestReportsQuery and calls fn with every
+// report it returns, in order.
+func readLatestReports(
+	ctx context.Context,
+	query bob.BaseQuery[*dialect.SelectQuery],
+	resourceFilters []resourceConfigFilter,
+	excludePayload bool,
+	fn func(SearchLatestReportData) error,
+) error {
+	queryString, args, err := query.Build(ctx)
 	if err != nil {
-		return nil, 0, fmt.Errorf("building total count query failed: %s\n\t%s",
-			totalCountQueryString, err)
-	}
-
-	totalCount := 0
-	if err = DB.QueryRow(params.Ctx, totalCountQueryString, totalCountArgs...).Scan(
-		&totalCount,
-	); err != nil {
-		logrus.Errorf("get reports: %s", err)
+		return fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
 	}
 
-	applyPagination(&query, params.Limit, params.Page)
-
-	queryString, args, err = query.Build(params.Ctx)
+	// Read before the reports, a connection held by the rows meanwhile would be one less
+	// for every other request.
+	acknowledgements, err := ListAcknowledgements(ctx, false)
 	if err != nil {
-		return nil, 0, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
+		return err
 	}
 
-	rows, err := DB.Query(params.Ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("query failed: %q\n\t%s", queryString, err)
+		return fmt.Errorf("query failed: %q\n\t%s", queryString, err)
 	}
 	defer rows.Close()
 
-	dataset := []SearchLatestReportData{}
 	for rows.Next() {
 		p := model.PipelineReport{}
+		stale := false
 
 		// One extra column per applied resource config filter, in the order they were
 		// applied to the query.
 		filteredResources := make([]pgtype.Hstore, len(resourceFilters))
 
-		scanTargets := []any{
-			&p.ReportID,
-			&p.ID,
-			&p.PipelineID,
-			&p.Result,
-			&p.Pipeline,
+		scanTargets := []any{&p.ReportID, &p.ID}
+		if excludePayload {
+			scanTargets = append(scanTargets, &p.Result, &p.Pipeline.Name, &p.Pipeline.Labels)
+		} else {
+			scanTargets = append(scanTargets, &p.PipelineID, &p.Result, &p.Pipeline)
+		}
+
+		scanTargets = append(scanTargets,
 			&p.Created_at,
 			&p.Updated_at,
 			&p.TargetConfigIDs,
 			&p.ConditionConfigIDs,
 			&p.SourceConfigIDs,
-		}
+			&stale,
+		)
 
 		for i := range filteredResources {
 			scanTargets = append(scanTargets, &filteredResources[i])
 		}
 
 		if err := rows.Scan(scanTargets...); err != nil {
-			return nil, 0, fmt.Errorf("parsing result: %s", err)
+			return fmt.Errorf("parsing result: %s", err)
+		}
+
+		if excludePayload {
+			p.Pipeline.ID = p.ReportID
+			p.Pipeline.Result = p.Result
 		}
 
 		data := SearchLatestReportData{
@@ -256,6 +337,12 @@ func SearchLatestReports(params SearchLatestReportsParams) ([]SearchLatestReport
 			TargetConfigIDs:    p.TargetConfigIDs,
 			ConditionConfigIDs: p.ConditionConfigIDs,
 			SourceConfigIDs:    p.SourceConfigIDs,
+			Acknowledgement:    acknowledgementOf(acknowledgements, p.Pipeline.ID, p.Pipeline.Labels),
+			Stale:              stale,
+		}
+
+		if excludePayload {
+			data.Report = reports.Report{}
 		}
 
 		// When several filters are combined the last one wins, as it did when they were
@@ -263,20 +350,22 @@ func SearchLatestReports(params SearchLatestReportsParams) ([]SearchLatestReport
 		for i, filter := range resourceFilters {
 			resourceID, ok := filteredResources[i][filter.ID]
 			if !ok || resourceID == nil {
-				return nil, 0, fmt.Errorf("%sID %s not found in pipeline report", filter.Kind, filter.ID)
+				return fmt.Errorf("%sID %s not found in pipeline report", filter.Kind, filter.ID)
 			}
 
 			data.FilteredResourceID = *resourceID
 		}
 
-		dataset = append(dataset, data)
+		if err := fn(data); err != nil {
+			return err
+		}
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("reading results: %s", err)
+		return fmt.Errorf("reading results: %s", err)
 	}
 
-	return dataset, totalCount, nil
+	return nil
 }
 
 // SummaryGranularity is the size of the time buckets a reports summary is grouped by.
@@ -362,6 +451,9 @@ type ReportSummaryParams struct {
 	// a pull request still waiting to be merged, or to the ones which do not. A nil value
 	// does not filter anything out.
 	OpenAction *bool
+	// ExcludeAcknowledged leaves out the reports of the pipelines acknowledged right now,
+	// whenever the reports were published.
+	ExcludeAcknowledged bool
 }
 
 // ReportResultSummaryEntry contains the number of reports per result for a single time bucket.
@@ -435,6 +527,10 @@ func SearchReportsSummary(params ReportSummaryParams) ([]ReportResultSummaryEntr
 	applyResultFilter(&query, params.Results)
 	applyOpenActionFilter(&query, params.OpenAction)
 
+	if params.ExcludeAcknowledged {
+		query.Apply(sm.Where(psql.Raw("NOT " + acknowledgedSQLExpr)))
+	}
+
 	if len(params.Labels) > 0 {
 		// The report window is widened to whole buckets so the label lookup must cover
 		// the same range, otherwise labels timestamped within the widened part would be
@@ -462,7 +558,7 @@ func SearchReportsSummary(params ReportSummaryParams) ([]ReportResultSummaryEntr
 		return nil, 0, fmt.Errorf("building query failed: %s\n\t%s", queryString, err)
 	}
 
-	rows, err := DB.Query(params.Ctx, queryString, args...)
+	rows, err := readDB(params.Ctx).Query(params.Ctx, queryString, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("query failed: %q\n\t%s", queryString, err)
 	}
@@ -634,161 +730,39 @@ func nextBucket(t time.Time, granularity SummaryGranularity) time.Time {
 
 // InsertReport inserts a new report into the database.
 func InsertReport(ctx context.Context, report reports.Report) (string, error) {
-	var err error
-	configTargetIDs := pgtype.Hstore{}
-	configConditionIDs := pgtype.Hstore{}
-
-	configSourceIDs := buildConfigSources(ctx, report)
-
-	for conditionID, condition := range report.Conditions {
-		if condition.Config == nil {
-			continue
-		}
-
-		c, ok := condition.Config.(map[string]interface{})
-		if !ok {
-			logrus.Errorf("wrong config condition")
-			continue
-		}
-
-		kind, ok := c["Kind"].(string)
-		if !ok || kind == "" {
-			continue
-		}
-
-		data, err := json.Marshal(c)
-		if err != nil {
-			logrus.Errorf("marshaling target config: %s", err)
-			continue
-		}
-
-		results, _, err := GetTargetConfigs(ctx, kind, "", string(data), 0, 1)
-		if err != nil {
-			logrus.Errorf("failed: %s", err)
-			continue
-		}
-
-		switch len(results) {
-		case 0:
-			id, err := InsertConfigResource(ctx, "condition", kind, string(data))
-			if err != nil {
-				logrus.Errorf("insert config condition data: %s", err)
-				continue
-			}
-
-			parsedID, err := uuid.Parse(id)
-			if err != nil {
-				logrus.Errorf("parsing id: %s", err)
-			}
-
-			configConditionIDs[parsedID.String()] = stringPtr(conditionID)
-		case 1:
-			configConditionIDs[results[0].ID.String()] = stringPtr(conditionID)
-		default:
-			logrus.Warningf("multiple config condition found for %s", conditionID)
-			for _, result := range results {
-				logrus.Warningf("config condition %s", result.ID)
-			}
-		}
+	start := time.Now()
+
+	// The SCMs, configs and labels of the report are looked up before being inserted,
+	// reading them from a lagging replica would insert them twice.
+	ctx = WithPrimary(ctx)
+
+	// The previous state of the pipeline is only read when something listens.
+	listeners := listenReports()
+	var previous *PipelineState
+	var previousErr error
+	if len(listeners) > 0 {
+		previous, previousErr = previousPipelineState(ctx, report)
 	}
 
-	var targetDBScmIDs []uuid.UUID
-	for targetID, target := range report.Targets {
-		if target.Scm.URL != "" && target.Scm.Branch.Target != "" {
-			url := target.Scm.URL
-			branch := target.Scm.Branch.Target
-
-			ids, _, err := GetSCM(ctx, GetSCMParams{URL: url, Branch: branch})
-			if err != nil {
-				logrus.Errorf("query failed: %s", err)
-				return "", err
-			}
-
-			switch len(ids) {
-			// If no scm is found, we insert it
-			case 0:
-				// The branch inserted must be the one looked up above. Storing
-				// Branch.Source instead made the lookup of the next report miss the row
-				// every time the two differ, which is the normal case when Updatecli
-				// pushes its changes to a dedicated branch, and appended a duplicate scm
-				// on every published report.
-				id, err := InsertSCM(ctx, url, branch)
-				if err != nil {
-					logrus.Errorf("insert scm data: %s", err)
-					continue
-				}
-
-				parsedID, err := uuid.Parse(id)
-				if err != nil {
-					logrus.Errorf("parsing id: %s", err)
-				}
-
-				targetDBScmIDs = append(targetDBScmIDs, parsedID)
-			default:
-				for _, id := range ids {
-					if !slices.Contains(targetDBScmIDs, id.ID) {
-						targetDBScmIDs = append(targetDBScmIDs, id.ID)
-					}
-				}
-			}
-		}
-
-		if target.Config != nil {
-			t, ok := target.Config.(map[string]interface{})
-			if !ok {
-				logrus.Errorf("wrong config target:\n\t%s:\n%v", targetID, target.Config)
-				continue
-			}
-
-			kind, ok := t["Kind"].(string)
-			if !ok || kind == "" {
-				logrus.Errorf("wrong config target kind:\n\t%s:\n%v", targetID, target.Config)
-				continue
-			}
-
-			data, err := json.Marshal(t)
-			if err != nil {
-				logrus.Errorf("marshaling target config: %s", err)
-				continue
-			}
+	id, err := insertReport(ctx, report)
+	observeIngestion(start, report.Result, err)
 
-			results, _, err := GetTargetConfigs(ctx, kind, "", string(data), 0, 1)
-			if err != nil {
-				logrus.Errorf("failed: %s", err)
-				continue
-			}
-
-			switch len(results) {
-			case 0:
-				id, err := InsertConfigResource(ctx, "target", kind, string(data))
-				if err != nil {
-					logrus.Errorf("insert config target data: %s", err)
-					continue
-				}
-
-				parsedID, err := uuid.Parse(id)
-				if err != nil {
-					logrus.Errorf("parsing id: %s", err)
-				}
-
-				configTargetIDs[parsedID.String()] = stringPtr(targetID)
-			case 1:
-				configTargetIDs[results[0].ID.String()] = stringPtr(targetID)
-			default:
-				logrus.Warningf("multiple config target found for %s", targetID)
-				for _, result := range results {
-					logrus.Warningf("config target %s", result.ID)
-				}
-			}
-		}
+	if err == nil {
+		notifyReportInserted(ctx, listeners, InsertedReport{
+			ID:          id,
+			Report:      report,
+			Previous:    previous,
+			PreviousErr: previousErr,
+		})
 	}
 
-	labelIDs := []uuid.UUID{}
-	if len(report.Labels) > 0 {
-		labelIDs, err = InitLabels(ctx, report.Labels)
-		if err != nil {
-			return "", fmt.Errorf("initializing labels: %w", err)
-		}
+	return id, err
+}
+
+func insertReport(ctx context.Context, report reports.Report) (string, error) {
+	columns, _, err := buildReportColumns(ctx, report, nil, true)
+	if err != nil {
+		return "", err
 	}
 
 	query := psql.Insert(
@@ -806,21 +780,21 @@ func InsertReport(ctx context.Context, report reports.Report) (string, error) {
 		),
 		im.Values(
 			psql.Arg(report),
-			psql.Arg(report.ID),
-			psql.Arg(report.Result),
-			psql.Arg(report.Name),
-			psql.Arg(targetDBScmIDs),
-			psql.Arg(configSourceIDs),
-			psql.Arg(configConditionIDs),
-			psql.Arg(configTargetIDs),
-			psql.Arg(labelIDs),
+			psql.Arg(columns.PipelineID),
+			psql.Arg(columns.PipelineResult),
+			psql.Arg(columns.PipelineName),
+			psql.Arg(columns.TargetDBScmIDs),
+			psql.Arg(columns.ConfigSourceIDs),
+			psql.Arg(columns.ConfigConditionIDs),
+			psql.Arg(columns.ConfigTargetIDs),
+			psql.Arg(columns.LabelIDs),
 		),
 		im.Returning("id"),
 	)
 
 	queryString, args, err := query.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return "", err
 	}
 
@@ -829,70 +803,13 @@ func InsertReport(ctx context.Context, report reports.Report) (string, error) {
 		&reportID,
 	)
 	if err != nil {
-		logrus.Errorf("query failed: %s\n\t=> %q", err, queryString)
+		logrus.WithContext(ctx).Errorf("query failed: %s\n\t=> %q", err, queryString)
 		return "", err
 	}
 
 	return reportID.String(), nil
 }
 
-func buildConfigSources(ctx context.Context, report reports.Report) pgtype.Hstore {
-	configSourceIDs := pgtype.Hstore{}
-	for sourceID, source := range report.Sources {
-		if source.Config == nil {
-			continue
-		}
-
-		s, ok := source.Config.(map[string]interface{})
-		if !ok {
-			logrus.Errorf("wrong config source:\n\t%s:\n%v", sourceID, source.Config)
-			continue
-		}
-
-		data, err := json.Marshal(s)
-		if err != nil {
-			logrus.Errorf("marshaling source config: %s", err)
-			continue
-		}
-
-		kind, ok := s["Kind"].(string)
-		if !ok || kind == "" {
-			continue
-		}
-
-		results, _, err := GetSourceConfigs(ctx, kind, "", string(data), 0, 1)
-		if err != nil {
-			logrus.Errorf("failed: %s", err)
-			continue
-		}
-
-		switch len(results) {
-		case 0:
-			id, err := InsertConfigResource(ctx, "source", kind, string(data))
-			if err != nil {
-				logrus.Errorf("insert config source data: %s", err)
-				continue
-			}
-
-			parsedID, err := uuid.Parse(id)
-			if err != nil {
-				logrus.Errorf("parsing id: %s", err)
-			}
-
-			configSourceIDs[parsedID.String()] = stringPtr(sourceID)
-		case 1:
-			configSourceIDs[results[0].ID.String()] = stringPtr(sourceID)
-		default:
-			logrus.Warningf("multiple config source found for %s", sourceID)
-			for _, result := range results {
-				logrus.Warningf("config source %s", result.ID)
-			}
-		}
-	}
-
-	return configSourceIDs
-}
-
 // DeleteReport deletes a report from the database.
 func DeleteReport(ctx context.Context, id string) error {
 	//"DELETE FROM pipelineReports WHERE id=$1"
@@ -907,7 +824,7 @@ func DeleteReport(ctx context.Context, id string) error {
 	}
 
 	if _, err := DB.Exec(ctx, queryString, args...); err != nil {
-		logrus.Errorf("query failed: %s", err)
+		logrus.WithContext(ctx).Errorf("query failed: %s", err)
 		return err
 	}
 	return nil
@@ -934,7 +851,7 @@ func SearchNumberOfReportsByPipelineID(ctx context.Context, id string) (int, err
 	)
 
 	if err != nil {
-		logrus.Errorf("parsing result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing result: %s", err)
 		return 0, err
 	}
 
@@ -974,7 +891,7 @@ func SearchLatestReportByPipelineID(ctx context.Context, id string) (*model.Pipe
 	)
 
 	if err != nil {
-		logrus.Errorf("parsing result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing result: %s", err)
 		return nil, err
 	}
 
@@ -1085,13 +1002,13 @@ func applyScmFilter(ctx context.Context, query *bob.BaseQuery[*dialect.SelectQue
 	default:
 		scm, _, err := GetSCM(ctx, GetSCMParams{ID: scmID})
 		if err != nil {
-			logrus.Errorf("get scm data: %s", err)
+			logrus.WithContext(ctx).Errorf("get scm data: %s", err)
 			return err
 		}
 
 		switch len(scm) {
 		case 0:
-			logrus.Errorf("scm data not found")
+			logrus.WithContext(ctx).Errorf("scm data not found")
 		case 1:
 			query.Apply(
 				sm.Where(
@@ -1101,7 +1018,7 @@ func applyScmFilter(ctx context.Context, query *bob.BaseQuery[*dialect.SelectQue
 		default:
 			// Normally we should never have multiple scms with the same id
 			// so we should never reach this point.
-			logrus.Errorf("unexpected behavior: multiple scms found")
+			logrus.WithContext(ctx).Errorf("unexpected behavior: multiple scms found")
 		}
 	}
 
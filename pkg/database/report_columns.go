@@ -0,0 +1,401 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+// reportColumns are the columns of pipelineReports denormalized from the report payload, so
+// that the searches do not have to dig into it.
+type reportColumns struct {
+	PipelineID         string
+	PipelineResult     string
+	PipelineName       string
+	TargetDBScmIDs     []uuid.UUID
+	ConfigSourceIDs    pgtype.Hstore
+	ConfigConditionIDs pgtype.Hstore
+	ConfigTargetIDs    pgtype.Hstore
+	LabelIDs           []uuid.UUID
+}
+
+// buildReportColumns computes the denormalized columns of a report, looking up the scms, the
+// resource configs and the labels it refers to.
+//
+// The columns stored for the report, if any, are passed as stored: the config ids which still
+// refer to the config of their resource are kept rather than looked up again. A config
+// inserted twice is found twice by the lookup, which leaves its resource out.
+//
+// When create is set, the scms, configs and labels which do not exist yet are inserted.
+// Otherwise the returned complete is false when any would have to be, and the columns lack
+// them.
+func buildReportColumns(ctx context.Context, report reports.Report, stored *reportColumns, create bool) (columns reportColumns, complete bool, err error) {
+	if stored == nil {
+		stored = &reportColumns{}
+	}
+
+	columns = reportColumns{
+		PipelineID:     report.ID,
+		PipelineResult: report.Result,
+		PipelineName:   report.Name,
+	}
+	complete = true
+
+	sources := map[string]any{}
+	for id, source := range report.Sources {
+		if source != nil {
+			sources[id] = source.Config
+		}
+	}
+
+	conditions := map[string]any{}
+	for id, condition := range report.Conditions {
+		if condition != nil {
+			conditions[id] = condition.Config
+		}
+	}
+
+	targets := map[string]any{}
+	for id, target := range report.Targets {
+		if target != nil {
+			targets[id] = target.Config
+		}
+	}
+
+	resolved := true
+
+	if columns.ConfigSourceIDs, resolved, err = resolveConfigIDs(ctx, "source", sources, stored.ConfigSourceIDs, create); err != nil {
+		return columns, false, err
+	}
+	complete = complete && resolved
+
+	if columns.ConfigConditionIDs, resolved, err = resolveConfigIDs(ctx, "condition", conditions, stored.ConfigConditionIDs, create); err != nil {
+		return columns, false, err
+	}
+	complete = complete && resolved
+
+	if columns.ConfigTargetIDs, resolved, err = resolveConfigIDs(ctx, "target", targets, stored.ConfigTargetIDs, create); err != nil {
+		return columns, false, err
+	}
+	complete = complete && resolved
+
+	if columns.TargetDBScmIDs, resolved, err = resolveScmIDs(ctx, report, create); err != nil {
+		return columns, false, err
+	}
+	complete = complete && resolved
+
+	if columns.LabelIDs, resolved, err = resolveLabelIDs(ctx, report.Labels, create); err != nil {
+		return columns, false, err
+	}
+	complete = complete && resolved
+
+	return columns, complete, nil
+}
+
+// findConfigIDs returns the ids of the configs of a resource type matching the provided one,
+// restricted to the config of the provided id when set.
+func findConfigIDs(ctx context.Context, resourceType, kind, id, config string) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+
+	switch resourceType {
+	case "source":
+		results, _, err := GetSourceConfigs(ctx, kind, id, config, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+	case "condition":
+		results, _, err := GetConditionConfigs(ctx, kind, id, config, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+	case "target":
+		results, _, err := GetTargetConfigs(ctx, kind, id, config, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+	default:
+		return nil, fmt.Errorf("unknown resource type %q", resourceType)
+	}
+
+	return ids, nil
+}
+
+// resolveConfigIDs returns the config ids of the resources of a type, mapped to the id of
+// their resource. See buildReportColumns for stored and create.
+func resolveConfigIDs(ctx context.Context, resourceType string, configs map[string]any, stored pgtype.Hstore, create bool) (pgtype.Hstore, bool, error) {
+	ids := pgtype.Hstore{}
+	complete := true
+
+	// storedIDs are the config ids stored per resource id.
+	storedIDs := map[string][]string{}
+	for configID, resourceID := range stored {
+		if resourceID != nil {
+			storedIDs[*resourceID] = append(storedIDs[*resourceID], configID)
+		}
+	}
+
+	for resourceID, config := range configs {
+		if config == nil {
+			continue
+		}
+
+		c, ok := config.(map[string]interface{})
+		if !ok {
+			logrus.WithContext(ctx).Errorf("wrong config %s:\n\t%s:\n%v", resourceType, resourceID, config)
+			continue
+		}
+
+		kind, ok := c["Kind"].(string)
+		if !ok || kind == "" {
+			continue
+		}
+
+		data, err := json.Marshal(c)
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("marshaling %s config: %s", resourceType, err)
+			continue
+		}
+
+		kept := false
+		for _, configID := range storedIDs[resourceID] {
+			found, err := findConfigIDs(ctx, resourceType, kind, configID, string(data))
+			if err != nil {
+				return nil, false, err
+			}
+
+			if len(found) > 0 {
+				ids[configID] = stringPtr(resourceID)
+				kept = true
+				break
+			}
+		}
+
+		if kept {
+			continue
+		}
+
+		found, err := findConfigIDs(ctx, resourceType, kind, "", string(data))
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("failed: %s", err)
+			continue
+		}
+
+		switch len(found) {
+		case 0:
+			if !create {
+				complete = false
+				continue
+			}
+
+			id, err := InsertConfigResource(ctx, resourceType, kind, string(data))
+			if err != nil {
+				logrus.WithContext(ctx).Errorf("insert config %s data: %s", resourceType, err)
+				continue
+			}
+
+			parsedID, err := uuid.Parse(id)
+			if err != nil {
+				logrus.WithContext(ctx).Errorf("parsing id: %s", err)
+			}
+
+			ids[parsedID.String()] = stringPtr(resourceID)
+		default:
+			// The condition configs used to be looked up among the targets, so that an
+			// identical one was inserted for every report. The configs are ordered, the
+			// most recently updated first, for every report to resolve the same one.
+			if len(found) > 1 {
+				logrus.WithContext(ctx).Debugf("%d config %s found for %s, %s is used", len(found), resourceType, resourceID, found[0])
+			}
+
+			ids[found[0].String()] = stringPtr(resourceID)
+		}
+	}
+
+	return ids, complete, nil
+}
+
+// resolveScmIDs returns the ids of the scms the targets of a report push to.
+func resolveScmIDs(ctx context.Context, report reports.Report, create bool) ([]uuid.UUID, bool, error) {
+	var ids []uuid.UUID
+	complete := true
+
+	for _, target := range report.Targets {
+		if target == nil || target.Scm.URL == "" || target.Scm.Branch.Target == "" {
+			continue
+		}
+
+		url := target.Scm.URL
+		branch := target.Scm.Branch.Target
+
+		scms, _, err := GetSCM(ctx, GetSCMParams{URL: url, Branch: branch})
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("query failed: %s", err)
+			return nil, false, err
+		}
+
+		switch len(scms) {
+		// If no scm is found, we insert it
+		case 0:
+			if !create {
+				complete = false
+				continue
+			}
+
+			// The branch inserted must be the one looked up above. Storing
+			// Branch.Source instead made the lookup of the next report miss the row
+			// every time the two differ, which is the normal case when Updatecli
+			// pushes its changes to a dedicated branch, and appended a duplicate scm
+			// on every published report.
+			id, err := InsertSCM(ctx, url, branch)
+			if err != nil {
+				logrus.WithContext(ctx).Errorf("insert scm data: %s", err)
+				continue
+			}
+
+			parsedID, err := uuid.Parse(id)
+			if err != nil {
+				logrus.WithContext(ctx).Errorf("parsing id: %s", err)
+			}
+
+			if !slices.Contains(ids, parsedID) {
+				ids = append(ids, parsedID)
+			}
+		default:
+			for _, scm := range scms {
+				if !slices.Contains(ids, scm.ID) {
+					ids = append(ids, scm.ID)
+				}
+			}
+		}
+	}
+
+	return ids, complete, nil
+}
+
+// resolveLabelIDs returns the ids of the labels of a report.
+func resolveLabelIDs(ctx context.Context, labels map[string]string, create bool) ([]uuid.UUID, bool, error) {
+	if len(labels) == 0 {
+		return []uuid.UUID{}, true, nil
+	}
+
+	if create {
+		ids, err := InitLabels(ctx, labels)
+		if err != nil {
+			return nil, false, fmt.Errorf("initializing labels: %w", err)
+		}
+
+		return ids, true, nil
+	}
+
+	ids := []uuid.UUID{}
+	complete := true
+
+	for key, value := range labels {
+		if key == "" || value == "" {
+			continue
+		}
+
+		records, totalCount, err := GetLabelRecords(ctx, "", key, value, "", "", 0, 1)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get labels: %w", err)
+		}
+
+		switch totalCount {
+		case 0:
+			complete = false
+		case 1:
+			if value == records[0].Value {
+				ids = append(ids, records[0].ID)
+			}
+		}
+	}
+
+	return ids, complete, nil
+}
+
+// driftedColumns returns the names of the columns which differ between stored and
+// computed. The ids are compared as sets, their order follows the one of a map.
+func driftedColumns(stored, computed reportColumns) []string {
+	columns := []string{}
+
+	if stored.PipelineID != computed.PipelineID {
+		columns = append(columns, "pipeline_id")
+	}
+
+	if stored.PipelineResult != computed.PipelineResult {
+		columns = append(columns, "pipeline_result")
+	}
+
+	if stored.PipelineName != computed.PipelineName {
+		columns = append(columns, "pipeline_name")
+	}
+
+	if !sameUUIDs(stored.TargetDBScmIDs, computed.TargetDBScmIDs) {
+		columns = append(columns, "target_db_scm_ids")
+	}
+
+	if !sameHstore(stored.ConfigSourceIDs, computed.ConfigSourceIDs) {
+		columns = append(columns, "config_source_ids")
+	}
+
+	if !sameHstore(stored.ConfigConditionIDs, computed.ConfigConditionIDs) {
+		columns = append(columns, "config_condition_ids")
+	}
+
+	if !sameHstore(stored.ConfigTargetIDs, computed.ConfigTargetIDs) {
+		columns = append(columns, "config_target_ids")
+	}
+
+	if !sameUUIDs(stored.LabelIDs, computed.LabelIDs) {
+		columns = append(columns, "label_ids")
+	}
+
+	return columns
+}
+
+func sameUUIDs(a, b []uuid.UUID) bool {
+	for _, id := range a {
+		if !slices.Contains(b, id) {
+			return false
+		}
+	}
+
+	for _, id := range b {
+		if !slices.Contains(a, id) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameHstore compares two hstores, a NULL one being the same as an empty one.
+func sameHstore(a, b pgtype.Hstore) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || (value == nil) != (other == nil) || (value != nil && *value != *other) {
+			return false
+		}
+	}
+
+	return true
+}
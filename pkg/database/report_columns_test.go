@@ -0,0 +1,36 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriftedColumns(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	stored := reportColumns{
+		PipelineID:      "id",
+		PipelineResult:  "✔",
+		PipelineName:    "name",
+		TargetDBScmIDs:  []uuid.UUID{a, b},
+		ConfigSourceIDs: pgtype.Hstore{a.String(): stringPtr("source")},
+	}
+
+	computed := stored
+	// The ids are compared as sets, and a NULL column is the same as an empty one.
+	computed.TargetDBScmIDs = []uuid.UUID{b, a}
+	computed.ConfigConditionIDs = pgtype.Hstore{}
+	computed.LabelIDs = []uuid.UUID{}
+	assert.Empty(t, driftedColumns(stored, computed))
+
+	computed.PipelineResult = "✗"
+	computed.TargetDBScmIDs = []uuid.UUID{a}
+	computed.ConfigSourceIDs = pgtype.Hstore{a.String(): stringPtr("other")}
+	computed.LabelIDs = []uuid.UUID{b}
+	assert.Equal(t,
+		[]string{"pipeline_result", "target_db_scm_ids", "config_source_ids", "label_ids"},
+		driftedColumns(stored, computed))
+}
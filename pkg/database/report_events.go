@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+// PipelineState is where a pipeline stands according to its latest report.
+type PipelineState struct {
+	// ReportID is the id of the latest report of the pipeline.
+	ReportID string
+	// Result is the result of the pipeline.
+	Result string
+	// ActionURLs are the links of the actions left open by the pipeline, such as a pull
+	// request waiting to be merged, see openActionSQLExpr.
+	ActionURLs []string
+}
+
+// InsertedReport describes a report just inserted by InsertReport.
+type InsertedReport struct {
+	// ID is the id of the inserted report.
+	ID string
+	// Report is the inserted report.
+	Report reports.Report
+	// Previous is where the pipeline stood before the report was inserted, nil for the
+	// first report of a pipeline or when it could not be read.
+	Previous *PipelineState
+	// PreviousErr is why the previous state could not be read, see PreviousPipelineState
+	// to read it again.
+	PreviousErr error
+}
+
+// ReportListener is called by InsertReport once a report is inserted. It is called before
+// InsertReport returns, it must not block.
+type ReportListener func(ctx context.Context, inserted InsertedReport)
+
+// reportListener is a registered ReportListener, identified for it to be unregistered.
+type reportListener struct {
+	id     uint64
+	listen ReportListener
+}
+
+var (
+	reportListenersMu  sync.RWMutex
+	reportListeners    []reportListener
+	nextReportListener uint64
+)
+
+// OnReportInserted registers a listener called for every report inserted from now on, and
+// returns a function unregistering it.
+func OnReportInserted(l ReportListener) func() {
+	reportListenersMu.Lock()
+	defer reportListenersMu.Unlock()
+
+	nextReportListener++
+	id := nextReportListener
+	reportListeners = append(reportListeners, reportListener{id: id, listen: l})
+
+	return func() {
+		reportListenersMu.Lock()
+		defer reportListenersMu.Unlock()
+
+		// Copied rather than changed in place, the insertions may be iterating over it.
+		reportListeners = slices.DeleteFunc(slices.Clone(reportListeners), func(r reportListener) bool {
+			return r.id == id
+		})
+	}
+}
+
+// listenReports returns the listeners registered, none when nothing listens.
+func listenReports() []reportListener {
+	reportListenersMu.RLock()
+	defer reportListenersMu.RUnlock()
+
+	return reportListeners
+}
+
+// latestPipelineState returns where a pipeline stands according to its latest report other
+// than the excluded one, nil when no such report of the pipeline was published yet.
+//
+// Two reports of the same pipeline inserted at once may both find the same previous state,
+// a pipeline is however run by a single CI job, which publishes its reports one after the
+// other.
+func latestPipelineState(ctx context.Context, pipelineID, excludedReportID string) (*PipelineState, error) {
+	state := PipelineState{}
+
+	err := DB.QueryRow(ctx, `
+		SELECT id::text, pipeline_result, jsonb_path_query_array(data, '$.Actions.*.actionUrl')
+		FROM pipelineReports
+		WHERE pipeline_id = $1 AND id::text <> $2
+		ORDER BY updated_at DESC
+		LIMIT 1`,
+		pipelineID,
+		excludedReportID,
+	).Scan(&state.ReportID, &state.Result, &state.ActionURLs)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading the latest state of pipeline %q: %w", pipelineID, err)
+	}
+
+	return &state, nil
+}
+
+// PreviousPipelineState returns where the pipeline of an inserted report stood before it,
+// for a listener given a PreviousErr to read it again once the report is inserted.
+func PreviousPipelineState(ctx context.Context, inserted InsertedReport) (*PipelineState, error) {
+	return latestPipelineState(ctx, inserted.Report.ID, inserted.ID)
+}
+
+// notifyReportInserted calls the listeners of the inserted reports.
+func notifyReportInserted(ctx context.Context, listeners []reportListener, inserted InsertedReport) {
+	for _, l := range listeners {
+		l.listen(ctx, inserted)
+	}
+}
+
+// previousPipelineState returns the state of the pipeline of a report about to be inserted,
+// for the listeners. A failure to read it does not fail the insertion, it is passed to the
+// listeners instead.
+func previousPipelineState(ctx context.Context, report reports.Report) (*PipelineState, error) {
+	if report.ID == "" {
+		return nil, nil
+	}
+
+	return latestPipelineState(ctx, report.ID, "")
+}
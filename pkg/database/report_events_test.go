@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnReportInserted(t *testing.T) {
+	called := []string{}
+	listener := func(name string) ReportListener {
+		return func(context.Context, InsertedReport) {
+			called = append(called, name)
+		}
+	}
+
+	unregisterFirst := OnReportInserted(listener("first"))
+	unregisterSecond := OnReportInserted(listener("second"))
+	t.Cleanup(unregisterSecond)
+
+	// The insertions iterating over the listeners meanwhile keep calling every one.
+	listeners := listenReports()
+	unregisterFirst()
+
+	notifyReportInserted(context.Background(), listeners, InsertedReport{})
+	assert.Equal(t, []string{"first", "second"}, called)
+
+	called = []string{}
+	notifyReportInserted(context.Background(), listenReports(), InsertedReport{})
+	assert.Equal(t, []string{"second"}, called)
+}
@@ -0,0 +1,316 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// reportsChannel is the Postgres channel the inserted reports are announced on, so that
+	// every replica streams them whichever one inserted them.
+	reportsChannel = "udash_reports"
+	// maxReplayedReports caps the reports replayed to a client resuming the stream, a
+	// client away for longer is better off searching the reports.
+	maxReplayedReports = 1000
+	// listenRetryInterval is how long ListenReports waits before listening again once its
+	// connection is lost.
+	listenRetryInterval = 5 * time.Second
+	// subscriptionBuffer is how many reports a subscriber may lag behind before it is
+	// dropped.
+	subscriptionBuffer = 64
+	// announcementBuffer is how many inserted reports may wait to be announced before the
+	// next ones are not.
+	announcementBuffer = 1024
+)
+
+// announcements are the ids of the inserted reports waiting to be announced, see
+// PublishReportInserted and announceReports.
+var announcements = make(chan string, announcementBuffer)
+
+// StreamedReport describes an inserted report to the clients of the reports stream, without
+// its payload.
+type StreamedReport struct {
+	// ID is the id of the report, and PipelineID the id of its pipeline.
+	ID         string `json:"id"`
+	PipelineID string `json:"pipeline_id"`
+	Name       string `json:"name"`
+	Result     string `json:"result"`
+	// Labels are the labels of the report.
+	Labels map[string]string `json:"labels"`
+	// SCMIDs are the ids of the scms targeted by the report.
+	SCMIDs []string `json:"scm_ids"`
+	// OpenAction tells whether the report carries an open action, see openActionSQLExpr.
+	OpenAction bool      `json:"open_action"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// The config ids of the resources of the report, only matched against.
+	sourceIDs    []string
+	conditionIDs []string
+	targetIDs    []string
+}
+
+// ReportStreamFilter selects the reports of the stream, as SearchLatestReportsParams
+// selects the reports of a search. An empty filter selects every report.
+type ReportStreamFilter struct {
+	// ScmID selects the reports targeting that scm, "none" the ones targeting none.
+	ScmID       string
+	SourceID    string
+	ConditionID string
+	TargetID    string
+	Labels      map[string]string
+	// Results selects the reports whose result is one of them.
+	Results []string
+	// OpenAction selects the reports which carry an open action, or the ones which do not.
+	OpenAction *bool
+}
+
+// Matches reports whether the filter selects a streamed report.
+func (f ReportStreamFilter) Matches(r StreamedReport) bool {
+	switch f.ScmID {
+	case "":
+	case "none", "null", "nil":
+		if len(r.SCMIDs) > 0 {
+			return false
+		}
+	default:
+		if !slices.Contains(r.SCMIDs, f.ScmID) {
+			return false
+		}
+	}
+
+	for _, resource := range []struct {
+		id  string
+		ids []string
+	}{
+		{f.SourceID, r.sourceIDs},
+		{f.ConditionID, r.conditionIDs},
+		{f.TargetID, r.targetIDs},
+	} {
+		if resource.id != "" && !slices.Contains(resource.ids, resource.id) {
+			return false
+		}
+	}
+
+	for key, value := range f.Labels {
+		if v, found := r.Labels[key]; !found || v != value {
+			return false
+		}
+	}
+
+	if len(f.Results) > 0 && !slices.Contains(f.Results, r.Result) {
+		return false
+	}
+
+	if f.OpenAction != nil && *f.OpenAction != r.OpenAction {
+		return false
+	}
+
+	return true
+}
+
+// streamedReportColumns are the columns scanned by scanStreamedReport, in its order.
+const streamedReportColumns = `id::text, pipeline_id, pipeline_name, pipeline_result,
+	COALESCE(data -> 'Labels', '{}'), target_db_scm_ids::text[], ` + openActionSQLExpr + `,
+	COALESCE(akeys(config_source_ids), '{}'), COALESCE(akeys(config_condition_ids), '{}'),
+	COALESCE(akeys(config_target_ids), '{}'), created_at`
+
+func scanStreamedReport(row pgx.Row) (StreamedReport, error) {
+	r := StreamedReport{}
+
+	err := row.Scan(
+		&r.ID,
+		&r.PipelineID,
+		&r.Name,
+		&r.Result,
+		&r.Labels,
+		&r.SCMIDs,
+		&r.OpenAction,
+		&r.sourceIDs,
+		&r.conditionIDs,
+		&r.targetIDs,
+		&r.CreatedAt,
+	)
+
+	return r, err
+}
+
+// PublishReportInserted queues an inserted report to be announced to the reports stream of
+// every replica, see ListenReports. It is registered with OnReportInserted, and does not
+// wait for the announcement.
+//
+// A report which cannot be announced is missing from the live stream only, a client
+// resuming the stream after it replays it.
+func PublishReportInserted(ctx context.Context, inserted InsertedReport) {
+	select {
+	case announcements <- inserted.ID:
+	default:
+		logrus.WithContext(ctx).Warnf("announcing report %s: too many reports waiting to be announced", inserted.ID)
+	}
+}
+
+// announceReports announces the queued reports until ctx is cancelled, the reports still
+// queued then are not.
+func announceReports(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-announcements:
+			if _, err := DB.Exec(ctx, "SELECT pg_notify($1, $2)", reportsChannel, id); err != nil && ctx.Err() == nil {
+				logrus.WithContext(ctx).Errorf("announcing report %s: %s", id, err)
+			}
+		}
+	}
+}
+
+var (
+	reportSubscriptionsMu sync.Mutex
+	reportSubscriptions   = map[chan StreamedReport]struct{}{}
+)
+
+// SubscribeReports returns a channel receiving the reports announced from now on, and a
+// function ending the subscription. The channel is closed when the subscription ends, see
+// EndReportSubscriptions, or when the subscriber lags too far behind: it is then up to it
+// to resume, see ReportsInsertedAfter.
+func SubscribeReports() (<-chan StreamedReport, func()) {
+	ch := make(chan StreamedReport, subscriptionBuffer)
+
+	reportSubscriptionsMu.Lock()
+	reportSubscriptions[ch] = struct{}{}
+	reportSubscriptionsMu.Unlock()
+
+	return ch, func() {
+		reportSubscriptionsMu.Lock()
+		defer reportSubscriptionsMu.Unlock()
+
+		if _, found := reportSubscriptions[ch]; found {
+			delete(reportSubscriptions, ch)
+			close(ch)
+		}
+	}
+}
+
+// EndReportSubscriptions ends every subscription, for the subscribers to stop as the server
+// does.
+func EndReportSubscriptions() {
+	reportSubscriptionsMu.Lock()
+	defer reportSubscriptionsMu.Unlock()
+
+	for ch := range reportSubscriptions {
+		delete(reportSubscriptions, ch)
+		close(ch)
+	}
+}
+
+// dispatchReport sends an announced report to every subscriber, dropping the ones which
+// lag too far behind rather than waiting for them.
+func dispatchReport(r StreamedReport) {
+	reportSubscriptionsMu.Lock()
+	defer reportSubscriptionsMu.Unlock()
+
+	for ch := range reportSubscriptions {
+		select {
+		case ch <- r:
+		default:
+			delete(reportSubscriptions, ch)
+			close(ch)
+		}
+	}
+}
+
+// ListenReports dispatches the reports announced by every replica to the subscribers of
+// this one, and announces the reports this one inserts, until ctx is cancelled. It listens
+// again when its connection is lost, the reports announced meanwhile are not dispatched.
+func ListenReports(ctx context.Context) {
+	announced := make(chan struct{})
+	go func() {
+		defer close(announced)
+		announceReports(ctx)
+	}()
+	defer func() { <-announced }()
+
+	for {
+		if err := listenAnnouncedReports(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithContext(ctx).Errorf("listening to the inserted reports: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+// listenAnnouncedReports listens to the announced reports on a connection of its own, taken out of
+// the pool: a connection left listening would receive the notifications of the channel
+// for as long as it is pooled.
+func listenAnnouncedReports(ctx context.Context) error {
+	pooled, err := DB.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring a connection: %w", err)
+	}
+
+	conn := pooled.Hijack()
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+reportsChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		// The report is read from the primary, a lagging replica may not have it yet.
+		report, err := scanStreamedReport(DB.QueryRow(ctx,
+			"SELECT "+streamedReportColumns+" FROM pipelineReports WHERE id = $1",
+			notification.Payload,
+		))
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("reading announced report %s: %s", notification.Payload, err)
+			continue
+		}
+
+		dispatchReport(report)
+	}
+}
+
+// ReportsInsertedAfter returns the reports selected by the filter among the
+// maxReplayedReports ones inserted after the provided one, in the order they were inserted.
+// It returns none when the report does not exist.
+//
+// The reports are ordered by their creation time, that of the transaction inserting them:
+// a report inserted by a transaction which started earlier but committed later is missed.
+// They are read from the primary, the report the client last received may not have
+// reached a lagging replica yet.
+func ReportsInsertedAfter(ctx context.Context, id string, filter ReportStreamFilter) ([]StreamedReport, error) {
+	rows, err := DB.Query(ctx, `
+		SELECT `+streamedReportColumns+`
+		FROM pipelineReports
+		WHERE (created_at, id) > (SELECT created_at, id FROM pipelineReports WHERE id = $1)
+		ORDER BY created_at, id
+		LIMIT $2`,
+		id, maxReplayedReports,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reading the reports inserted after %s: %w", id, err)
+	}
+
+	inserted, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (StreamedReport, error) {
+		return scanStreamedReport(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing the reports inserted after %s: %w", id, err)
+	}
+
+	return slices.DeleteFunc(inserted, func(r StreamedReport) bool { return !filter.Matches(r) }), nil
+}
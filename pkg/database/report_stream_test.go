@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportStreamFilterMatches(t *testing.T) {
+	yes, no := true, false
+
+	report := StreamedReport{
+		ID:         "report",
+		Result:     "✗",
+		Labels:     map[string]string{"team": "platform", "env": "prod"},
+		SCMIDs:     []string{"scm"},
+		OpenAction: true,
+		sourceIDs:  []string{"source"},
+		targetIDs:  []string{"target"},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		filter   ReportStreamFilter
+		expected bool
+	}{
+		{"no filter", ReportStreamFilter{}, true},
+		{"scm", ReportStreamFilter{ScmID: "scm"}, true},
+		{"other scm", ReportStreamFilter{ScmID: "other"}, false},
+		{"no scm", ReportStreamFilter{ScmID: "none"}, false},
+		{"source and target", ReportStreamFilter{SourceID: "source", TargetID: "target"}, true},
+		{"condition", ReportStreamFilter{ConditionID: "condition"}, false},
+		{"labels", ReportStreamFilter{Labels: map[string]string{"team": "platform"}}, true},
+		{"other labels", ReportStreamFilter{Labels: map[string]string{"team": "platform", "env": "dev"}}, false},
+		{"results", ReportStreamFilter{Results: []string{"✔", "✗"}}, true},
+		{"other results", ReportStreamFilter{Results: []string{"✔"}}, false},
+		{"open action", ReportStreamFilter{OpenAction: &yes}, true},
+		{"no open action", ReportStreamFilter{OpenAction: &no}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.Matches(report))
+		})
+	}
+
+	assert.True(t, ReportStreamFilter{ScmID: "none"}.Matches(StreamedReport{}))
+}
+
+func TestReportSubscriptions(t *testing.T) {
+	live, endLive := SubscribeReports()
+	defer endLive()
+	lagging, endLagging := SubscribeReports()
+	defer endLagging()
+
+	// The lagging subscriber never reads, it is dropped once its buffer is full.
+	for i := 0; i <= subscriptionBuffer; i++ {
+		dispatchReport(StreamedReport{ID: "report"})
+		<-live
+	}
+
+	received := 0
+	for range lagging {
+		received++
+	}
+	assert.Equal(t, subscriptionBuffer, received)
+
+	EndReportSubscriptions()
+
+	_, open := <-live
+	assert.False(t, open)
+}
+
+func TestPublishReportInsertedDoesNotBlock(t *testing.T) {
+	t.Cleanup(func() {
+		for len(announcements) > 0 {
+			<-announcements
+		}
+	})
+
+	// Nothing announces the queued reports, the ones past the buffer are dropped.
+	for i := range announcementBuffer + 1 {
+		PublishReportInserted(context.Background(), InsertedReport{ID: fmt.Sprintf("report-%d", i)})
+	}
+
+	assert.Len(t, announcements, announcementBuffer)
+	assert.Equal(t, "report-0", <-announcements)
+}
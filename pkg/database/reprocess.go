@@ -0,0 +1,394 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ReprocessPending is the status of a job waiting to be run, or to be resumed.
+	ReprocessPending = "pending"
+	// ReprocessRunning is the status of a job being run.
+	ReprocessRunning = "running"
+	// ReprocessCompleted is the status of a job which processed every report.
+	ReprocessCompleted = "completed"
+	// ReprocessFailed is the status of a job stopped by an error.
+	ReprocessFailed = "failed"
+	// ReprocessCancelled is the status of a job cancelled before it completed.
+	ReprocessCancelled = "cancelled"
+
+	// defaultReprocessBatchSize is the number of reports processed at once by default.
+	defaultReprocessBatchSize = 100
+	// defaultReprocessBatchDelay is the pause between two batches by default, which leaves
+	// the database to the requests of a live instance.
+	defaultReprocessBatchDelay = time.Second
+	// reprocessPollInterval is how often the pending jobs are looked for.
+	reprocessPollInterval = 10 * time.Second
+	// reprocessStaleAfter is how long a running job may go without reporting progress
+	// before it is considered abandoned, by a udash which crashed, and taken over.
+	reprocessStaleAfter = 5 * time.Minute
+	// maxListedReprocessJobs caps the jobs listed by ListReprocessJobs.
+	maxListedReprocessJobs = 50
+)
+
+var (
+	// ErrReprocessJobDone is returned when cancelling a job which already stopped.
+	ErrReprocessJobDone = errors.New("reprocessing job already stopped")
+	// ErrInvalidReprocessJob is returned when creating a job from invalid parameters.
+	ErrInvalidReprocessJob = errors.New("invalid reprocessing job")
+)
+
+// ReprocessJob recomputes the denormalized columns of the stored reports, see
+// CreateReprocessJob.
+type ReprocessJob struct {
+	ID     uuid.UUID `json:"id"`
+	Status string    `json:"status"`
+	// StartTime, EndTime and Labels select the reports, as the reports search does.
+	StartTime string            `json:"start_time,omitempty"`
+	EndTime   string            `json:"end_time,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// BatchSize is the number of reports processed at once, and BatchDelayMs the pause
+	// between two batches, in milliseconds.
+	BatchSize    int `json:"batch_size"`
+	BatchDelayMs int `json:"batch_delay_ms"`
+	// Total is the number of reports selected, counted when the job starts. Processed of
+	// them were, Updated had drifted columns and Failed could not be processed.
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	Updated   int `json:"updated"`
+	Failed    int `json:"failed"`
+	// Error is the last error met, the job keeps going unless it is failed.
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// lastReportID is the id of the last report processed, the job resumes after it.
+	lastReportID *uuid.UUID
+}
+
+// ReprocessJobParams describes the reports a new job processes and its throttling.
+type ReprocessJobParams struct {
+	StartTime string
+	EndTime   string
+	Labels    map[string]string
+	// BatchSize defaults to 100
+	BatchSize int
+	// BatchDelay defaults to 1s
+	BatchDelay time.Duration
+}
+
+// reprocessJobColumns are the columns scanned by scanReprocessJob, in its order.
+const reprocessJobColumns = `id, status, start_time, end_time, labels, batch_size, batch_delay_ms,
+	last_report_id, total, processed, updated, failed, error, created_at, updated_at`
+
+func scanReprocessJob(row pgx.Row) (ReprocessJob, error) {
+	job := ReprocessJob{}
+
+	err := row.Scan(
+		&job.ID,
+		&job.Status,
+		&job.StartTime,
+		&job.EndTime,
+		&job.Labels,
+		&job.BatchSize,
+		&job.BatchDelayMs,
+		&job.lastReportID,
+		&job.Total,
+		&job.Processed,
+		&job.Updated,
+		&job.Failed,
+		&job.Error,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+
+	return job, err
+}
+
+// CreateReprocessJob records a job recomputing the denormalized columns of the selected
+// reports with the extraction InsertReport runs today, as a check with repair does. It is
+// run in the background by RunReprocessJobs.
+func CreateReprocessJob(ctx context.Context, p ReprocessJobParams) (ReprocessJob, error) {
+	if p.BatchSize < 0 || p.BatchDelay < 0 {
+		return ReprocessJob{}, fmt.Errorf("%w: the batch size and delay cannot be negative", ErrInvalidReprocessJob)
+	}
+
+	// Rejected now rather than when the job runs.
+	if _, _, err := resolveTimeRange(0, p.StartTime, p.EndTime); err != nil {
+		return ReprocessJob{}, fmt.Errorf("%w: %w", ErrInvalidReprocessJob, err)
+	}
+
+	if p.BatchSize == 0 {
+		p.BatchSize = defaultReprocessBatchSize
+	}
+
+	if p.BatchDelay == 0 {
+		p.BatchDelay = defaultReprocessBatchDelay
+	}
+
+	if p.Labels == nil {
+		p.Labels = map[string]string{}
+	}
+
+	job, err := scanReprocessJob(DB.QueryRow(ctx, `
+		INSERT INTO reprocess_jobs (start_time, end_time, labels, batch_size, batch_delay_ms)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+reprocessJobColumns,
+		p.StartTime, p.EndTime, p.Labels, p.BatchSize, p.BatchDelay.Milliseconds(),
+	))
+	if err != nil {
+		return ReprocessJob{}, fmt.Errorf("creating reprocessing job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetReprocessJob returns the job of the provided id, pgx.ErrNoRows if there is none.
+func GetReprocessJob(ctx context.Context, id string) (ReprocessJob, error) {
+	return scanReprocessJob(DB.QueryRow(ctx, "SELECT "+reprocessJobColumns+" FROM reprocess_jobs WHERE id = $1", id))
+}
+
+// ListReprocessJobs returns the latest jobs, latest first.
+func ListReprocessJobs(ctx context.Context) ([]ReprocessJob, error) {
+	rows, err := DB.Query(ctx,
+		"SELECT "+reprocessJobColumns+" FROM reprocess_jobs ORDER BY created_at DESC LIMIT $1",
+		maxListedReprocessJobs)
+	if err != nil {
+		return nil, fmt.Errorf("listing reprocessing jobs: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ReprocessJob, error) {
+		return scanReprocessJob(row)
+	})
+}
+
+// CancelReprocessJob cancels a pending or running job, which stops after its current batch.
+func CancelReprocessJob(ctx context.Context, id string) (ReprocessJob, error) {
+	job, err := scanReprocessJob(DB.QueryRow(ctx, `
+		UPDATE reprocess_jobs SET status = $2, updated_at = now()
+		WHERE id = $1 AND status IN ($3, $4)
+		RETURNING `+reprocessJobColumns,
+		id, ReprocessCancelled, ReprocessPending, ReprocessRunning,
+	))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return job, err
+	}
+
+	// Either the job does not exist, which GetReprocessJob reports, or it already stopped.
+	if job, err = GetReprocessJob(ctx, id); err != nil {
+		return job, err
+	}
+
+	return job, fmt.Errorf("%w: %s", ErrReprocessJobDone, job.Status)
+}
+
+// RunReprocessJobs runs the reprocessing jobs, one at a time, until ctx is cancelled. The
+// replicas of udash all run it: a job is claimed by a single one, and taken over by another
+// one when the udash running it stops reporting progress.
+func RunReprocessJobs(ctx context.Context) {
+	for {
+		job, err := claimReprocessJob(ctx)
+
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+		case err != nil && ctx.Err() == nil:
+			logrus.WithContext(ctx).Errorf("claiming a reprocessing job: %s", err)
+		case err == nil:
+			runReprocessJob(ctx, job)
+			// Looking for the next job right away.
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reprocessPollInterval):
+		}
+	}
+}
+
+// claimReprocessJob marks the oldest pending job, or an abandoned one, as run by this udash.
+func claimReprocessJob(ctx context.Context) (ReprocessJob, error) {
+	return scanReprocessJob(DB.QueryRow(ctx, `
+		UPDATE reprocess_jobs SET status = $1, heartbeat_at = now(), updated_at = now()
+		WHERE id = (
+			SELECT id FROM reprocess_jobs
+			WHERE status = $2
+				OR (status = $1 AND heartbeat_at < now() - make_interval(secs => $3))
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+reprocessJobColumns,
+		ReprocessRunning, ReprocessPending, reprocessStaleAfter.Seconds(),
+	))
+}
+
+// runReprocessJob processes the reports of a claimed job, from where it stopped, until it
+// completes, fails or is cancelled. When ctx is cancelled, the job is handed back so that
+// the next udash to start resumes it.
+func runReprocessJob(ctx context.Context, job ReprocessJob) {
+	log := logrus.WithContext(ctx).WithField("job", job.ID)
+
+	// The scms, configs and labels are looked up before being inserted, see InsertReport.
+	ctx = WithPrimary(ctx)
+
+	filter := reportFilter{
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Labels:    job.Labels,
+	}
+
+	after := uuid.Nil
+	if job.lastReportID != nil {
+		after = *job.lastReportID
+		log.Infof("Resuming reprocessing job, %d of %d reports processed", job.Processed, job.Total)
+	} else {
+		total, err := countReports(ctx, filter)
+		if err != nil {
+			finishReprocessJob(ctx, job, ReprocessFailed, err)
+			return
+		}
+
+		job.Total = total
+		log.Infof("Starting reprocessing job of %d reports", total)
+	}
+
+	for {
+		batch, err := readReportBatch(ctx, after, job.BatchSize, filter)
+		if err != nil {
+			if ctx.Err() != nil {
+				releaseReprocessJob(job)
+				return
+			}
+			finishReprocessJob(ctx, job, ReprocessFailed, err)
+			return
+		}
+
+		if len(batch) == 0 {
+			finishReprocessJob(ctx, job, ReprocessCompleted, nil)
+			return
+		}
+
+		repairs := map[uuid.UUID]reportColumns{}
+
+		for _, r := range batch {
+			job.Processed++
+
+			computed, _, err := buildReportColumns(ctx, r.report, &r.columns, true)
+			if err != nil {
+				job.Failed++
+				job.Error = fmt.Sprintf("report %s: %s", r.id, err)
+				log.Warnf("reprocessing report %s: %s", r.id, err)
+				continue
+			}
+
+			if len(driftedColumns(r.columns, computed)) > 0 {
+				repairs[r.id] = computed
+			}
+		}
+
+		if err := repairReportColumns(ctx, repairs); err != nil {
+			if ctx.Err() != nil {
+				releaseReprocessJob(job)
+				return
+			}
+			finishReprocessJob(ctx, job, ReprocessFailed, err)
+			return
+		}
+
+		job.Updated += len(repairs)
+		after = batch[len(batch)-1].id
+		job.lastReportID = &after
+
+		running, err := saveReprocessProgress(ctx, job)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			releaseReprocessJob(job)
+			return
+		case err != nil:
+			finishReprocessJob(ctx, job, ReprocessFailed, err)
+			return
+		case !running:
+			log.Infof("Reprocessing job cancelled, %d of %d reports processed", job.Processed, job.Total)
+			return
+		}
+
+		log.Debugf("Reprocessed %d of %d reports", job.Processed, job.Total)
+
+		select {
+		case <-ctx.Done():
+			releaseReprocessJob(job)
+			return
+		case <-time.After(time.Duration(job.BatchDelayMs) * time.Millisecond):
+		}
+	}
+}
+
+// saveReprocessProgress records the progress of a running job, and reports whether it is
+// still running: it is not anymore once cancelled.
+func saveReprocessProgress(ctx context.Context, job ReprocessJob) (bool, error) {
+	tag, err := DB.Exec(ctx, `
+		UPDATE reprocess_jobs
+		SET last_report_id = $2, total = $3, processed = $4, updated = $5, failed = $6, error = $7,
+			heartbeat_at = now(), updated_at = now()
+		WHERE id = $1 AND status = $8`,
+		job.ID, job.lastReportID, job.Total, job.Processed, job.Updated, job.Failed, job.Error, ReprocessRunning,
+	)
+	if err != nil {
+		return false, fmt.Errorf("saving the progress of reprocessing job %s: %w", job.ID, err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// finishReprocessJob records the final status of a job, unless it was cancelled meanwhile.
+func finishReprocessJob(ctx context.Context, job ReprocessJob, status string, jobErr error) {
+	log := logrus.WithContext(ctx).WithField("job", job.ID)
+
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+		log.Errorf("Reprocessing job failed: %s", jobErr)
+	} else {
+		log.Infof("Reprocessing job completed: %d reports processed, %d updated, %d failed",
+			job.Processed, job.Updated, job.Failed)
+	}
+
+	_, err := DB.Exec(ctx, `
+		UPDATE reprocess_jobs
+		SET status = $2, last_report_id = $3, total = $4, processed = $5, updated = $6, failed = $7,
+			error = $8, updated_at = now()
+		WHERE id = $1 AND status = $9`,
+		job.ID, status, job.lastReportID, job.Total, job.Processed, job.Updated, job.Failed, job.Error,
+		ReprocessRunning,
+	)
+	if err != nil {
+		log.Errorf("recording the status of reprocessing job: %s", err)
+	}
+}
+
+// releaseReprocessJob hands a job back as pending when udash stops, along with the
+// progress of the batches completed, so that it resumes right away on the next start.
+func releaseReprocessJob(job ReprocessJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := DB.Exec(ctx, `
+		UPDATE reprocess_jobs
+		SET status = $2, heartbeat_at = NULL, total = $3, updated_at = now()
+		WHERE id = $1 AND status = $4`,
+		job.ID, ReprocessPending, job.Total, ReprocessRunning,
+	)
+	if err != nil {
+		logrus.Errorf("handing back reprocessing job %s: %s", job.ID, err)
+		return
+	}
+
+	logrus.Infof("Reprocessing job %s interrupted, %d of %d reports processed", job.ID, job.Processed, job.Total)
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/updatecli/udash/pkg/model"
+	"github.com/updatecli/udash/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/stephenafamo/bob/dialect/psql"
 	"github.com/stephenafamo/bob/dialect/psql/im"
@@ -27,7 +30,7 @@ func InsertSCM(ctx context.Context, url, branch string) (string, error) {
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return "", err
 	}
 
@@ -37,7 +40,7 @@ func InsertSCM(ctx context.Context, url, branch string) (string, error) {
 	)
 
 	if err != nil {
-		logrus.Errorf("query failed: %q\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %q\n\t%s", queryString, err)
 		return "", err
 	}
 
@@ -108,14 +111,14 @@ func GetSCM(ctx context.Context, params GetSCMParams) ([]model.SCM, int, error)
 	totalQuery := psql.Select(sm.From(query), sm.Columns("count(*)"))
 	totalQueryString, totalArgs, err := totalQuery.Build(ctx)
 	if err != nil {
-		logrus.Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
+		logrus.WithContext(ctx).Errorf("building total count query failed: %s\n\t%s", totalQueryString, err)
 		return nil, 0, err
 	}
 
-	if err = DB.QueryRow(ctx, totalQueryString, totalArgs...).Scan(
+	if err = readDB(ctx).QueryRow(ctx, totalQueryString, totalArgs...).Scan(
 		&totalCount,
 	); err != nil {
-		logrus.Errorf("parsing total count result: %s", err)
+		logrus.WithContext(ctx).Errorf("parsing total count result: %s", err)
 	}
 
 	applyPagination(&query, params.Limit, params.Page)
@@ -123,13 +126,13 @@ func GetSCM(ctx context.Context, params GetSCMParams) ([]model.SCM, int, error)
 	queryString, args, err := query.Build(ctx)
 
 	if err != nil {
-		logrus.Errorf("building query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("building query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 
-	rows, err := DB.Query(ctx, queryString, args...)
+	rows, err := readDB(ctx).Query(ctx, queryString, args...)
 	if err != nil {
-		logrus.Errorf("query failed: %s\n\t%s", queryString, err)
+		logrus.WithContext(ctx).Errorf("query failed: %s\n\t%s", queryString, err)
 		return nil, 0, err
 	}
 	defer rows.Close()
@@ -141,7 +144,7 @@ func GetSCM(ctx context.Context, params GetSCMParams) ([]model.SCM, int, error)
 
 		err = rows.Scan(&r.ID, &r.Branch, &r.URL, &r.Created_at, &r.Updated_at)
 		if err != nil {
-			logrus.Errorf("scanning scm row failed: %s", err)
+			logrus.WithContext(ctx).Errorf("scanning scm row failed: %s", err)
 			continue
 		}
 
@@ -178,6 +181,13 @@ type ScmSummaryData struct {
 	// single pull request grouping the changes of several pipelines is counted once there
 	// and once per pipeline here.
 	TotalOpenActionByResult map[string]int `json:"total_open_action_by_result"`
+	// TotalAcknowledgedByResult is a map of result types to the number of pipelines in that
+	// result which are acknowledged, a breakdown of TotalResultByType as well.
+	TotalAcknowledgedByResult map[string]int `json:"total_acknowledged_by_result"`
+	// TotalStaleByResult is a map of result types to the number of pipelines in that
+	// result which have not reported for longer than their reporting interval, a
+	// breakdown of TotalResultByType as well.
+	TotalStaleByResult map[string]int `json:"total_stale_by_result"`
 }
 
 // SCMBranchDataset represents a map of branches and their summary data for a single SCM URL.
@@ -199,11 +209,19 @@ type GetSCMSummaryParams struct {
 	// OpenAction restricts the summary to the pipelines which carry an open action, such as
 	// a pull request still waiting to be merged, or to the ones which do not. A nil value
 	// does not filter anything out.
-	OpenAction   *bool
+	OpenAction *bool
+	// Stale restricts the summary to the pipelines which have not reported for longer
+	// than their reporting interval, or to the ones which have. A nil value does not
+	// filter anything out.
+	Stale        *bool
 	TotalCount   int
 	TotalActions int
 	Ctx          context.Context
 	ScmRows      []model.SCM
+
+	// acknowledgements are the acknowledgements applying right now, read once for every
+	// scm.
+	acknowledgements []Acknowledgement
 }
 
 // GetSCMSummary returns a list of scms summary from the scm database table.
@@ -211,13 +229,21 @@ func GetSCMSummary(params GetSCMSummaryParams) (*SCMDataset, error) {
 
 	dataset := SCMDataset{}
 
+	if len(params.ScmRows) > 0 {
+		acknowledgements, err := ListAcknowledgements(params.Ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		params.acknowledgements = acknowledgements
+	}
+
 	for _, row := range params.ScmRows {
 
 		scmURL := row.URL
 		scmBranch := row.Branch
 
 		if scmBranch == "" || scmURL == "" {
-			logrus.Debugf("skipping scm %s, missing branch or url", row.ID)
+			logrus.WithContext(params.Ctx).Debugf("skipping scm %s, missing branch or url", row.ID)
 			continue
 		}
 
@@ -246,12 +272,28 @@ func GetSCMSummary(params GetSCMSummaryParams) (*SCMDataset, error) {
 // connection per scm until the whole summary is built.
 func getSingleSCMSummary(params GetSCMSummaryParams, row model.SCM) (ScmSummaryData, error) {
 
+	if params.Ctx == nil {
+		params.Ctx = context.Background()
+	}
+
+	// A span per scm tells which one a slow summary spent its time on, the queries
+	// themselves all look alike.
+	ctx, span := tracing.Tracer().Start(params.Ctx, "scm summary", trace.WithAttributes(
+		attribute.String("udash.scm.id", row.ID.String()),
+		attribute.String("udash.scm.url", row.URL),
+		attribute.String("udash.scm.branch", row.Branch),
+	))
+	defer span.End()
+	params.Ctx = ctx
+
 	scmID := row.ID
 
 	data := ScmSummaryData{
-		ID:                      scmID.String(),
-		TotalResultByType:       make(map[string]int),
-		TotalOpenActionByResult: make(map[string]int),
+		ID:                        scmID.String(),
+		TotalResultByType:         make(map[string]int),
+		TotalOpenActionByResult:   make(map[string]int),
+		TotalAcknowledgedByResult: make(map[string]int),
+		TotalStaleByResult:        make(map[string]int),
 	}
 
 	filteredSCMsQuery := psql.Select(
@@ -261,7 +303,7 @@ func getSingleSCMSummary(params GetSCMSummaryParams, row model.SCM) (ScmSummaryD
 				psql.Arg(fmt.Sprintf("{%s}", scmID)),
 			),
 		),
-		sm.Columns("id", "data", "updated_at"),
+		sm.Columns("id", "pipeline_id", "data", "updated_at"),
 	)
 
 	if err := applyRangeFilter(
@@ -295,7 +337,14 @@ func getSingleSCMSummary(params GetSCMSummaryParams, row model.SCM) (ScmSummaryD
 		// The action URLs are read with the same jsonpath as openActionSQLExpr, so that
 		// a pipeline counted as carrying an open action here is the one the reports
 		// search and the reports summary would return too.
-		sm.Columns("id", "data ->> 'Result'", "jsonb_path_query_array(data, '$.Actions.*.actionUrl')"),
+		sm.Columns(
+			"id",
+			"data ->> 'ID'",
+			"data ->> 'Result'",
+			"jsonb_path_query_array(data, '$.Actions.*.actionUrl')",
+			"COALESCE(data -> 'Labels', '{}')",
+			staleSQL("filtered_reports", payloadLabelsSQL("filtered_reports")),
+		),
 		sm.From("filtered_reports"),
 		sm.OrderBy(psql.Raw("data ->> 'ID'")),
 		sm.OrderBy(psql.Quote("updated_at")).Desc(),
@@ -306,7 +355,7 @@ func getSingleSCMSummary(params GetSCMSummaryParams, row model.SCM) (ScmSummaryD
 		return data, fmt.Errorf("building scm summary query: %w", err)
 	}
 
-	rows, err := DB.Query(params.Ctx, queryString, queryArgs...)
+	rows, err := readDB(params.Ctx).Query(params.Ctx, queryString, queryArgs...)
 	if err != nil {
 		return data, fmt.Errorf("querying scm summary: %w", err)
 	}
@@ -317,10 +366,13 @@ func getSingleSCMSummary(params GetSCMSummaryParams, row model.SCM) (ScmSummaryD
 	for rows.Next() {
 
 		id := ""
+		pipelineID := ""
 		result := ""
 		actionUrls := []string{}
+		labels := map[string]string{}
+		stale := false
 
-		if err := rows.Scan(&id, &result, &actionUrls); err != nil {
+		if err := rows.Scan(&id, &pipelineID, &result, &actionUrls, &labels, &stale); err != nil {
 			return data, fmt.Errorf("scanning scm summary row: %w", err)
 		}
 
@@ -340,12 +392,24 @@ func getSingleSCMSummary(params GetSCMSummaryParams, row model.SCM) (ScmSummaryD
 			continue
 		}
 
+		if params.Stale != nil && *params.Stale != stale {
+			continue
+		}
+
 		data.TotalResultByType[result]++
 
 		if hasOpenAction {
 			data.TotalOpenActionByResult[result]++
 		}
 
+		if acknowledgementOf(params.acknowledgements, pipelineID, labels) != nil {
+			data.TotalAcknowledgedByResult[result]++
+		}
+
+		if stale {
+			data.TotalStaleByResult[result]++
+		}
+
 		for i := range actionUrls {
 			isActionURLsFound[actionUrls[i]] = true
 		}
@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+// minReportingInterval is the shortest reporting interval accepted, the stale pipelines
+// are looked for every few minutes anyway.
+const minReportingInterval = time.Minute
+
+// ErrInvalidReportingInterval is returned when creating a reporting interval from invalid
+// parameters.
+var ErrInvalidReportingInterval = errors.New("invalid reporting interval")
+
+// ReportingInterval is how often the pipelines it selects are expected to publish a report.
+// A pipeline whose latest report is older than that is stale.
+//
+// A pipeline is selected by the interval of its id first, then by the intervals of the
+// labels of its latest report, then by the interval without any selector, the shortest one
+// winning among several of the same kind.
+type ReportingInterval struct {
+	ID uuid.UUID `json:"id"`
+	// PipelineID selects a single pipeline, Labels the pipelines carrying every one of
+	// them, and neither every pipeline.
+	PipelineID string            `json:"pipeline_id,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// IntervalSeconds is the longest a pipeline may go without reporting, in seconds.
+	IntervalSeconds int       `json:"interval_seconds"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// NewReportingInterval describes a reporting interval to record.
+type NewReportingInterval struct {
+	// PipelineID and Labels select the pipelines, they cannot be combined. An interval
+	// without either applies to every pipeline.
+	PipelineID string
+	Labels     map[string]string
+	// Interval is at least a minute.
+	Interval time.Duration
+}
+
+// payloadLabelsSQL returns the expression of the labels of a report of the provided table,
+// read out of its payload: the ones the report was published with.
+func payloadLabelsSQL(table string) string {
+	return table + ".data -> 'Labels'"
+}
+
+// storedLabelsSQL returns the expression of the labels of a report of the provided table,
+// read through its label_ids rather than out of its payload, which is then left untouched.
+func storedLabelsSQL(table string) string {
+	return fmt.Sprintf(`COALESCE((
+	SELECT jsonb_object_agg(labels.key, labels.value) FROM labels WHERE labels.id = ANY(%s.label_ids)
+), '{}')`, table)
+}
+
+// expectedIntervalSQL returns the expression of the reporting interval expected of the
+// pipeline of a report of the provided table, in seconds, null when none is.
+//
+// The intervals are matched against labels, the expression of the labels of the report,
+// payloadLabelsSQL as the acknowledgements are unless the payload is not to be read.
+func expectedIntervalSQL(table, labels string) string {
+	return fmt.Sprintf(`(
+	SELECT reporting_intervals.interval_seconds FROM reporting_intervals
+	WHERE (reporting_intervals.pipeline_id <> '' AND reporting_intervals.pipeline_id = %[1]s.pipeline_id)
+		OR (reporting_intervals.pipeline_id = '' AND (
+			reporting_intervals.labels = '{}' OR %[2]s @> reporting_intervals.labels
+		))
+	ORDER BY reporting_intervals.pipeline_id <> '' DESC, reporting_intervals.labels <> '{}' DESC,
+		reporting_intervals.interval_seconds
+	LIMIT 1
+)`, table, labels)
+}
+
+// staleSQL returns the expression true of the reports of the provided table whose pipeline
+// is stale: its latest report, whichever it is, is older than its reporting interval. A
+// pipeline without any reporting interval is never stale. See expectedIntervalSQL for labels.
+//
+// idx_pipelinereports_pipeline_id_updated_at makes the latest report a single index scan.
+func staleSQL(table, labels string) string {
+	return fmt.Sprintf(`(%[1]s.pipeline_id <> '' AND COALESCE((
+	SELECT max(latest.updated_at) FROM pipelineReports AS latest WHERE latest.pipeline_id = %[1]s.pipeline_id
+) < localtimestamp - make_interval(secs => %[2]s), false))`, table, expectedIntervalSQL(table, labels))
+}
+
+// applyStaleFilter restricts the given query on pipelineReports to the reports of the stale
+// pipelines, or to the ones of the pipelines which are not. A nil stale does not filter
+// anything out. See expectedIntervalSQL for labels.
+func applyStaleFilter(query *bob.BaseQuery[*dialect.SelectQuery], stale *bool, labels string) {
+	if stale == nil {
+		return
+	}
+
+	query.Apply(sm.Where(psql.Raw(staleSQL("pipelineReports", labels)+" = ?", psql.Arg(*stale))))
+}
+
+// reportingIntervalColumns are the columns scanned by scanReportingInterval, in its order.
+const reportingIntervalColumns = "id, pipeline_id, labels, interval_seconds, created_at"
+
+func scanReportingInterval(row pgx.Row) (ReportingInterval, error) {
+	i := ReportingInterval{}
+
+	err := row.Scan(
+		&i.ID,
+		&i.PipelineID,
+		&i.Labels,
+		&i.IntervalSeconds,
+		&i.CreatedAt,
+	)
+
+	return i, err
+}
+
+// CreateReportingInterval records a reporting interval, which applies right away.
+func CreateReportingInterval(ctx context.Context, n NewReportingInterval) (ReportingInterval, error) {
+	switch {
+	case n.PipelineID != "" && len(n.Labels) > 0:
+		return ReportingInterval{}, fmt.Errorf("%w: a pipeline id and labels cannot be combined", ErrInvalidReportingInterval)
+	case n.Interval < minReportingInterval:
+		return ReportingInterval{}, fmt.Errorf("%w: the interval must be at least %s", ErrInvalidReportingInterval, minReportingInterval)
+	}
+
+	for key := range n.Labels {
+		if key == "" {
+			return ReportingInterval{}, fmt.Errorf("%w: label key cannot be empty", ErrInvalidReportingInterval)
+		}
+	}
+
+	labels := n.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	i, err := scanReportingInterval(DB.QueryRow(ctx, `
+		INSERT INTO reporting_intervals (pipeline_id, labels, interval_seconds)
+		VALUES ($1, $2, $3)
+		RETURNING `+reportingIntervalColumns,
+		n.PipelineID, labels, int(n.Interval.Seconds()),
+	))
+	if err != nil {
+		return i, fmt.Errorf("recording reporting interval: %w", err)
+	}
+
+	return i, nil
+}
+
+// ListReportingIntervals returns the reporting intervals, latest first.
+func ListReportingIntervals(ctx context.Context) ([]ReportingInterval, error) {
+	rows, err := DB.Query(ctx, "SELECT "+reportingIntervalColumns+" FROM reporting_intervals ORDER BY created_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("listing reporting intervals: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ReportingInterval, error) {
+		return scanReportingInterval(row)
+	})
+}
+
+// DeleteReportingInterval deletes a reporting interval, pgx.ErrNoRows if there is none.
+func DeleteReportingInterval(ctx context.Context, id string) error {
+	tag, err := DB.Exec(ctx, "DELETE FROM reporting_intervals WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("deleting reporting interval %s: %w", id, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// NewlyStalePipeline is a pipeline which went stale since it was last notified.
+type NewlyStalePipeline struct {
+	// ReportID is the id of the latest report of the pipeline, and Report the report.
+	ReportID string
+	Report   reports.Report
+	// LastReportAt is when the latest report was published.
+	LastReportAt time.Time
+	// Interval is the reporting interval the pipeline missed.
+	Interval time.Duration
+}
+
+// ClaimStalePipelines returns the pipelines which went stale since they were last returned,
+// for the caller to notify. A pipeline is returned once per latest report, by a single
+// udash: it is returned again only once it reported and went stale anew.
+func ClaimStalePipelines(ctx context.Context) ([]NewlyStalePipeline, error) {
+	rows, err := DB.Query(ctx, `
+		WITH latest AS (
+			SELECT DISTINCT ON (pipeline_id) id, pipeline_id, data, updated_at
+			FROM pipelineReports
+			WHERE pipeline_id <> ''
+			ORDER BY pipeline_id, updated_at DESC
+		), stale AS (
+			SELECT * FROM (
+				SELECT latest.*, `+expectedIntervalSQL("latest", payloadLabelsSQL("latest"))+` AS interval_seconds FROM latest
+			) AS expected
+			WHERE updated_at < localtimestamp - make_interval(secs => interval_seconds)
+		), claimed AS (
+			INSERT INTO stale_pipelines (pipeline_id, report_id)
+			SELECT pipeline_id, id FROM stale
+			ON CONFLICT (pipeline_id) DO UPDATE SET report_id = EXCLUDED.report_id, notified_at = now()
+			WHERE stale_pipelines.report_id <> EXCLUDED.report_id
+			RETURNING report_id
+		)
+		SELECT stale.id::text, stale.data, EXTRACT(EPOCH FROM (localtimestamp - stale.updated_at))::float8,
+			stale.interval_seconds
+		FROM stale
+		JOIN claimed ON claimed.report_id = stale.id
+		ORDER BY stale.updated_at`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("claiming the stale pipelines: %w", err)
+	}
+
+	now := time.Now()
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (NewlyStalePipeline, error) {
+		p := NewlyStalePipeline{}
+		age := 0.0
+		intervalSeconds := 0
+
+		if err := row.Scan(&p.ReportID, &p.Report, &age, &intervalSeconds); err != nil {
+			return p, fmt.Errorf("parsing a stale pipeline: %w", err)
+		}
+
+		// The age is computed by the database, see SearchStalePipelines.
+		p.LastReportAt = now.Add(-time.Duration(age * float64(time.Second)))
+		p.Interval = time.Duration(intervalSeconds) * time.Second
+
+		return p, nil
+	})
+}
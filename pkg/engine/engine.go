@@ -1,35 +1,216 @@
 package engine
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/udash/pkg/logging"
+	"github.com/updatecli/udash/pkg/notification"
 	"github.com/updatecli/udash/pkg/server"
+	"github.com/updatecli/udash/pkg/tracing"
 )
 
+// tracingFlushTimeout bounds how long the pending spans are flushed for on shutdown.
+const tracingFlushTimeout = 5 * time.Second
+
 type Options struct {
-	Database database.Options
-	Server   server.Options
+	Logging      logging.Options
+	Database     database.Options
+	Server       server.Options
+	Tracing      tracing.Options
+	Notification notification.Options
 }
 
 type Engine struct {
 	Options Options
+
+	// mu guards Options against a reload.
+	mu     sync.Mutex
+	server *server.Server
 }
 
+// Start runs udash until it receives SIGTERM or SIGINT. The server is then given the chance
+// to complete the requests it is serving before the database pool is closed, so that a
+// report being inserted while udash stops is not lost.
 func (e *Engine) Start() error {
-	if err := database.Connect(e.Options.Database); err != nil {
+	// A reload may replace the options while udash starts.
+	e.mu.Lock()
+	o := e.Options
+	e.mu.Unlock()
+
+	if err := logging.Configure(o.Logging); err != nil {
+		return fmt.Errorf("configuring logging: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Start(ctx, o.Tracing)
+	if err != nil {
+		return fmt.Errorf("starting tracing: %w", err)
+	}
+	// Deferred first so that it runs last, once the spans of the requests being completed
+	// on shutdown have ended. ctx is cancelled by then, the flush needs a deadline of its own.
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+
+		if err := shutdownTracing(flushCtx); err != nil {
+			logrus.Errorf("flushing the pending spans: %s", err)
+		}
+	}()
+
+	if err := notification.Configure(o.Notification); err != nil {
+		return fmt.Errorf("invalid notification options: %w", err)
+	}
+
+	if err := database.Connect(ctx, o.Database); err != nil {
 		return fmt.Errorf("connecting to database: %w", err)
 	}
+	defer database.Close()
 
-	if !e.Options.Database.MigrationDisabled {
-		if err := database.RunMigrationUp(); err != nil {
+	if o.Database.MigrationDisabled {
+		if err := database.WaitForSchema(ctx); err != nil {
+			return fmt.Errorf("waiting for the database schema: %w", err)
+		}
+	} else {
+		if err := database.RunMigrationUp(ctx); err != nil {
 			return fmt.Errorf("running migrations: %w", err)
 		}
 	}
 
-	s := server.Server{
+	// The background goroutines only return once ctx is cancelled, which the signals alone
+	// do not when the server fails to start.
+	ctx, cancel := context.WithCancel(ctx)
+
+	// The reprocessing jobs stop along with the server, before the database pool is closed.
+	reprocessDone := make(chan struct{})
+	go func() {
+		defer close(reprocessDone)
+		database.RunReprocessJobs(ctx)
+	}()
+	defer func() { <-reprocessDone }()
+
+	// The notifications are queued as the reports are inserted, then recorded and sent in
+	// the background.
+	defer database.OnReportInserted(notification.ReportInserted)()
+	notificationDone := make(chan struct{})
+	go func() {
+		defer close(notificationDone)
+		notification.Run(ctx)
+	}()
+	defer func() { <-notificationDone }()
+
+	// The reports inserted by any replica are streamed by every one, through Postgres.
+	defer database.OnReportInserted(database.PublishReportInserted)()
+	listenDone := make(chan struct{})
+	go func() {
+		defer close(listenDone)
+		database.ListenReports(ctx)
+	}()
+	defer func() { <-listenDone }()
+	// Deferred after the waits on the goroutines so that it runs before them.
+	defer cancel()
+
+	// The server options are read again, a reload may have replaced them since.
+	e.mu.Lock()
+	e.server = &server.Server{
 		Options: e.Options.Server,
 	}
+	e.mu.Unlock()
+
+	return e.server.Run(ctx)
+}
+
+// Reload applies the options which can change while udash runs: the log format and level,
+// the notification options, and the server options listed by server.Server.Reload. The new
+// options are validated as a whole first, none of them is applied when any is invalid.
+//
+// The options which changed but are only read on startup, such as the database URI or the
+// listen address, are logged as requiring a restart.
+func (e *Engine) Reload(o Options) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	restartRequired := []string{}
+
+	if e.server != nil {
+		changed, err := e.server.Reload(o.Server)
+		if err != nil {
+			return fmt.Errorf("invalid server options: %w", err)
+		}
+		restartRequired = append(restartRequired, changed...)
+	}
+
+	if err := logging.Configure(o.Logging); err != nil {
+		return fmt.Errorf("configuring logging: %w", err)
+	}
+
+	if err := notification.Configure(o.Notification); err != nil {
+		return fmt.Errorf("configuring notifications: %w", err)
+	}
+
+	if !reflect.DeepEqual(e.Options.Database, o.Database) {
+		restartRequired = append(restartRequired, "database")
+	}
+
+	if !reflect.DeepEqual(e.Options.Tracing, o.Tracing) {
+		restartRequired = append(restartRequired, "tracing")
+	}
+
+	for _, name := range restartRequired {
+		logrus.Warnf("Configuration change of %q requires a restart to take effect", name)
+	}
+
+	// The options requiring a restart keep describing what is running.
+	o.Database = e.Options.Database
+	o.Tracing = e.Options.Tracing
+	if e.server != nil {
+		o.Server = e.server.Options
+	}
+	e.Options = o
+
+	logrus.Infoln("Configuration reloaded")
+
+	return nil
+}
+
+// validate reports the options which cannot be applied, once initialized as they are when
+// applied, so that applying any of them cannot fail afterwards.
+func (o Options) validate() error {
+	loggingOptions := o.Logging
+	loggingOptions.Init()
+	if err := loggingOptions.Validate(); err != nil {
+		return fmt.Errorf("invalid logging options: %w", err)
+	}
+
+	if err := o.Database.Validate(); err != nil {
+		return fmt.Errorf("invalid database options: %w", err)
+	}
+
+	notificationOptions := o.Notification
+	notificationOptions.Init()
+	if err := notificationOptions.Validate(); err != nil {
+		return fmt.Errorf("invalid notification options: %w", err)
+	}
+
+	serverOptions := o.Server
+	serverOptions.Init()
+	if err := serverOptions.Validate(); err != nil {
+		return fmt.Errorf("invalid server options: %w", err)
+	}
 
-	return s.Run()
+	return nil
 }
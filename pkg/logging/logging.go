@@ -0,0 +1,127 @@
+// Package logging configures the logrus output of udash, and carries the id of the request
+// being served so that every line logged while serving it can be correlated.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatText logs human readable lines
+	FormatText string = "text"
+	// FormatJSON logs a JSON document per line
+	FormatJSON string = "json"
+)
+
+// Options defines the log output.
+type Options struct {
+	// Format is either "text" or "json".
+	// Default to "text"
+	Format string
+	// Level is the minimum level logged, such as "debug", "info" or "warning".
+	// Default to "info", or to "debug" when the --debug flag is set
+	Level string
+}
+
+// Init reads the environment variables of the unset options.
+func (o *Options) Init() {
+	if o.Format == "" {
+		o.Format = os.Getenv("UDASH_LOG_FORMAT")
+	}
+
+	if o.Level == "" {
+		o.Level = os.Getenv("UDASH_LOG_LEVEL")
+	}
+}
+
+// Validate reports an unknown format or level. They are errors rather than silently ignored,
+// a deployment expecting JSON lines would otherwise lose every one of them to its log pipeline.
+func (o Options) Validate() error {
+	switch strings.ToLower(o.Format) {
+	case "", FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("unsupported log format %q, accepted values are %q and %q", o.Format, FormatText, FormatJSON)
+	}
+
+	if o.Level != "" {
+		if _, err := logrus.ParseLevel(o.Level); err != nil {
+			return fmt.Errorf("parsing log level: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Configure applies the options to the standard logrus logger. It can be called again to
+// apply new options, such as a new level.
+func Configure(o Options) error {
+	o.Init()
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	if strings.ToLower(o.Format) == FormatJSON {
+		logrus.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}
+
+	// An unset level is the default one, so that removing it from the configuration
+	// brings the level back to info rather than leaving it where it was.
+	level := logrus.InfoLevel
+	if o.Level != "" {
+		level, _ = logrus.ParseLevel(o.Level)
+	}
+	logrus.SetLevel(level)
+
+	addHook.Do(func() {
+		logrus.AddHook(requestIDHook{})
+	})
+
+	return nil
+}
+
+// addHook registers requestIDHook once, however many times the options are applied.
+var addHook sync.Once
+
+// requestIDKey is the context key the id of the request is stored under.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the id of the request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the id of the request ctx was derived from, if any.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDHook adds the id of the request to the log lines given a context, as in
+// logrus.WithContext(ctx).
+type requestIDHook struct{}
+
+func (requestIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (requestIDHook) Fire(entry *logrus.Entry) error {
+	if id := RequestID(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+
+	return nil
+}
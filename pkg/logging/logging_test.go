@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+		logrus.SetLevel(logrus.InfoLevel)
+	})
+
+	assert.NoError(t, Configure(Options{Format: "JSON", Level: "warning"}))
+	assert.IsType(t, &logrus.JSONFormatter{}, logrus.StandardLogger().Formatter)
+	assert.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+
+	assert.Error(t, Configure(Options{Format: "logfmt"}))
+	assert.Error(t, Configure(Options{Level: "verbose"}))
+}
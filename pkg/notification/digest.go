@@ -0,0 +1,361 @@
+package notification
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/result"
+)
+
+const (
+	// digestTimeout bounds the summary and the sending of a digest.
+	digestTimeout = 2 * time.Minute
+	// maxDigestEntries caps the entries of every list of a digest.
+	maxDigestEntries = 50
+	// digestTimeLayout is how the times of a digest are displayed.
+	digestTimeLayout = "2006-01-02 15:04 MST"
+	// timeRangeLayout is the layout of the time ranges of the summaries of pkg/database.
+	timeRangeLayout = "2006-01-02 15:04:05Z07:00"
+)
+
+var (
+	// ErrUnknownDigest is returned when sending a digest which is not configured.
+	ErrUnknownDigest = errors.New("unknown digest")
+
+	//go:embed templates
+	digestTemplates embed.FS
+
+	digestText = texttemplate.Must(texttemplate.ParseFS(digestTemplates, "templates/digest.txt.tmpl"))
+	digestHTML = htmltemplate.Must(htmltemplate.ParseFS(digestTemplates, "templates/digest.html.tmpl"))
+)
+
+// digestSummary is what a digest tells about the pipelines over its period.
+type digestSummary struct {
+	Name  string
+	Start string
+	End   string
+	// Reports is the number of reports published over the period, and Results their
+	// number per result.
+	Reports int
+	Results []resultCount
+	// Days lists the reports published per day.
+	Days []digestDay
+	// SCMs lists the scms of the pipelines which failed, or left an action open, the most
+	// failing first.
+	SCMs     []digestSCM
+	MoreSCMs int
+	// OpenedActions lists the actions opened over the period.
+	OpenedActions     []database.OpenedAction
+	MoreOpenedActions int
+	// Stale lists the pipelines which have not reported for longer than their reporting
+	// interval, or than StaleAfter for the ones without any.
+	Stale      []digestStalePipeline
+	MoreStale  int
+	StaleAfter string
+}
+
+type resultCount struct {
+	Result string
+	Count  int
+}
+
+type digestDay struct {
+	Date     string
+	Reports  int
+	Failures int
+}
+
+type digestSCM struct {
+	URL         string
+	Branch      string
+	Pipelines   int
+	Failures    int
+	OpenActions int
+}
+
+type digestStalePipeline struct {
+	Name         string
+	Result       string
+	LastReportAt string
+	// Interval is the reporting interval of the pipeline, empty when it has none.
+	Interval string
+}
+
+// summarizeDigest summarizes the pipelines selected by a digest over the period ending at
+// end, with the same queries as the reports and scms summaries of the API.
+func summarizeDigest(ctx context.Context, d Digest, end time.Time) (digestSummary, error) {
+	location := time.UTC
+	if s, err := d.schedule(); err == nil {
+		location = s.location
+	}
+
+	start := end.Add(-d.Period)
+	startTime, endTime := start.UTC().Format(timeRangeLayout), end.UTC().Format(timeRangeLayout)
+
+	summary := digestSummary{
+		Name:       d.Name,
+		Start:      start.In(location).Format(digestTimeLayout),
+		End:        end.In(location).Format(digestTimeLayout),
+		StaleAfter: d.StaleAfter.String(),
+	}
+
+	// The summary is bucketed per day, it covers the whole days of the period.
+	days, total, err := database.SearchReportsSummary(database.ReportSummaryParams{
+		Ctx:         ctx,
+		Granularity: database.SummaryGranularityDay,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Labels:      d.Labels,
+	})
+	if err != nil {
+		return summary, fmt.Errorf("summarizing the reports: %w", err)
+	}
+
+	summary.Reports = total
+	perResult := map[string]int{}
+	for _, day := range days {
+		summary.Days = append(summary.Days, digestDay{
+			Date:     strings.TrimSuffix(day.Date, "T00:00:00Z"),
+			Reports:  day.Total,
+			Failures: day.Results[result.FAILURE],
+		})
+
+		for r, count := range day.Results {
+			perResult[r] += count
+		}
+	}
+
+	for _, r := range []string{result.SUCCESS, result.FAILURE, result.ATTENTION, result.SKIPPED} {
+		summary.Results = append(summary.Results, resultCount{Result: r, Count: perResult[r]})
+	}
+
+	scmRows, _, err := database.GetSCM(ctx, database.GetSCMParams{StartTime: startTime, EndTime: endTime})
+	if err != nil {
+		return summary, fmt.Errorf("listing the scms: %w", err)
+	}
+
+	scms, err := database.GetSCMSummary(database.GetSCMSummaryParams{
+		Ctx:       ctx,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Labels:    d.Labels,
+		ScmRows:   scmRows,
+	})
+	if err != nil {
+		return summary, fmt.Errorf("summarizing the scms: %w", err)
+	}
+
+	for url, branches := range scms.Data {
+		for branch, data := range branches {
+			if data.TotalResultByType[result.FAILURE] == 0 && data.TotalActionURLs == 0 {
+				continue
+			}
+
+			summary.SCMs = append(summary.SCMs, digestSCM{
+				URL:         url,
+				Branch:      branch,
+				Pipelines:   data.TotalResult,
+				Failures:    data.TotalResultByType[result.FAILURE],
+				OpenActions: data.TotalActionURLs,
+			})
+		}
+	}
+
+	slices.SortFunc(summary.SCMs, func(a, b digestSCM) int {
+		return cmp.Or(
+			cmp.Compare(b.Failures, a.Failures),
+			cmp.Compare(b.OpenActions, a.OpenActions),
+			strings.Compare(a.URL, b.URL),
+			strings.Compare(a.Branch, b.Branch),
+		)
+	})
+	summary.SCMs, summary.MoreSCMs = truncated(summary.SCMs)
+
+	opened, err := database.SearchOpenedActions(ctx, database.SearchOpenedActionsParams{
+		Start:  start,
+		End:    end,
+		Labels: d.Labels,
+	})
+	if err != nil {
+		return summary, fmt.Errorf("searching the opened actions: %w", err)
+	}
+	summary.OpenedActions, summary.MoreOpenedActions = truncated(opened)
+
+	stale, err := database.SearchStalePipelines(ctx, database.SearchStalePipelinesParams{
+		StaleAfter: d.StaleAfter,
+		Labels:     d.Labels,
+	})
+	if err != nil {
+		return summary, fmt.Errorf("searching the stale pipelines: %w", err)
+	}
+
+	for _, p := range stale {
+		name := p.Name
+		if name == "" {
+			name = p.ID
+		}
+
+		interval := ""
+		if p.Interval > 0 {
+			interval = p.Interval.String()
+		}
+
+		summary.Stale = append(summary.Stale, digestStalePipeline{
+			Name:         name,
+			Result:       p.Result,
+			LastReportAt: p.LastReportAt.In(location).Format(digestTimeLayout),
+			Interval:     interval,
+		})
+	}
+	summary.Stale, summary.MoreStale = truncated(summary.Stale)
+
+	return summary, nil
+}
+
+// truncated returns the first entries of a list of a digest, and how many are left out.
+func truncated[T any](entries []T) ([]T, int) {
+	if len(entries) <= maxDigestEntries {
+		return entries, 0
+	}
+
+	return entries[:maxDigestEntries], len(entries) - maxDigestEntries
+}
+
+// render returns the email of a digest.
+func (s digestSummary) render(d Digest) (email, error) {
+	var text, html bytes.Buffer
+
+	if err := digestText.Execute(&text, s); err != nil {
+		return email{}, fmt.Errorf("rendering the text digest: %w", err)
+	}
+
+	if err := digestHTML.Execute(&html, s); err != nil {
+		return email{}, fmt.Errorf("rendering the html digest: %w", err)
+	}
+
+	return email{
+		To:      d.To,
+		Subject: d.Subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// sendDigest summarizes the period of a digest ending at end, and sends it.
+func sendDigest(ctx context.Context, o Options, d Digest, end time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, digestTimeout)
+	defer cancel()
+
+	summary, err := summarizeDigest(ctx, d, end)
+	if err != nil {
+		return err
+	}
+
+	m, err := summary.render(d)
+	if err != nil {
+		return err
+	}
+
+	return sendEmail(ctx, o.SMTP, m)
+}
+
+// SendDigest sends a digest right away, over the period ending now, whatever its schedule.
+// It returns ErrUnknownDigest when the digest is not configured.
+func SendDigest(ctx context.Context, name string) error {
+	o := currentOptions()
+
+	d, found := o.digest(name)
+	if !found {
+		return fmt.Errorf("%w: %q", ErrUnknownDigest, name)
+	}
+
+	return sendDigest(ctx, o, d, time.Now())
+}
+
+// digestScheduler tracks when every digest is due next.
+type digestScheduler struct {
+	// next is when every digest is due, per name and schedule, so that a digest whose
+	// schedule is reloaded is scheduled again.
+	next map[string]time.Time
+}
+
+// sendDue sends the digests due at now, unless another udash already did.
+func (s *digestScheduler) sendDue(ctx context.Context, now time.Time) {
+	o := currentOptions()
+
+	if s.next == nil {
+		s.next = map[string]time.Time{}
+	}
+
+	configured := map[string]bool{}
+
+	for _, d := range o.Digests {
+		key := d.Name + "\x00" + d.Schedule + "\x00" + d.Timezone
+		configured[key] = true
+
+		sched, err := d.schedule()
+		if err != nil {
+			continue
+		}
+
+		due, found := s.next[key]
+		if !found || due.IsZero() {
+			s.next[key] = sched.next(now)
+			continue
+		}
+
+		if now.Before(due) {
+			continue
+		}
+
+		// A digest missed while every udash was stopped is not sent afterwards.
+		s.next[key] = sched.next(now)
+
+		log := logrus.WithContext(ctx).WithField("digest", d.Name)
+
+		claimed, err := database.ClaimNotificationDigest(ctx, d.Name, due)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("%s", err)
+			}
+			continue
+		}
+
+		if !claimed {
+			log.Debugf("Digest of %s already sent by another udash", due.UTC().Format(time.RFC3339))
+			continue
+		}
+
+		errorMessage := ""
+		if err := sendDigest(ctx, o, d, due); err != nil {
+			errorMessage = err.Error()
+			log.Errorf("Digest not sent: %s", err)
+		} else {
+			log.Infof("Digest sent to %s", strings.Join(d.To, ", "))
+		}
+
+		// Recorded even when udash stops meanwhile.
+		recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		if err := database.RecordNotificationDigest(recordCtx, d.Name, due, errorMessage); err != nil {
+			log.Errorf("%s", err)
+		}
+		cancel()
+	}
+
+	for key := range s.next {
+		if !configured[key] {
+			delete(s.next, key)
+		}
+	}
+}
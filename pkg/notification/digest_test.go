@@ -0,0 +1,316 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+func TestSchedule(t *testing.T) {
+	brussels, err := time.LoadLocation("Europe/Brussels")
+	require.NoError(t, err)
+
+	// A saturday.
+	from := time.Date(2026, 10, 17, 10, 30, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		spec     string
+		location *time.Location
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.UTC, time.Date(2026, 10, 17, 10, 45, 0, 0, time.UTC)},
+		{"@hourly", time.UTC, time.Date(2026, 10, 17, 11, 0, 0, 0, time.UTC)},
+		{"0 8 * * MON", time.UTC, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.UTC, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"@weekly", time.UTC, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.UTC, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"30 9 1 * *", time.UTC, time.Date(2026, 11, 1, 9, 30, 0, 0, time.UTC)},
+		// Either day field matches when neither is "*".
+		{"0 0 1 * SUN", time.UTC, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 6 * * *", brussels, time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec, tt.location)
+			require.NoError(t, err)
+
+			assert.True(t, tt.expected.Equal(s.next(from)), "got %s", s.next(from))
+		})
+	}
+
+	s, err := parseSchedule("0 0 30 2 *", time.UTC)
+	require.NoError(t, err)
+	assert.True(t, s.next(from).IsZero())
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * * MOON", "5-1 * * * *", "*/0 * * * *"} {
+		_, err := parseSchedule(spec, time.UTC)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestDigestOptions(t *testing.T) {
+	o := Options{
+		SMTP:    SMTPOptions{Host: "smtp.example", From: "udash <udash@example.com>"},
+		Digests: []Digest{{Name: "weekly", Schedule: "@weekly", To: []string{"team@example.com"}}},
+	}
+	o.Init()
+	require.NoError(t, o.Validate())
+
+	assert.Equal(t, 587, o.SMTP.Port)
+	assert.Equal(t, SMTPStartTLS, o.SMTP.Security)
+	assert.Equal(t, 7*24*time.Hour, o.Digests[0].Period)
+	assert.Equal(t, o.Digests[0].Period, o.Digests[0].StaleAfter)
+	assert.Equal(t, "udash digest: weekly", o.Digests[0].Subject)
+
+	invalid := Options{
+		SMTP: SMTPOptions{Security: "ssl"},
+		Digests: []Digest{
+			{Name: "weekly", Schedule: "every week", Timezone: "Mars/Olympus"},
+			{Name: "weekly", Schedule: "@weekly", To: []string{"not an address"}},
+		},
+	}
+
+	err := invalid.Validate()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `unsupported security "ssl"`)
+	assert.ErrorContains(t, err, "a host and a sender are required")
+	assert.ErrorContains(t, err, `invalid time zone "Mars/Olympus"`)
+	assert.ErrorContains(t, err, `digest "weekly": missing recipient`)
+	assert.ErrorContains(t, err, `digest "weekly": duplicated name`)
+	assert.ErrorContains(t, err, `invalid recipient "not an address"`)
+}
+
+func TestDigestEmail(t *testing.T) {
+	summary := digestSummary{
+		Name:    "weekly",
+		Start:   "2026-10-11 08:00 UTC",
+		End:     "2026-10-18 08:00 UTC",
+		Reports: 12,
+		Results: []resultCount{{Result: "✔", Count: 10}, {Result: "✗", Count: 2}},
+		Days:    []digestDay{{Date: "2026-10-17", Reports: 12, Failures: 2}},
+		SCMs: []digestSCM{
+			{URL: "https://github.com/updatecli/udash.git", Branch: "main", Pipelines: 3, Failures: 2, OpenActions: 1},
+		},
+		OpenedActions: []database.OpenedAction{
+			{PipelineID: "deps", PipelineName: "Bump <deps>", URL: "https://github.com/updatecli/udash/pull/1"},
+		},
+		MoreOpenedActions: 3,
+		Stale: []digestStalePipeline{
+			{Name: "nightly", Result: "✔", LastReportAt: "2026-10-16 02:00 UTC", Interval: "24h0m0s"},
+			{Name: "manual", Result: "✗", LastReportAt: "2026-10-01 10:00 UTC"},
+		},
+		StaleAfter: "168h0m0s",
+	}
+
+	m, err := summary.render(Digest{Subject: "udash digest: weekly", To: []string{"team@example.com"}})
+	require.NoError(t, err)
+
+	assert.Contains(t, m.Text, "12 reports published: ✔ 10 ✗ 2")
+	assert.Contains(t, m.Text, "https://github.com/updatecli/udash.git (main): 2 of 3 pipelines failing, 1 open actions")
+	assert.Contains(t, m.Text, "Bump <deps>: https://github.com/updatecli/udash/pull/1")
+	assert.Contains(t, m.Text, "And 3 more.")
+	assert.Contains(t, m.Text, "nightly (✔), last reported on 2026-10-16 02:00 UTC, expected every 24h0m0s")
+	assert.Contains(t, m.Text, "manual (✗), last reported on 2026-10-01 10:00 UTC\n")
+
+	assert.Contains(t, m.HTML, `<a href="https://github.com/updatecli/udash/pull/1">`)
+	assert.Contains(t, m.HTML, "Bump &lt;deps&gt;")
+	assert.Contains(t, m.HTML, "<td>2026-10-17</td>")
+
+	// The stand-in SMTP server keeps what it receives.
+	sink := newSMTPSink(t, true)
+
+	host, port, err := net.SplitHostPort(sink.address)
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, sendEmail(ctx, SMTPOptions{
+		Host:     host,
+		Port:     portNumber,
+		Username: "udash",
+		Password: "secret",
+		From:     "udash <udash@example.com>",
+		Security: SMTPStartTLS,
+		// The stand-in SMTP server uses a self-signed certificate.
+		InsecureSkipVerify: true,
+	}, m))
+
+	received := <-sink.received
+	assert.Equal(t, "udash@example.com", received.from)
+	assert.Equal(t, []string{"team@example.com"}, received.to)
+	assert.Equal(t, "\x00udash\x00secret", received.auth)
+
+	message, err := mail.ReadMessage(strings.NewReader(received.data))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "udash digest: weekly", subject)
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for _, expected := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		part, err := parts.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, expected.contentType, part.Header.Get("Content-Type"))
+
+		// The quoted-printable encoding is removed by the reader.
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, expected.content, string(content))
+	}
+}
+
+func TestSendEmailRequiresStartTLS(t *testing.T) {
+	sink := newSMTPSink(t, false)
+
+	host, port, err := net.SplitHostPort(sink.address)
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = sendEmail(ctx, SMTPOptions{
+		Host:     host,
+		Port:     portNumber,
+		From:     "udash <udash@example.com>",
+		Security: SMTPStartTLS,
+	}, email{To: []string{"team@example.com"}, Subject: "udash digest", Text: "digest"})
+	require.ErrorIs(t, err, ErrSMTPStartTLSUnsupported)
+	assert.Empty(t, sink.received)
+}
+
+type smtpMessage struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+type smtpSink struct {
+	address  string
+	received chan smtpMessage
+}
+
+// newSMTPSink starts an SMTP server accepting a single email, offering STARTTLS with a
+// self-signed certificate when startTLS is set.
+func newSMTPSink(t *testing.T, startTLS bool) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{selfSignedCertificate(t)}}
+	sink := &smtpSink{address: listener.Addr().String(), received: make(chan smtpMessage, 1)}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { conn.Close() }()
+
+		text := textproto.NewConn(conn)
+		reader := textproto.NewReader(bufio.NewReader(conn))
+		m := smtpMessage{}
+
+		_ = text.PrintfLine("220 sink ESMTP")
+		for {
+			line, err := reader.ReadLine()
+			if err != nil {
+				return
+			}
+
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				if _, upgraded := conn.(*tls.Conn); startTLS && !upgraded {
+					_ = text.PrintfLine("250-sink\r\n250-STARTTLS\r\n250 AUTH PLAIN")
+					continue
+				}
+				_ = text.PrintfLine("250-sink\r\n250 AUTH PLAIN")
+			case "STARTTLS":
+				_ = text.PrintfLine("220 ready")
+				conn = tls.Server(conn, tlsConfig)
+				text = textproto.NewConn(conn)
+				reader = textproto.NewReader(bufio.NewReader(conn))
+			case "AUTH":
+				_, encoded, _ := strings.Cut(arg, " ")
+				decoded, _ := base64.StdEncoding.DecodeString(encoded)
+				m.auth = string(decoded)
+				_ = text.PrintfLine("235 accepted")
+			case "MAIL":
+				m.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+				_ = text.PrintfLine("250 ok")
+			case "RCPT":
+				m.to = append(m.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+				_ = text.PrintfLine("250 ok")
+			case "DATA":
+				_ = text.PrintfLine("354 go ahead")
+				data, err := reader.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				m.data = string(data)
+				_ = text.PrintfLine("250 queued")
+				sink.received <- m
+			case "QUIT":
+				_ = text.PrintfLine("221 bye")
+				return
+			default:
+				_ = text.PrintfLine("502 unsupported")
+			}
+		}
+	}()
+
+	return sink
+}
+
+// selfSignedCertificate returns a certificate for 127.0.0.1, signed by its own key.
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sink"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
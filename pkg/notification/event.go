@@ -0,0 +1,228 @@
+package notification
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+	"github.com/updatecli/updatecli/pkg/core/result"
+)
+
+// Event is the body of a webhook, it describes how the state of a pipeline changed.
+type Event struct {
+	// Event is the kind of change, "result_changed", "action_opened" or "pipeline_stale".
+	Event string `json:"event"`
+	// Rule is the name of the rule the webhook is sent for.
+	Rule string `json:"rule"`
+	// Time is when the report changing the state of the pipeline was published, or when
+	// the pipeline was found stale.
+	Time time.Time `json:"time"`
+	// Test is set on the webhooks sent to test a rule, which describe no actual pipeline.
+	Test bool `json:"test,omitempty"`
+	// Pipeline is the pipeline whose state changed.
+	Pipeline Pipeline `json:"pipeline"`
+}
+
+// Pipeline describes the state of a pipeline, before and after its latest report.
+type Pipeline struct {
+	// ID is the id of the pipeline, and Name its name.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// ReportID is the id of the report which changed the state of the pipeline, and
+	// ReportURL its url on the Updatecli side, if any.
+	ReportID  string `json:"report_id"`
+	ReportURL string `json:"report_url,omitempty"`
+	// Result is the result of the pipeline, and PreviousResult the one it changed from.
+	Result         string `json:"result"`
+	PreviousResult string `json:"previous_result"`
+	// ActionURLs are the links of the actions left open by the pipeline, and
+	// NewActionURLs the ones it opened since its previous report.
+	ActionURLs    []string `json:"action_urls"`
+	NewActionURLs []string `json:"new_action_urls"`
+	// FailingTargets are the targets of the pipeline which failed.
+	FailingTargets []Target `json:"failing_targets"`
+	// Labels are the labels of the pipeline.
+	Labels map[string]string `json:"labels,omitempty"`
+	// SCMs are the scms targeted by the pipeline.
+	SCMs []SCM `json:"scms"`
+	// LastReportAt is when the latest report of a stale pipeline was published, and
+	// ReportingInterval the interval it missed, such as "24h0m0s". They are only set on
+	// the pipeline_stale events.
+	LastReportAt      *time.Time `json:"last_report_at,omitempty"`
+	ReportingInterval string     `json:"reporting_interval,omitempty"`
+}
+
+// Target is a target of a pipeline.
+type Target struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SCM is an scm targeted by a pipeline.
+type SCM struct {
+	URL    string `json:"url"`
+	Branch string `json:"branch"`
+}
+
+// newPipeline describes the state of the pipeline of an inserted report.
+func newPipeline(inserted database.InsertedReport) Pipeline {
+	report := inserted.Report
+
+	p := Pipeline{
+		ID:             report.ID,
+		Name:           report.Name,
+		ReportID:       inserted.ID,
+		ReportURL:      report.ReportURL,
+		Result:         report.Result,
+		ActionURLs:     actionURLs(report),
+		NewActionURLs:  []string{},
+		FailingTargets: failingTargets(report),
+		Labels:         report.Labels,
+		SCMs:           scms(report),
+	}
+
+	if inserted.Previous != nil {
+		p.PreviousResult = inserted.Previous.Result
+
+		for _, link := range p.ActionURLs {
+			if !slices.Contains(inserted.Previous.ActionURLs, link) {
+				p.NewActionURLs = append(p.NewActionURLs, link)
+			}
+		}
+	}
+
+	return p
+}
+
+// newStalePipeline describes the state of a pipeline which went stale, as of its latest
+// report. Its result did not change, the previous result is the current one.
+func newStalePipeline(stale database.NewlyStalePipeline) Pipeline {
+	report := stale.Report
+	lastReportAt := stale.LastReportAt.UTC()
+
+	return Pipeline{
+		ID:                report.ID,
+		Name:              report.Name,
+		ReportID:          stale.ReportID,
+		ReportURL:         report.ReportURL,
+		Result:            report.Result,
+		PreviousResult:    report.Result,
+		ActionURLs:        actionURLs(report),
+		NewActionURLs:     []string{},
+		FailingTargets:    failingTargets(report),
+		Labels:            report.Labels,
+		SCMs:              scms(report),
+		LastReportAt:      &lastReportAt,
+		ReportingInterval: stale.Interval.String(),
+	}
+}
+
+// changes returns the events notified for an inserted report. The first report of a
+// pipeline notifies nothing: it is how a pipeline starts, not a change, and notifying
+// it would flood the endpoints whenever a fleet of pipelines is published for the first
+// time.
+func changes(inserted database.InsertedReport, p Pipeline) []string {
+	if inserted.Previous == nil {
+		return nil
+	}
+
+	events := []string{}
+
+	if p.Result != p.PreviousResult {
+		events = append(events, EventResultChanged)
+	}
+
+	if len(p.NewActionURLs) > 0 {
+		events = append(events, EventActionOpened)
+	}
+
+	return events
+}
+
+// matches reports whether the rule selects the pipeline for the provided event.
+func (r Rule) matches(event string, p Pipeline) bool {
+	if !slices.Contains(r.Events, event) {
+		return false
+	}
+
+	for key, value := range r.Labels {
+		if p.Labels[key] != value {
+			return false
+		}
+	}
+
+	if r.SCM.URL != "" && !slices.ContainsFunc(p.SCMs, func(scm SCM) bool {
+		return scm.URL == r.SCM.URL && (r.SCM.Branch == "" || scm.Branch == r.SCM.Branch)
+	}) {
+		return false
+	}
+
+	if len(r.Results) > 0 && !slices.Contains(r.Results, p.Result) {
+		return false
+	}
+
+	if r.OpenAction != nil && *r.OpenAction != (len(p.ActionURLs) > 0) {
+		return false
+	}
+
+	return true
+}
+
+// actionURLs returns the links of the actions left open by a report, sorted.
+func actionURLs(report reports.Report) []string {
+	links := []string{}
+
+	for _, action := range report.Actions {
+		if action != nil && action.Link != "" && !slices.Contains(links, action.Link) {
+			links = append(links, action.Link)
+		}
+	}
+	slices.Sort(links)
+
+	return links
+}
+
+// failingTargets returns the targets of a report which failed, sorted by id.
+func failingTargets(report reports.Report) []Target {
+	failing := []Target{}
+
+	for id, target := range report.Targets {
+		if target == nil || target.Result != result.FAILURE {
+			continue
+		}
+
+		failing = append(failing, Target{ID: id, Name: target.Name, Description: target.Description})
+	}
+
+	slices.SortFunc(failing, func(a, b Target) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return failing
+}
+
+// scms returns the scms targeted by a report, as the reports search identifies them.
+func scms(report reports.Report) []SCM {
+	found := []SCM{}
+
+	for _, target := range report.Targets {
+		if target == nil || target.Scm.URL == "" || target.Scm.Branch.Target == "" {
+			continue
+		}
+
+		scm := SCM{URL: target.Scm.URL, Branch: target.Scm.Branch.Target}
+		if !slices.Contains(found, scm) {
+			found = append(found, scm)
+		}
+	}
+
+	slices.SortFunc(found, func(a, b SCM) int {
+		return cmp.Or(strings.Compare(a.URL, b.URL), strings.Compare(a.Branch, b.Branch))
+	})
+
+	return found
+}
@@ -0,0 +1,302 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/updatecli/updatecli/pkg/core/result"
+)
+
+const (
+	// maxSlackHeader is the length of the text of a Slack header block.
+	maxSlackHeader = 150
+	// maxListedTargets caps the failing targets detailed by a message, a pipeline with
+	// dozens of them would exceed the size of a message otherwise.
+	maxListedTargets = 10
+)
+
+// object is a JSON object of a chat message.
+type object = map[string]any
+
+// render returns the body posted to the endpoint of a rule for an event.
+func (r Rule) render(e Event) ([]byte, error) {
+	switch r.Format {
+	case FormatSlack:
+		return json.Marshal(slackMessage(e))
+	case FormatTeams:
+		return json.Marshal(teamsMessage(e))
+	case FormatMattermost:
+		return json.Marshal(mattermostMessage(e))
+	default:
+		return json.Marshal(e)
+	}
+}
+
+// headline summarizes an event in a single line.
+func headline(e Event) string {
+	p := e.Pipeline
+
+	name := p.Name
+	if name == "" {
+		name = p.ID
+	}
+
+	var line string
+	switch e.Event {
+	case EventActionOpened:
+		line = fmt.Sprintf("%s %s opened a new action", p.Result, name)
+	case EventPipelineStale:
+		line = fmt.Sprintf("%s %s has not reported for more than %s", p.Result, name, p.ReportingInterval)
+		if p.LastReportAt != nil {
+			line += ", since " + p.LastReportAt.Format("2006-01-02 15:04 MST")
+		}
+	default:
+		line = fmt.Sprintf("%s %s changed from %s to %s", p.Result, name, p.PreviousResult, p.Result)
+	}
+
+	if e.Test {
+		line = "[test] " + line
+	}
+
+	return line
+}
+
+// actionURL returns the link of the action a message points to: the action opened by the
+// change, or else one left open.
+func actionURL(p Pipeline) string {
+	if len(p.NewActionURLs) > 0 {
+		return p.NewActionURLs[0]
+	}
+
+	if len(p.ActionURLs) > 0 {
+		return p.ActionURLs[0]
+	}
+
+	return ""
+}
+
+// listedTargets returns the failing targets detailed by a message, and how many are left
+// out.
+func listedTargets(p Pipeline) ([]Target, int) {
+	if len(p.FailingTargets) <= maxListedTargets {
+		return p.FailingTargets, 0
+	}
+
+	return p.FailingTargets[:maxListedTargets], len(p.FailingTargets) - maxListedTargets
+}
+
+// targetName returns the name a target is displayed with.
+func targetName(t Target) string {
+	if t.Name != "" {
+		return t.Name
+	}
+
+	return t.ID
+}
+
+// color returns the color of the side bar of a message, after the result of the pipeline.
+func color(r string) string {
+	switch r {
+	case result.SUCCESS:
+		return "#2eb886"
+	case result.FAILURE:
+		return "#d00000"
+	case result.ATTENTION:
+		return "#daa038"
+	default:
+		return "#a0a0a0"
+	}
+}
+
+// markdownLines returns the lines of a message in markdown, as rendered by Mattermost
+// and Teams. Slack uses its own syntax, see slackMessage.
+func markdownLines(p Pipeline) (scms []string, targets []string) {
+	for _, scm := range p.SCMs {
+		scms = append(scms, fmt.Sprintf("%s on `%s`", markdownLink(scm.URL, scm.URL), scm.Branch))
+	}
+
+	listed, more := listedTargets(p)
+	for _, t := range listed {
+		line := "- **" + targetName(t) + "**"
+		if t.Description != "" {
+			line += ": " + t.Description
+		}
+		targets = append(targets, line)
+	}
+
+	if more > 0 {
+		targets = append(targets, fmt.Sprintf("- and %d more", more))
+	}
+
+	return scms, targets
+}
+
+// markdownLink returns a markdown link.
+func markdownLink(text, url string) string {
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+// slackEscape escapes the characters Slack reads as markup in a mrkdwn text.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// slackMessage renders an event as a Slack Block Kit message.
+func slackMessage(e Event) object {
+	p := e.Pipeline
+	text := headline(e)
+
+	header := text
+	if runes := []rune(header); len(runes) > maxSlackHeader {
+		header = string(runes[:maxSlackHeader-1]) + "…"
+	}
+
+	mrkdwn := func(s string) object {
+		return object{"type": "mrkdwn", "text": s}
+	}
+	section := func(title string, lines []string) object {
+		return object{"type": "section", "text": mrkdwn("*" + title + "*\n" + strings.Join(lines, "\n"))}
+	}
+
+	blocks := []object{
+		{"type": "header", "text": object{"type": "plain_text", "text": header}},
+		{"type": "section", "fields": []object{
+			mrkdwn("*Result*\n" + slackEscape(p.Result)),
+			mrkdwn("*Previous result*\n" + slackEscape(p.PreviousResult)),
+		}},
+	}
+
+	listed, more := listedTargets(p)
+	if len(listed) > 0 {
+		lines := []string{}
+		for _, t := range listed {
+			line := "• *" + slackEscape(targetName(t)) + "*"
+			if t.Description != "" {
+				line += ": " + slackEscape(t.Description)
+			}
+			lines = append(lines, line)
+		}
+		if more > 0 {
+			lines = append(lines, fmt.Sprintf("• and %d more", more))
+		}
+		blocks = append(blocks, section("Failing targets", lines))
+	}
+
+	if len(p.SCMs) > 0 {
+		lines := []string{}
+		for _, scm := range p.SCMs {
+			lines = append(lines, fmt.Sprintf("<%s|%s> on `%s`", scm.URL, slackEscape(scm.URL), slackEscape(scm.Branch)))
+		}
+		blocks = append(blocks, section("SCM", lines))
+	}
+
+	if link := actionURL(p); link != "" {
+		blocks = append(blocks, section("Open action", []string{"<" + link + ">"}))
+	}
+
+	if p.ReportURL != "" {
+		blocks = append(blocks, object{"type": "context", "elements": []object{
+			mrkdwn("<" + p.ReportURL + "|View the report>"),
+		}})
+	}
+
+	return object{
+		// text is shown by the notifications, which do not render the blocks.
+		"text":   slackEscape(text),
+		"blocks": blocks,
+	}
+}
+
+// teamsMessage renders an event as an Adaptive Card, in the message envelope expected by
+// the Teams webhooks.
+func teamsMessage(e Event) object {
+	p := e.Pipeline
+
+	textBlock := func(text string) object {
+		return object{"type": "TextBlock", "text": text, "wrap": true}
+	}
+
+	facts := []object{
+		{"title": "Result", "value": p.Result},
+		{"title": "Previous result", "value": p.PreviousResult},
+	}
+
+	scms, targets := markdownLines(p)
+	for _, scm := range scms {
+		facts = append(facts, object{"title": "SCM", "value": scm})
+	}
+
+	body := []object{
+		{"type": "TextBlock", "text": headline(e), "size": "Medium", "weight": "Bolder", "wrap": true},
+		{"type": "FactSet", "facts": facts},
+	}
+
+	if len(targets) > 0 {
+		heading := textBlock("Failing targets")
+		heading["weight"] = "Bolder"
+		body = append(body, heading, textBlock(strings.Join(targets, "\n")))
+	}
+
+	actions := []object{}
+	if link := actionURL(p); link != "" {
+		actions = append(actions, object{"type": "Action.OpenUrl", "title": "Open action", "url": link})
+	}
+	if p.ReportURL != "" {
+		actions = append(actions, object{"type": "Action.OpenUrl", "title": "View the report", "url": p.ReportURL})
+	}
+
+	return object{
+		"type": "message",
+		"attachments": []object{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": object{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+				"actions": actions,
+			},
+		}},
+	}
+}
+
+// mattermostMessage renders an event as a Mattermost message with an attachment.
+func mattermostMessage(e Event) object {
+	p := e.Pipeline
+	text := headline(e)
+
+	fields := []object{
+		{"short": true, "title": "Result", "value": p.Result},
+		{"short": true, "title": "Previous result", "value": p.PreviousResult},
+	}
+
+	scms, targets := markdownLines(p)
+	if len(scms) > 0 {
+		fields = append(fields, object{"short": false, "title": "SCM", "value": strings.Join(scms, "\n")})
+	}
+
+	if link := actionURL(p); link != "" {
+		fields = append(fields, object{"short": false, "title": "Open action", "value": link})
+	}
+
+	attachment := object{
+		"fallback": text,
+		"color":    color(p.Result),
+		"title":    text,
+		"fields":   fields,
+	}
+
+	if p.ReportURL != "" {
+		attachment["title_link"] = p.ReportURL
+	}
+
+	if len(targets) > 0 {
+		attachment["text"] = "**Failing targets**\n" + strings.Join(targets, "\n")
+	}
+
+	return object{
+		"text":        text,
+		"attachments": []object{attachment},
+	}
+}
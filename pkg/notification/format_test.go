@@ -0,0 +1,162 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+func TestFormats(t *testing.T) {
+	event := Event{
+		Event: EventResultChanged,
+		Rule:  "chat",
+		Time:  time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		Pipeline: Pipeline{
+			ID:             "deps",
+			Name:           "Bump <dependencies> & tools",
+			ReportURL:      "https://app.updatecli.io/reports/1",
+			Result:         "✗",
+			PreviousResult: "✔",
+			ActionURLs:     []string{"https://github.com/updatecli/udash/pull/1", "https://github.com/updatecli/udash/pull/2"},
+			NewActionURLs:  []string{"https://github.com/updatecli/udash/pull/2"},
+			FailingTargets: []Target{{ID: "go", Name: "Bump Go", Description: "go.mod not found"}},
+			SCMs:           []SCM{{URL: "https://github.com/updatecli/udash.git", Branch: "main"}},
+		},
+	}
+
+	// The stand-in decodes what a chat endpoint receives.
+	var received map[string]any
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(body, &received)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer endpoint.Close()
+
+	post := func(t *testing.T, format string) map[string]any {
+		rule := Rule{Name: "chat", URL: endpoint.URL, Format: format}
+
+		payload, err := rule.render(event)
+		require.NoError(t, err)
+
+		received = nil
+		status, errorMessage := send(context.Background(), time.Second, rule, database.NotificationDelivery{
+			ID:      uuid.New(),
+			Event:   event.Event,
+			Payload: payload,
+		})
+		require.Empty(t, errorMessage)
+		require.Equal(t, http.StatusOK, status)
+
+		return received
+	}
+
+	headline := "✗ Bump <dependencies> & tools changed from ✔ to ✗"
+
+	t.Run("webhook", func(t *testing.T) {
+		body := post(t, FormatWebhook)
+
+		assert.Equal(t, EventResultChanged, body["event"])
+		assert.Equal(t, "deps", body["pipeline"].(map[string]any)["id"])
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		body := post(t, FormatSlack)
+
+		assert.Equal(t, "✗ Bump &lt;dependencies&gt; &amp; tools changed from ✔ to ✗", body["text"])
+
+		blocks := body["blocks"].([]any)
+		require.Len(t, blocks, 6)
+		assert.Equal(t, map[string]any{"type": "plain_text", "text": headline}, blocks[0].(map[string]any)["text"])
+		assert.Equal(t, "*Failing targets*\n• *Bump Go*: go.mod not found", blocks[2].(map[string]any)["text"].(map[string]any)["text"])
+		assert.Equal(t, "*SCM*\n<https://github.com/updatecli/udash.git|https://github.com/updatecli/udash.git> on `main`",
+			blocks[3].(map[string]any)["text"].(map[string]any)["text"])
+		assert.Equal(t, "*Open action*\n<https://github.com/updatecli/udash/pull/2>", blocks[4].(map[string]any)["text"].(map[string]any)["text"])
+		assert.Equal(t, "context", blocks[5].(map[string]any)["type"])
+	})
+
+	t.Run("teams", func(t *testing.T) {
+		body := post(t, FormatTeams)
+
+		assert.Equal(t, "message", body["type"])
+
+		attachment := body["attachments"].([]any)[0].(map[string]any)
+		assert.Equal(t, "application/vnd.microsoft.card.adaptive", attachment["contentType"])
+
+		card := attachment["content"].(map[string]any)
+		assert.Equal(t, "AdaptiveCard", card["type"])
+
+		cardBody := card["body"].([]any)
+		require.Len(t, cardBody, 4)
+		assert.Equal(t, headline, cardBody[0].(map[string]any)["text"])
+		assert.Contains(t, cardBody[1].(map[string]any)["facts"], map[string]any{
+			"title": "SCM",
+			"value": "[https://github.com/updatecli/udash.git](https://github.com/updatecli/udash.git) on `main`",
+		})
+		assert.Equal(t, "- **Bump Go**: go.mod not found", cardBody[3].(map[string]any)["text"])
+
+		assert.Equal(t, []any{
+			map[string]any{"type": "Action.OpenUrl", "title": "Open action", "url": "https://github.com/updatecli/udash/pull/2"},
+			map[string]any{"type": "Action.OpenUrl", "title": "View the report", "url": "https://app.updatecli.io/reports/1"},
+		}, card["actions"])
+	})
+
+	t.Run("mattermost", func(t *testing.T) {
+		body := post(t, FormatMattermost)
+
+		assert.Equal(t, headline, body["text"])
+
+		attachment := body["attachments"].([]any)[0].(map[string]any)
+		assert.Equal(t, "#d00000", attachment["color"])
+		assert.Equal(t, "https://app.updatecli.io/reports/1", attachment["title_link"])
+		assert.Equal(t, "**Failing targets**\n- **Bump Go**: go.mod not found", attachment["text"])
+		assert.Contains(t, attachment["fields"], map[string]any{
+			"short": false,
+			"title": "Open action",
+			"value": "https://github.com/updatecli/udash/pull/2",
+		})
+	})
+}
+
+func TestSlackEscapesMarkup(t *testing.T) {
+	message := slackMessage(Event{
+		Event: EventActionOpened,
+		Pipeline: Pipeline{
+			ID:             "escape",
+			Result:         "✔",
+			FailingTargets: []Target{{ID: "t", Description: "<!channel> & co"}},
+		},
+	})
+
+	blocks := message["blocks"].([]object)
+	assert.Equal(t, "*Failing targets*\n• *t*: &lt;!channel&gt; &amp; co", blocks[2]["text"].(object)["text"])
+	assert.Equal(t, "✔ escape opened a new action", message["text"])
+}
+
+func TestStaleHeadline(t *testing.T) {
+	pipeline := newStalePipeline(database.NewlyStalePipeline{
+		ReportID:     "report",
+		Report:       reports.Report{ID: "silent", Name: "Bump tools", Result: "✔"},
+		LastReportAt: time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC),
+		Interval:     24 * time.Hour,
+	})
+
+	assert.Equal(t, "✔", pipeline.PreviousResult)
+	assert.Equal(t, "24h0m0s", pipeline.ReportingInterval)
+	assert.Equal(t, "✔ Bump tools has not reported for more than 24h0m0s, since 2026-10-16 08:00 UTC",
+		headline(Event{Event: EventPipelineStale, Pipeline: pipeline}))
+}
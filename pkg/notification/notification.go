@@ -0,0 +1,541 @@
+// Package notification sends webhooks when the state of a pipeline changes, such as a
+// pipeline which starts failing or which opens a pull request, and emails digests of the
+// health of the pipelines on a schedule.
+//
+// The changes are found by ReportInserted as the reports are published, and by Run for the
+// pipelines which stop reporting. The webhooks are recorded in the database first, as
+// deliveries, in the background, then sent by Run: a delivery which is not accepted by its
+// endpoint is retried with a backoff, including by another replica when the udash which
+// recorded it stops.
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/udash/pkg/version"
+)
+
+const (
+	// pollInterval is how often the deliveries due for a retry are looked for.
+	pollInterval = 5 * time.Second
+	// pruneInterval is how often the deliveries older than the retention are deleted.
+	pruneInterval = time.Hour
+	// staleInterval is how often the pipelines which went stale are looked for.
+	staleInterval = 5 * time.Minute
+	// claimBatchSize is the number of deliveries claimed at once.
+	claimBatchSize = 10
+	// maxResponseError is how much of the body of a response rejecting a delivery is
+	// recorded as its error.
+	maxResponseError = 512
+	// changesBuffer is how many changes may wait to be recorded before the next ones are
+	// dropped, see ReportInserted.
+	changesBuffer = 1024
+
+	// SignatureHeader is the header carrying the HMAC-SHA256 signature of the body of a
+	// webhook, as "sha256=" followed by its hexadecimal encoding.
+	SignatureHeader = "X-Udash-Signature-256"
+	// EventHeader is the header carrying the kind of change notified by a webhook.
+	EventHeader = "X-Udash-Event"
+	// DeliveryHeader is the header carrying the id of the delivery, the same for every
+	// attempt at sending it.
+	DeliveryHeader = "X-Udash-Delivery"
+)
+
+var (
+	// ErrUnknownRule is returned when testing a rule which is not configured.
+	ErrUnknownRule = errors.New("unknown notification rule")
+
+	// mu guards options against a reload.
+	mu      sync.RWMutex
+	options = defaultOptions()
+
+	// wake tells Run a delivery was recorded, so that it is sent right away rather than on
+	// the next poll.
+	wake = make(chan struct{}, 1)
+
+	client = &http.Client{}
+
+	// pendingChanges are the changes of the state of the pipelines waiting to be recorded, see
+	// ReportInserted and recordChanges.
+	pendingChanges = make(chan pipelineChange, changesBuffer)
+)
+
+// pipelineChange is a change of the state of a pipeline waiting to be recorded.
+type pipelineChange struct {
+	// ctx is the context of the insertion of the report, without its cancellation.
+	ctx      context.Context
+	inserted database.InsertedReport
+	// events and pipeline are only told once the previous state of the pipeline is
+	// known, see InsertedReport.PreviousErr.
+	events   []string
+	pipeline Pipeline
+}
+
+func defaultOptions() Options {
+	o := Options{}
+	o.Init()
+	return o
+}
+
+// Configure applies the provided options, to the deliveries recorded from now on and to
+// the retries of the pending ones.
+func Configure(o Options) error {
+	o.Init()
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	options = o
+
+	return nil
+}
+
+func currentOptions() Options {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return options
+}
+
+// ReportInserted queues the changes of the state of the pipeline of an inserted report for
+// a delivery to be recorded for every rule selecting them, see recordChanges. It is
+// registered with database.OnReportInserted, and does not wait for the deliveries to be
+// recorded: a report which changes nothing returns right away, and the others are
+// recorded off the request inserting them.
+//
+// A change which cannot be queued is lost, the report is inserted nonetheless.
+func ReportInserted(ctx context.Context, inserted database.InsertedReport) {
+	o := currentOptions()
+	if len(o.Rules) == 0 {
+		return
+	}
+
+	c := pipelineChange{ctx: context.WithoutCancel(ctx), inserted: inserted}
+
+	// The previous state of the pipeline could not be read, it is read again along with
+	// the recording.
+	if inserted.PreviousErr == nil {
+		c.pipeline = newPipeline(inserted)
+		c.events = changes(inserted, c.pipeline)
+		if len(c.events) == 0 {
+			return
+		}
+	}
+
+	select {
+	case pendingChanges <- c:
+	default:
+		logrus.WithContext(ctx).Errorf("notifying pipeline %q: too many changes waiting to be recorded", inserted.Report.ID)
+	}
+}
+
+// recordChanges records the queued changes until ctx is cancelled, then the ones still
+// queued.
+func recordChanges(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case c := <-pendingChanges:
+					recordChange(c)
+				default:
+					return
+				}
+			}
+		case c := <-pendingChanges:
+			recordChange(c)
+		}
+	}
+}
+
+// recordChange records a delivery for every rule selecting a change, unless the pipeline
+// is acknowledged. The changes are told first when the previous state of the pipeline
+// could not be read as the report was inserted.
+func recordChange(c pipelineChange) {
+	ctx, cancel := database.WithQueryTimeout(c.ctx)
+	defer cancel()
+
+	if c.inserted.PreviousErr != nil {
+		previous, err := database.PreviousPipelineState(ctx, c.inserted)
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("pipeline %q not notified, its previous state cannot be read: %s (first attempt: %s)",
+				c.inserted.Report.ID, err, c.inserted.PreviousErr)
+			return
+		}
+
+		c.inserted.Previous, c.inserted.PreviousErr = previous, nil
+		c.pipeline = newPipeline(c.inserted)
+		c.events = changes(c.inserted, c.pipeline)
+		if len(c.events) == 0 {
+			return
+		}
+	}
+
+	o := currentOptions()
+
+	// An acknowledged pipeline notifies nothing, its failure is known. Failing to tell
+	// notifies it nonetheless.
+	acknowledgement, err := database.FindAcknowledgement(ctx, c.pipeline.ID, c.pipeline.Labels)
+	if err != nil {
+		logrus.WithContext(ctx).Errorf("%s", err)
+	}
+
+	if acknowledgement != nil {
+		logrus.WithContext(ctx).Debugf("Pipeline %q acknowledged by %s, not notified", c.pipeline.ID, acknowledgement.Author)
+		return
+	}
+
+	recorded := false
+
+	for _, event := range c.events {
+		if record(ctx, o, event, c.pipeline) {
+			recorded = true
+		}
+	}
+
+	if recorded {
+		notify()
+	}
+}
+
+// record records a delivery of an event for every rule selecting it, and reports whether
+// any was recorded.
+func record(ctx context.Context, o Options, event string, pipeline Pipeline) bool {
+	recorded := false
+
+	for _, rule := range o.Rules {
+		if !rule.matches(event, pipeline) {
+			continue
+		}
+
+		payload, err := rule.render(Event{
+			Event:    event,
+			Rule:     rule.Name,
+			Time:     time.Now().UTC(),
+			Pipeline: pipeline,
+		})
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("encoding the %s notification of rule %q: %s", event, rule.Name, err)
+			continue
+		}
+
+		// A notification which cannot be recorded is lost, the report is inserted
+		// nonetheless.
+		if _, err := database.InsertNotificationDelivery(ctx, database.NewNotificationDelivery{
+			Rule:       rule.Name,
+			Event:      event,
+			PipelineID: pipeline.ID,
+			ReportID:   pipeline.ReportID,
+			Payload:    payload,
+		}); err != nil {
+			logrus.WithContext(ctx).Errorf("recording the %s notification of rule %q: %s", event, rule.Name, err)
+			continue
+		}
+
+		logrus.WithContext(ctx).Debugf("Pipeline %q: %s notification recorded for rule %q", pipeline.ID, event, rule.Name)
+		recorded = true
+	}
+
+	return recorded
+}
+
+// notify tells Run a delivery was recorded.
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// notifyStale records a delivery for every rule selecting a pipeline which went stale
+// since it was last looked for, unless the pipeline is acknowledged. The stale pipelines
+// are only looked for when a rule selects them: a pipeline going stale while none does is
+// not notified afterwards.
+func notifyStale(ctx context.Context) {
+	o := currentOptions()
+	if !slices.ContainsFunc(o.Rules, func(r Rule) bool { return slices.Contains(r.Events, EventPipelineStale) }) {
+		return
+	}
+
+	stale, err := database.ClaimStalePipelines(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithContext(ctx).Errorf("%s", err)
+		}
+		return
+	}
+
+	recorded := false
+
+	for _, s := range stale {
+		acknowledgement, err := database.FindAcknowledgement(ctx, s.Report.ID, s.Report.Labels)
+		if err != nil {
+			logrus.WithContext(ctx).Errorf("%s", err)
+		}
+
+		if acknowledgement != nil {
+			logrus.WithContext(ctx).Debugf("Pipeline %q acknowledged by %s, not notified", s.Report.ID, acknowledgement.Author)
+			continue
+		}
+
+		if record(ctx, o, EventPipelineStale, newStalePipeline(s)) {
+			recorded = true
+		}
+	}
+
+	if recorded {
+		notify()
+	}
+}
+
+// Run records the changes queued by ReportInserted, sends the deliveries recorded, retries
+// the ones which were not accepted, notifies the pipelines which went stale, and sends the
+// digests when they are due, until ctx is cancelled. The replicas of udash all run it, a
+// delivery or a digest is sent by a single one at a time.
+func Run(ctx context.Context) {
+	recording := make(chan struct{})
+	go func() {
+		defer close(recording)
+		recordChanges(ctx)
+	}()
+	defer func() { <-recording }()
+
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+
+	stale := time.NewTicker(staleInterval)
+	defer stale.Stop()
+
+	digests := digestScheduler{}
+
+	for {
+		sendDue(ctx)
+		digests.sendDue(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(pollInterval):
+		case <-prune.C:
+			pruneDeliveries(ctx)
+		case <-stale.C:
+			notifyStale(ctx)
+		}
+	}
+}
+
+// sendDue sends the deliveries due, a batch at a time, until none is left.
+func sendDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		o := currentOptions()
+
+		// The lease outlasts the attempts of a batch, sent one after the other.
+		deliveries, err := database.ClaimNotificationDeliveries(ctx, claimBatchSize, claimBatchSize*o.Timeout+time.Minute)
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.WithContext(ctx).Errorf("%s", err)
+			}
+			return
+		}
+
+		for _, d := range deliveries {
+			attempt(ctx, o, d)
+		}
+
+		if len(deliveries) < claimBatchSize {
+			return
+		}
+	}
+}
+
+// attempt sends a claimed delivery and records the outcome.
+func attempt(ctx context.Context, o Options, d database.NotificationDelivery) database.NotificationDelivery {
+	log := logrus.WithContext(ctx).WithFields(logrus.Fields{"delivery": d.ID, "rule": d.Rule})
+
+	outcome := database.NotificationAttempt{}
+
+	rule, found := o.rule(d.Rule)
+	if found {
+		outcome.ResponseStatus, outcome.Error = send(ctx, o.Timeout, rule, d)
+		if outcome.Error != "" && retryable(outcome.ResponseStatus) {
+			outcome.RetryIn = o.retryIn(d.Attempts)
+		}
+	} else {
+		outcome.Error = fmt.Sprintf("rule %q is not configured anymore", d.Rule)
+	}
+
+	switch {
+	case outcome.Error == "":
+		log.Debugf("Notification delivered")
+	case outcome.RetryIn > 0:
+		log.Warnf("Notification not delivered, retrying in %s: %s", outcome.RetryIn, outcome.Error)
+	default:
+		log.Errorf("Notification not delivered after %d attempts, giving up: %s", d.Attempts, outcome.Error)
+	}
+
+	// Recorded even when udash stops meanwhile, the delivery would be sent again otherwise.
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	recorded, err := database.RecordNotificationAttempt(recordCtx, d.ID, outcome)
+	if err != nil {
+		log.Errorf("%s", err)
+		return d
+	}
+
+	return recorded
+}
+
+// send posts a delivery to the endpoint of its rule, and returns the status answered and
+// an error message, empty when the endpoint accepted it.
+func send(ctx context.Context, timeout time.Duration, rule Rule, d database.NotificationDelivery) (int, string) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "udash/"+version.Version)
+	request.Header.Set(EventHeader, d.Event)
+	request.Header.Set(DeliveryHeader, d.ID.String())
+	if rule.Secret != "" {
+		request.Header.Set(SignatureHeader, Sign(rule.Secret, d.Payload))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxResponseError))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Sprintf("endpoint answered %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+
+	return response.StatusCode, ""
+}
+
+// retryable reports whether a delivery rejected with the provided status may be accepted
+// later. The other client errors are mistakes, such as a wrong url or secret, which no
+// retry fixes.
+func retryable(status int) bool {
+	switch {
+	case status == 0, status >= 500:
+		return true
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sign returns the value of the signature header of a webhook body, which lets its
+// endpoint verify that the webhook comes from udash.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Test sends a webhook describing no actual pipeline to the endpoint of a rule, in the
+// format of the rule, once, and returns the delivery recorded. It returns ErrUnknownRule
+// when the rule is not configured.
+func Test(ctx context.Context, ruleName string) (database.NotificationDelivery, error) {
+	o := currentOptions()
+
+	rule, found := o.rule(ruleName)
+	if !found {
+		return database.NotificationDelivery{}, fmt.Errorf("%w: %q", ErrUnknownRule, ruleName)
+	}
+
+	payload, err := rule.render(Event{
+		Event: EventResultChanged,
+		Rule:  rule.Name,
+		Time:  time.Now().UTC(),
+		Test:  true,
+		Pipeline: Pipeline{
+			ID:             "udash-test",
+			Name:           "udash test notification",
+			Result:         "✗",
+			PreviousResult: "✔",
+			ActionURLs:     []string{},
+			NewActionURLs:  []string{},
+			FailingTargets: []Target{{
+				ID:          "udash-test",
+				Name:        "udash test target",
+				Description: "sent by the test of the notification rule",
+			}},
+			SCMs: []SCM{},
+		},
+	})
+	if err != nil {
+		return database.NotificationDelivery{}, fmt.Errorf("encoding the test notification: %w", err)
+	}
+
+	// Leased so that it is sent once, here, rather than retried by Run.
+	d, err := database.InsertNotificationDelivery(ctx, database.NewNotificationDelivery{
+		Rule:    rule.Name,
+		Event:   EventResultChanged,
+		Payload: payload,
+		Lease:   o.Timeout + time.Minute,
+	})
+	if err != nil {
+		return d, err
+	}
+
+	o.MaxAttempts = 1
+
+	return attempt(ctx, o, d), nil
+}
+
+// pruneDeliveries deletes the deliveries and the digest runs older than the retention.
+func pruneDeliveries(ctx context.Context) {
+	pruned, err := database.PruneNotificationDeliveries(ctx, currentOptions().Retention)
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithContext(ctx).Errorf("%s", err)
+		}
+		return
+	}
+
+	if pruned > 0 {
+		logrus.WithContext(ctx).Debugf("%d notification deliveries pruned", pruned)
+	}
+
+	pruned, err = database.PruneNotificationDigests(ctx, currentOptions().Retention)
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithContext(ctx).Errorf("%s", err)
+		}
+		return
+	}
+
+	if pruned > 0 {
+		logrus.WithContext(ctx).Debugf("%d notification digests pruned", pruned)
+	}
+}
@@ -0,0 +1,206 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+func TestChanges(t *testing.T) {
+	report := reports.Report{
+		ID:     "pipeline",
+		Result: "✗",
+		Labels: map[string]string{"team": "platform"},
+		Actions: map[string]*reports.Action{
+			"default": {Link: "https://github.com/updatecli/udash/pull/2"},
+		},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		previous *database.PipelineState
+		expected []string
+	}{
+		{
+			name:     "first report",
+			previous: nil,
+			expected: nil,
+		},
+		{
+			name:     "unchanged",
+			previous: &database.PipelineState{Result: "✗", ActionURLs: []string{"https://github.com/updatecli/udash/pull/2"}},
+			expected: []string{},
+		},
+		{
+			name:     "result changed",
+			previous: &database.PipelineState{Result: "✔", ActionURLs: []string{"https://github.com/updatecli/udash/pull/2"}},
+			expected: []string{EventResultChanged},
+		},
+		{
+			name:     "action opened",
+			previous: &database.PipelineState{Result: "✗", ActionURLs: []string{"https://github.com/updatecli/udash/pull/1"}},
+			expected: []string{EventActionOpened},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			inserted := database.InsertedReport{ID: "id", Report: report, Previous: tt.previous}
+
+			assert.Equal(t, tt.expected, changes(inserted, newPipeline(inserted)))
+		})
+	}
+}
+
+func TestReportInsertedDoesNotBlock(t *testing.T) {
+	require.NoError(t, Configure(Options{Rules: []Rule{{Name: "hook", URL: "https://hooks.example/udash"}}}))
+	t.Cleanup(func() {
+		require.NoError(t, Configure(Options{}))
+		for len(pendingChanges) > 0 {
+			<-pendingChanges
+		}
+	})
+
+	report := reports.Report{ID: "pipeline", Result: "✗"}
+
+	// A report which changes nothing is not queued.
+	ReportInserted(context.Background(), database.InsertedReport{
+		ID:       "unchanged",
+		Report:   report,
+		Previous: &database.PipelineState{Result: "✗"},
+	})
+	assert.Empty(t, pendingChanges)
+
+	// A report whose previous state could not be read is queued for it to be read again.
+	ReportInserted(context.Background(), database.InsertedReport{
+		ID:          "unknown",
+		Report:      report,
+		PreviousErr: errors.New("connection reset"),
+	})
+	require.Len(t, pendingChanges, 1)
+	c := <-pendingChanges
+	assert.Equal(t, "unknown", c.inserted.ID)
+	assert.Empty(t, c.events)
+
+	// Nothing records the queued changes, the ones past the buffer are dropped.
+	for i := range changesBuffer + 1 {
+		ReportInserted(context.Background(), database.InsertedReport{
+			ID:       fmt.Sprintf("report-%d", i),
+			Report:   report,
+			Previous: &database.PipelineState{Result: "✔"},
+		})
+	}
+
+	assert.Len(t, pendingChanges, changesBuffer)
+	c = <-pendingChanges
+	assert.Equal(t, "report-0", c.pipeline.ReportID)
+	assert.Equal(t, []string{EventResultChanged}, c.events)
+}
+
+func TestRuleMatches(t *testing.T) {
+	p := Pipeline{
+		Result:     "✗",
+		ActionURLs: []string{"https://github.com/updatecli/udash/pull/2"},
+		Labels:     map[string]string{"team": "platform"},
+		SCMs:       []SCM{{URL: "https://github.com/updatecli/udash.git", Branch: "main"}},
+	}
+
+	yes, no := true, false
+
+	for _, tt := range []struct {
+		name     string
+		rule     Rule
+		expected bool
+	}{
+		{"no selector", Rule{}, true},
+		{"other event", Rule{Events: []string{EventActionOpened}}, false},
+		{"labels", Rule{Labels: map[string]string{"team": "platform"}}, true},
+		{"other labels", Rule{Labels: map[string]string{"team": "web"}}, false},
+		{"scm", Rule{SCM: SCMSelector{URL: "https://github.com/updatecli/udash.git"}}, true},
+		{"scm branch", Rule{SCM: SCMSelector{URL: "https://github.com/updatecli/udash.git", Branch: "main"}}, true},
+		{"other scm branch", Rule{SCM: SCMSelector{URL: "https://github.com/updatecli/udash.git", Branch: "v1"}}, false},
+		{"results", Rule{Results: []string{"✗", "⚠"}}, true},
+		{"other results", Rule{Results: []string{"✔"}}, false},
+		{"open action", Rule{OpenAction: &yes}, true},
+		{"no open action", Rule{OpenAction: &no}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Options{Rules: []Rule{tt.rule}}
+			o.Init()
+
+			assert.Equal(t, tt.expected, o.Rules[0].matches(EventResultChanged, p))
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	o := Options{Rules: []Rule{{Name: "hook", URL: "https://hooks.example/udash"}}}
+	o.Init()
+	require.NoError(t, o.Validate())
+	assert.Equal(t, events, o.Rules[0].Events)
+
+	assert.Equal(t, 30*time.Second, o.retryIn(1))
+	assert.Equal(t, 2*time.Minute, o.retryIn(3))
+	assert.Zero(t, o.retryIn(5))
+
+	o.MaxAttempts = 20
+	assert.Equal(t, time.Hour, o.retryIn(19))
+
+	invalid := Options{Rules: []Rule{
+		{Name: "hook", URL: "ftp://hooks.example"},
+		{Name: "hook", URL: "https://hooks.example", Events: []string{"deleted"}},
+		{URL: "https://hooks.example", SCM: SCMSelector{Branch: "main"}},
+	}}
+	invalid.Init()
+
+	err := invalid.Validate()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `invalid url "ftp://hooks.example"`)
+	assert.ErrorContains(t, err, `rule "hook": duplicated name`)
+	assert.ErrorContains(t, err, `unsupported event "deleted"`)
+	assert.ErrorContains(t, err, "rule 2: missing name")
+	assert.ErrorContains(t, err, "an scm branch requires an scm url")
+}
+
+func TestSend(t *testing.T) {
+	payload := []byte(`{"event":"result_changed"}`)
+
+	var received *http.Request
+	var body []byte
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+
+		if r.URL.Path == "/unavailable" {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		}
+	}))
+	defer endpoint.Close()
+
+	d := database.NotificationDelivery{ID: uuid.New(), Event: EventResultChanged, Payload: payload}
+
+	status, errorMessage := send(context.Background(), time.Second, Rule{URL: endpoint.URL, Secret: "secret"}, d)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, errorMessage)
+	assert.Equal(t, payload, body)
+	assert.Equal(t, Sign("secret", payload), received.Header.Get(SignatureHeader))
+	assert.Equal(t, EventResultChanged, received.Header.Get(EventHeader))
+	assert.Equal(t, d.ID.String(), received.Header.Get(DeliveryHeader))
+
+	status, errorMessage = send(context.Background(), time.Second, Rule{URL: endpoint.URL + "/unavailable"}, d)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Contains(t, errorMessage, "try later")
+	assert.Empty(t, received.Header.Get(SignatureHeader))
+	assert.True(t, retryable(status))
+	assert.False(t, retryable(http.StatusNotFound))
+}
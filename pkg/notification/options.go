@@ -0,0 +1,370 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"time"
+	// The time zones of the digests are found whether or not the host has them.
+	_ "time/tzdata"
+)
+
+const (
+	// EventResultChanged is notified when the result of a pipeline changes, such as a
+	// pipeline which succeeded and now fails, or the other way around.
+	EventResultChanged = "result_changed"
+	// EventActionOpened is notified when a pipeline opens a new action, such as a pull
+	// request.
+	EventActionOpened = "action_opened"
+	// EventPipelineStale is notified when a pipeline has not reported for longer than its
+	// reporting interval, once per report it went silent after.
+	EventPipelineStale = "pipeline_stale"
+
+	// FormatWebhook posts the Event describing the change, as is.
+	FormatWebhook = "webhook"
+	// FormatSlack posts a Slack Block Kit message, to a Slack incoming webhook.
+	FormatSlack = "slack"
+	// FormatTeams posts an Adaptive Card, to a Microsoft Teams incoming webhook or workflow.
+	FormatTeams = "teams"
+	// FormatMattermost posts a message with an attachment, to a Mattermost incoming webhook.
+	FormatMattermost = "mattermost"
+
+	// defaultTimeout bounds a single attempt at sending a notification.
+	defaultTimeout = 10 * time.Second
+	// defaultMaxAttempts is the number of times a notification is sent before giving up.
+	defaultMaxAttempts = 5
+	// defaultRetryBackoff is the delay before the first retry, doubled on every retry.
+	defaultRetryBackoff = 30 * time.Second
+	// maxRetryBackoff caps the delay between two retries.
+	maxRetryBackoff = time.Hour
+	// defaultRetention is how long the delivery log is kept.
+	defaultRetention = 30 * 24 * time.Hour
+
+	// SMTPStartTLS upgrades the connection to the SMTP server with STARTTLS, a server which
+	// does not support it is refused.
+	SMTPStartTLS = "starttls"
+	// SMTPTLS connects to the SMTP server over TLS, usually on port 465.
+	SMTPTLS = "tls"
+	// SMTPNone never encrypts the connection to the SMTP server.
+	SMTPNone = "none"
+
+	// defaultSMTPPort is the submission port.
+	defaultSMTPPort = 587
+	// defaultDigestPeriod is how far back a digest looks.
+	defaultDigestPeriod = 7 * 24 * time.Hour
+)
+
+var (
+	// events are the events a rule may select.
+	events = []string{EventResultChanged, EventActionOpened, EventPipelineStale}
+	// formats are the formats a rule may post.
+	formats = []string{FormatWebhook, FormatSlack, FormatTeams, FormatMattermost}
+	// smtpSecurities are the ways the connection to the SMTP server may be secured.
+	smtpSecurities = []string{SMTPStartTLS, SMTPTLS, SMTPNone}
+)
+
+// Options defines the notifications sent when the state of a pipeline changes.
+type Options struct {
+	// Rules lists the notifications sent, each report is matched against all of them.
+	Rules []Rule
+	// Timeout bounds a single attempt at sending a notification.
+	// Default to 10s
+	Timeout time.Duration
+	// MaxAttempts is the number of times a notification is sent before giving up on it.
+	// Default to 5
+	MaxAttempts int
+	// RetryBackoff is the delay before retrying a notification which was not accepted, doubled
+	// on every retry up to one hour.
+	// Default to 30s
+	RetryBackoff time.Duration
+	// Retention is how long the delivery log is kept.
+	// Default to 720h
+	Retention time.Duration
+	// SMTP is the server the digests are sent through.
+	SMTP SMTPOptions
+	// Digests lists the emails summarizing the health of the pipelines, sent on a schedule.
+	Digests []Digest
+}
+
+// SMTPOptions defines the SMTP server the digests are sent through.
+type SMTPOptions struct {
+	// Host is the SMTP server.
+	Host string
+	// Port is the port of the SMTP server.
+	// Default to 587
+	Port int
+	// Username and Password authenticate to the SMTP server, with PLAIN.
+	// Default to no authentication
+	Username string
+	Password string
+	// From is the sender of the digests.
+	From string
+	// Security is how the connection is secured, among "starttls", "tls" and "none".
+	// Default to "starttls"
+	Security string
+	// InsecureSkipVerify accepts any certificate from the SMTP server.
+	InsecureSkipVerify bool
+}
+
+// Digest is an email summarizing the failures, the new open actions and the stale pipelines
+// over a period, sent on a schedule.
+type Digest struct {
+	// Name identifies the digest, it must be unique.
+	Name string
+	// Schedule is a cron expression of five fields, such as "0 8 * * MON", or a descriptor
+	// such as "@weekly".
+	Schedule string
+	// Timezone is the time zone of the schedule, such as "Europe/Brussels".
+	// Default to UTC
+	Timezone string
+	// Period is how far back the digest looks.
+	// Default to 168h
+	Period time.Duration
+	// StaleAfter is how long a pipeline without any reporting interval may go without
+	// reporting before the digest lists it as stale. A pipeline with a reporting interval is
+	// listed once it is stale for the API too.
+	// Default to the period
+	StaleAfter time.Duration
+	// Labels restricts the digest to the pipelines carrying all of them.
+	Labels map[string]string
+	// To lists the recipients.
+	To []string
+	// Subject is the subject of the email.
+	// Default to "udash digest: " followed by the name
+	Subject string
+}
+
+// Rule sends a webhook to an endpoint when the state of the pipelines it selects changes.
+// A rule selects the pipelines matching all of its selectors, and every pipeline without any.
+type Rule struct {
+	// Name identifies the rule in the delivery log, it must be unique.
+	Name string
+	// URL is the endpoint the webhook is posted to.
+	URL string
+	// Format is the body posted, among "webhook", "slack", "teams" and "mattermost".
+	// Default to "webhook"
+	Format string
+	// Secret signs the webhooks with HMAC-SHA256, see the X-Udash-Signature-256 header.
+	// Default to no signature
+	Secret string
+	// Events lists the state changes notified, among "result_changed", "action_opened" and
+	// "pipeline_stale".
+	// Default to all of them
+	Events []string
+	// Labels selects the pipelines carrying all of them.
+	Labels map[string]string
+	// SCM selects the pipelines with a target on that scm.
+	SCM SCMSelector
+	// Results selects the pipelines whose new result is one of them, such as "✗".
+	Results []string
+	// OpenAction selects the pipelines which carry an open action, such as a pull request
+	// waiting to be merged, or the ones which do not.
+	OpenAction *bool
+}
+
+// SCMSelector selects the pipelines with a target on an scm.
+type SCMSelector struct {
+	// URL is the url of the repository.
+	URL string
+	// Branch is the branch targeted, any when empty.
+	Branch string
+}
+
+// Init sets the defaults of the unset options.
+func (o *Options) Init() {
+	if o.Timeout == 0 {
+		o.Timeout = defaultTimeout
+	}
+
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = defaultMaxAttempts
+	}
+
+	if o.RetryBackoff == 0 {
+		o.RetryBackoff = defaultRetryBackoff
+	}
+
+	if o.Retention == 0 {
+		o.Retention = defaultRetention
+	}
+
+	if o.SMTP.Port == 0 {
+		o.SMTP.Port = defaultSMTPPort
+	}
+
+	if o.SMTP.Security == "" {
+		o.SMTP.Security = SMTPStartTLS
+	}
+
+	o.Digests = slices.Clone(o.Digests)
+	for i := range o.Digests {
+		d := &o.Digests[i]
+
+		if d.Period == 0 {
+			d.Period = defaultDigestPeriod
+		}
+
+		if d.StaleAfter == 0 {
+			d.StaleAfter = d.Period
+		}
+
+		if d.Subject == "" {
+			d.Subject = "udash digest: " + d.Name
+		}
+	}
+
+	// The rules are shared with the caller otherwise.
+	o.Rules = slices.Clone(o.Rules)
+	for i := range o.Rules {
+		if len(o.Rules[i].Events) == 0 {
+			o.Rules[i].Events = slices.Clone(events)
+		}
+
+		if o.Rules[i].Format == "" {
+			o.Rules[i].Format = FormatWebhook
+		}
+	}
+}
+
+// Validate reports the options which cannot be applied.
+func (o Options) Validate() error {
+	errs := []error{}
+
+	if o.Timeout < 0 || o.RetryBackoff < 0 || o.Retention < 0 {
+		errs = append(errs, errors.New("the timeout, retry backoff and retention cannot be negative"))
+	}
+
+	if o.MaxAttempts < 0 {
+		errs = append(errs, errors.New("the maximum number of attempts cannot be negative"))
+	}
+
+	names := map[string]bool{}
+
+	for i, rule := range o.Rules {
+		if rule.Name == "" {
+			errs = append(errs, fmt.Errorf("rule %d: missing name", i))
+		} else if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("rule %q: duplicated name", rule.Name))
+		}
+		names[rule.Name] = true
+
+		if u, err := url.Parse(rule.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("rule %q: invalid url %q, an http or https url is expected", rule.Name, rule.URL))
+		}
+
+		if rule.Format != "" && !slices.Contains(formats, rule.Format) {
+			errs = append(errs, fmt.Errorf("rule %q: unsupported format %q, accepted values are %q", rule.Name, rule.Format, formats))
+		}
+
+		for _, event := range rule.Events {
+			if !slices.Contains(events, event) {
+				errs = append(errs, fmt.Errorf("rule %q: unsupported event %q, accepted values are %q", rule.Name, event, events))
+			}
+		}
+
+		if rule.SCM.Branch != "" && rule.SCM.URL == "" {
+			errs = append(errs, fmt.Errorf("rule %q: an scm branch requires an scm url", rule.Name))
+		}
+	}
+
+	if o.SMTP.Port < 0 || o.SMTP.Port > 65535 {
+		errs = append(errs, fmt.Errorf("smtp: invalid port %d", o.SMTP.Port))
+	}
+
+	if o.SMTP.Security != "" && !slices.Contains(smtpSecurities, o.SMTP.Security) {
+		errs = append(errs, fmt.Errorf("smtp: unsupported security %q, accepted values are %q", o.SMTP.Security, smtpSecurities))
+	}
+
+	if len(o.Digests) > 0 && (o.SMTP.Host == "" || o.SMTP.From == "") {
+		errs = append(errs, errors.New("smtp: a host and a sender are required to send the digests"))
+	}
+
+	if o.SMTP.From != "" {
+		if _, err := mail.ParseAddress(o.SMTP.From); err != nil {
+			errs = append(errs, fmt.Errorf("smtp: invalid sender %q: %w", o.SMTP.From, err))
+		}
+	}
+
+	digestNames := map[string]bool{}
+
+	for i, d := range o.Digests {
+		if d.Name == "" {
+			errs = append(errs, fmt.Errorf("digest %d: missing name", i))
+		} else if digestNames[d.Name] {
+			errs = append(errs, fmt.Errorf("digest %q: duplicated name", d.Name))
+		}
+		digestNames[d.Name] = true
+
+		if _, err := d.schedule(); err != nil {
+			errs = append(errs, fmt.Errorf("digest %q: %w", d.Name, err))
+		}
+
+		if d.Period < 0 || d.StaleAfter < 0 {
+			errs = append(errs, fmt.Errorf("digest %q: the period and the stale duration cannot be negative", d.Name))
+		}
+
+		if len(d.To) == 0 {
+			errs = append(errs, fmt.Errorf("digest %q: missing recipient", d.Name))
+		}
+
+		for _, to := range d.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				errs = append(errs, fmt.Errorf("digest %q: invalid recipient %q: %w", d.Name, to, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// schedule parses the schedule of the digest, in its time zone.
+func (d Digest) schedule() (schedule, error) {
+	location := time.UTC
+	if d.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(d.Timezone); err != nil {
+			return schedule{}, fmt.Errorf("invalid time zone %q: %w", d.Timezone, err)
+		}
+	}
+
+	return parseSchedule(d.Schedule, location)
+}
+
+// digest returns the digest of the provided name.
+func (o Options) digest(name string) (Digest, bool) {
+	for _, d := range o.Digests {
+		if d.Name == name {
+			return d, true
+		}
+	}
+
+	return Digest{}, false
+}
+
+// rule returns the rule of the provided name.
+func (o Options) rule(name string) (Rule, bool) {
+	for _, rule := range o.Rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+// retryIn returns when a notification sent the provided number of times is retried, zero
+// when it is given up on.
+func (o Options) retryIn(attempts int) time.Duration {
+	if attempts >= o.MaxAttempts {
+		return 0
+	}
+
+	backoff := o.RetryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxRetryBackoff)
+}
@@ -0,0 +1,191 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSMTPStartTLSUnsupported is returned when the SMTP server does not offer STARTTLS while
+// the connection must be upgraded with it.
+var ErrSMTPStartTLSUnsupported = errors.New("smtp server does not support starttls")
+
+// email is a message with a plain text and an HTML alternative.
+type email struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// sendEmail sends an email through the SMTP server, within the deadline of ctx.
+func sendEmail(ctx context.Context, o SMTPOptions, m email) error {
+	message, err := m.encode(o.From, time.Now())
+	if err != nil {
+		return fmt.Errorf("encoding the email: %w", err)
+	}
+
+	address := net.JoinHostPort(o.Host, strconv.Itoa(o.Port))
+	tlsConfig := &tls.Config{
+		ServerName:         o.Host,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{}
+	if o.Security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to the smtp server %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	// The SMTP client has no notion of a context, the deadline bounds the whole exchange.
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	client, err := smtp.NewClient(conn, o.Host)
+	if err != nil {
+		return fmt.Errorf("greeting the smtp server %s: %w", address, err)
+	}
+	defer client.Close()
+
+	// A server which does not offer STARTTLS is refused rather than written to in clear
+	// text: an attacker in between would only have to strip it from the greeting.
+	if o.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%w: %s", ErrSMTPStartTLSUnsupported, address)
+		}
+
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starting tls with the smtp server %s: %w", address, err)
+		}
+	}
+
+	if o.Username != "" {
+		// smtp.PlainAuth refuses to send the password over a connection which is neither
+		// encrypted nor to localhost.
+		if err := client.Auth(smtp.PlainAuth("", o.Username, o.Password, o.Host)); err != nil {
+			return fmt.Errorf("authenticating to the smtp server %s: %w", address, err)
+		}
+	}
+
+	from, err := mail.ParseAddress(o.From)
+	if err != nil {
+		return fmt.Errorf("parsing the sender: %w", err)
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("sending the sender: %w", err)
+	}
+
+	for _, to := range m.To {
+		recipient, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("parsing the recipient %q: %w", to, err)
+		}
+
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return fmt.Errorf("sending the recipient %q: %w", recipient.Address, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("sending the email: %w", err)
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("sending the email: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending the email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// encode returns the email as a MIME message, its text and HTML versions as alternatives.
+func (m email) encode(from string, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		// The preferred alternative goes last.
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	messageID := make([]byte, 16)
+	if _, err := rand.Read(messageID); err != nil {
+		return nil, err
+	}
+
+	domain := "udash"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if _, host, found := strings.Cut(address.Address, "@"); found {
+			domain = host
+		}
+	}
+
+	var message bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", from},
+		{"To", strings.Join(m.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"Message-ID", "<" + hex.EncodeToString(messageID) + "@" + domain + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	} {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
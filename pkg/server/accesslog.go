@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// accessLog returns a middleware logging every request served through logrus, replacing
+// the access log of gin so that it follows the configured format and carries the request id.
+//
+// The probes and the metrics scrapes are only logged at debug level, they would otherwise
+// drown every other line.
+func accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		entry := logrus.WithContext(c).WithFields(logrus.Fields{
+			"method":      c.Request.Method,
+			"path":        c.Request.URL.Path,
+			"route":       c.FullPath(),
+			"status":      status,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"bytes":       c.Writer.Size(),
+			"client_ip":   c.ClientIP(),
+			"user_agent":  c.Request.UserAgent(),
+		})
+
+		if principal := c.GetString(principalContextKey); principal != "" {
+			entry = entry.WithField("principal", principal)
+		}
+
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			entry.Error("request served")
+		case !isTraced(c):
+			entry.Debug("request served")
+		default:
+			entry.Info("request served")
+		}
+	}
+}
+
+// recovery returns a middleware answering a 500 when a handler panics, and logging the panic
+// with the id of the request rather than to the standard error of gin.
+func recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		logrus.WithContext(c).WithField("stack", string(debug.Stack())).Errorf("panic serving request: %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+// AcknowledgementRequest describes an acknowledgement to record.
+type AcknowledgementRequest struct {
+	// PipelineID selects a single pipeline, by the id of its reports.
+	PipelineID string `json:"pipeline_id,omitempty"`
+	// Labels selects the pipelines whose report carries every one of them, with the same
+	// value. It cannot be combined with pipeline_id.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Reason tells why the failure is accepted.
+	Reason string `json:"reason"`
+	// Author tells who accepted the failure. It defaults to the authenticated user.
+	Author string `json:"author,omitempty"`
+	// ExpiresAt is when the acknowledgement stops applying, never when unset.
+	// Time format is RFC3339: 2006-01-02T15:04:05Z07:00
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AcknowledgementResponse represents the response of the acknowledgement creation.
+type AcknowledgementResponse struct {
+	Message string                   `json:"message"`
+	Data    database.Acknowledgement `json:"data"`
+}
+
+// AcknowledgementsResponse represents the response listing the acknowledgements.
+type AcknowledgementsResponse struct {
+	Message string                     `json:"message"`
+	Data    []database.Acknowledgement `json:"data"`
+}
+
+// CreateAcknowledgement acknowledges the failure of pipelines.
+// @Summary Acknowledge pipelines
+// @Description Acknowledge the known, accepted failure of a pipeline, or of the pipelines carrying some labels. An
+// @Description acknowledged pipeline is flagged on the reports and the scm summaries, notifies nothing, and may be
+// @Description left out of the reports summary.
+// @Tags Acknowledgements
+// @Accept json
+// @Produce json
+// @Param body body AcknowledgementRequest true "Acknowledgement"
+// @Success 201 {object} AcknowledgementResponse
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/acknowledgements [post]
+func CreateAcknowledgement(c *gin.Context) {
+	var request AcknowledgementRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	author := request.Author
+	if author == "" {
+		author = c.GetString(principalContextKey)
+	}
+
+	acknowledgement, err := database.CreateAcknowledgement(c, database.NewAcknowledgement{
+		PipelineID: request.PipelineID,
+		Labels:     request.Labels,
+		Reason:     request.Reason,
+		Author:     author,
+		ExpiresAt:  request.ExpiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidAcknowledgement) {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: err.Error(),
+			})
+			return
+		}
+
+		logrus.WithContext(c).Errorf("acknowledging pipelines: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	logrus.WithContext(c).Infof("Acknowledgement %s created by %s", acknowledgement.ID, acknowledgement.Author)
+
+	c.JSON(http.StatusCreated, AcknowledgementResponse{
+		Message: "success!",
+		Data:    acknowledgement,
+	})
+}
+
+// ListAcknowledgements lists the acknowledgements.
+// @Summary List the acknowledgements
+// @Description List the acknowledgements applying right now, latest first
+// @Tags Acknowledgements
+// @Param expired query bool false "List the expired acknowledgements too"
+// @Produce json
+// @Success 200 {object} AcknowledgementsResponse
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/acknowledgements [get]
+func ListAcknowledgements(c *gin.Context) {
+	expired := false
+
+	if value := c.Query("expired"); value != "" {
+		var err error
+		if expired, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: "invalid expired parameter, a boolean is expected",
+			})
+			return
+		}
+	}
+
+	acknowledgements, err := database.ListAcknowledgements(c, expired)
+	if err != nil {
+		logrus.WithContext(c).Errorf("listing acknowledgements: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, AcknowledgementsResponse{
+		Message: "success!",
+		Data:    acknowledgements,
+	})
+}
+
+// DeleteAcknowledgement deletes an acknowledgement.
+// @Summary Delete an acknowledgement
+// @Description Delete an acknowledgement, the pipelines it selected are no longer acknowledged
+// @Tags Acknowledgements
+// @Param id path string true "Acknowledgement ID"
+// @Produce json
+// @Success 200 {object} DefaultResponseModel
+// @Failure 404 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/acknowledgements/{id} [delete]
+func DeleteAcknowledgement(c *gin.Context) {
+	id := c.Param("id")
+
+	err := pgx.ErrNoRows
+	if _, parseErr := uuid.Parse(id); parseErr == nil {
+		err = database.DeleteAcknowledgement(c, id)
+	}
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, DefaultResponseModel{
+			Err: "acknowledgement not found",
+		})
+		return
+	case err != nil:
+		logrus.WithContext(c).Errorf("deleting acknowledgement: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	logrus.WithContext(c).Infof("Acknowledgement %s deleted", id)
+
+	c.JSON(http.StatusOK, DefaultResponseModel{
+		Message: "Acknowledgement deleted successfully",
+	})
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+// CheckDatabaseResponse represents the response of the database check.
+type CheckDatabaseResponse struct {
+	Message string                      `json:"message"`
+	Data    database.CheckReportsResult `json:"data"`
+}
+
+// CheckDatabase verifies the report columns denormalized from the report payloads, and
+// recomputes the drifted ones when asked to.
+// @Summary Check the denormalized report columns
+// @Description Verify the report columns denormalized from the report payloads, such as the pipeline result
+// @Description or the ids of its scms, against the ones computed when a report is published. The check reads
+// @Description every report, prefer "udash db check" on a large database.
+// @Tags Admin
+// @Param repair query bool false "Recompute the drifted columns"
+// @Produce json
+// @Success 200 {object} CheckDatabaseResponse
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/admin/db/check [post]
+func CheckDatabase(c *gin.Context) {
+	repair := false
+
+	if value := c.Query("repair"); value != "" {
+		var err error
+		if repair, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: "invalid repair parameter, a boolean is expected",
+			})
+			return
+		}
+	}
+
+	result, err := database.CheckReports(c, database.CheckReportsOptions{Repair: repair})
+	if err != nil {
+		logrus.WithContext(c).Errorf("checking the database: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	logrus.WithContext(c).Infof("Database checked: %d reports, %d drifted, %d repaired",
+		result.Checked, result.Drifted, result.Repaired)
+
+	c.JSON(http.StatusOK, CheckDatabaseResponse{
+		Message: "success!",
+		Data:    result,
+	})
+}
+
+// ReprocessJobRequest describes the reports a reprocessing job processes.
+type ReprocessJobRequest struct {
+	// StartTime and EndTime restrict the job to the reports of a time range, as the
+	// reports search does.
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// Labels restricts the job to the reports carrying them.
+	Labels map[string]string `json:"labels,omitempty"`
+	// BatchSize is the number of reports processed at once, 100 by default.
+	BatchSize int `json:"batch_size,omitempty"`
+	// BatchDelayMs is the pause between two batches in milliseconds, 1000 by default.
+	BatchDelayMs int `json:"batch_delay_ms,omitempty"`
+}
+
+// ReprocessJobResponse represents the response of the reprocessing job endpoints.
+type ReprocessJobResponse struct {
+	Message string                `json:"message"`
+	Data    database.ReprocessJob `json:"data"`
+}
+
+// ReprocessJobsResponse represents the response listing the reprocessing jobs.
+type ReprocessJobsResponse struct {
+	Message string                  `json:"message"`
+	Data    []database.ReprocessJob `json:"data"`
+}
+
+// CreateReprocessJob starts a background job recomputing the denormalized columns of the
+// stored reports.
+// @Summary Reprocess the stored reports
+// @Description Start a background job recomputing the report columns denormalized from the report payloads
+// @Description with the extraction of this version of udash. The job processes the reports a batch at a time,
+// @Description pausing between two batches, and resumes where it stopped when udash restarts.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param body body ReprocessJobRequest false "Reports to process"
+// @Success 202 {object} ReprocessJobResponse
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/admin/reprocess [post]
+func CreateReprocessJob(c *gin.Context) {
+	var request ReprocessJobRequest
+
+	// An empty body reprocesses every report.
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: err.Error(),
+			})
+			return
+		}
+	}
+
+	job, err := database.CreateReprocessJob(c, database.ReprocessJobParams{
+		StartTime:  request.StartTime,
+		EndTime:    request.EndTime,
+		Labels:     request.Labels,
+		BatchSize:  request.BatchSize,
+		BatchDelay: time.Duration(request.BatchDelayMs) * time.Millisecond,
+	})
+	if err != nil {
+		reprocessJobError(c, err)
+		return
+	}
+
+	logrus.WithContext(c).Infof("Reprocessing job %s created", job.ID)
+
+	c.JSON(http.StatusAccepted, ReprocessJobResponse{
+		Message: "success!",
+		Data:    job,
+	})
+}
+
+// ListReprocessJobs lists the latest reprocessing jobs.
+// @Summary List the reprocessing jobs
+// @Description List the latest reprocessing jobs and their progress, latest first
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} ReprocessJobsResponse
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/admin/reprocess [get]
+func ListReprocessJobs(c *gin.Context) {
+	jobs, err := database.ListReprocessJobs(c)
+	if err != nil {
+		logrus.WithContext(c).Errorf("listing reprocessing jobs: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReprocessJobsResponse{
+		Message: "success!",
+		Data:    jobs,
+	})
+}
+
+// GetReprocessJob returns a reprocessing job and its progress.
+// @Summary Get a reprocessing job
+// @Description Get a reprocessing job and its progress
+// @Tags Admin
+// @Param id path string true "Job ID"
+// @Produce json
+// @Success 200 {object} ReprocessJobResponse
+// @Failure 404 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/admin/reprocess/{id} [get]
+func GetReprocessJob(c *gin.Context) {
+	id, ok := reprocessJobID(c)
+	if !ok {
+		return
+	}
+
+	job, err := database.GetReprocessJob(c, id)
+	if err != nil {
+		reprocessJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ReprocessJobResponse{
+		Message: "success!",
+		Data:    job,
+	})
+}
+
+// CancelReprocessJob cancels a reprocessing job.
+// @Summary Cancel a reprocessing job
+// @Description Cancel a pending or running reprocessing job, a running one stops after its current batch
+// @Tags Admin
+// @Param id path string true "Job ID"
+// @Produce json
+// @Success 200 {object} ReprocessJobResponse
+// @Failure 404 {object} DefaultResponseModel
+// @Failure 409 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/admin/reprocess/{id}/cancel [post]
+func CancelReprocessJob(c *gin.Context) {
+	id, ok := reprocessJobID(c)
+	if !ok {
+		return
+	}
+
+	job, err := database.CancelReprocessJob(c, id)
+	if err != nil {
+		reprocessJobError(c, err)
+		return
+	}
+
+	logrus.WithContext(c).Infof("Reprocessing job %s cancelled", job.ID)
+
+	c.JSON(http.StatusOK, ReprocessJobResponse{
+		Message: "success!",
+		Data:    job,
+	})
+}
+
+// reprocessJobID returns the id of the job of the request, answering a 404 when it is not a
+// valid one rather than letting the database reject it.
+func reprocessJobID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusNotFound, DefaultResponseModel{
+			Err: "reprocessing job not found",
+		})
+		return "", false
+	}
+
+	return id, true
+}
+
+// reprocessJobError answers a request about a reprocessing job which failed.
+func reprocessJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, DefaultResponseModel{
+			Err: "reprocessing job not found",
+		})
+	case errors.Is(err, database.ErrInvalidReprocessJob):
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: err.Error(),
+		})
+	case errors.Is(err, database.ErrReprocessJobDone):
+		c.JSON(http.StatusConflict, DefaultResponseModel{
+			Err: err.Error(),
+		})
+	default:
+		logrus.WithContext(c).Errorf("reprocessing job: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandlersRejectInvalidRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/check", CheckDatabase)
+	r.POST("/reprocess", CreateReprocessJob)
+	r.GET("/reprocess/:id", GetReprocessJob)
+	r.POST("/reprocess/:id/cancel", CancelReprocessJob)
+
+	// None of them reaches the database, which is not connected.
+	for _, tt := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/check?repair=maybe", "", http.StatusBadRequest},
+		{http.MethodPost, "/reprocess", "{", http.StatusBadRequest},
+		{http.MethodGet, "/reprocess/not-a-uuid", "", http.StatusNotFound},
+		{http.MethodPost, "/reprocess/not-a-uuid/cancel", "", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+		assert.Equal(t, tt.status, w.Code, "%s %s", tt.method, tt.path)
+	}
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/result"
+)
+
+const (
+	// badgeNotFound is the message of the badges whose pipeline or scm does not exist. It
+	// is rendered as a badge rather than an error so that the README embedding it still
+	// shows something.
+	badgeNotFound = "not found"
+	// badgeNoPipeline is the message of the badges which count no pipeline.
+	badgeNoPipeline = "no pipeline"
+	// badgePadding is the horizontal space around the texts of a badge, in pixels.
+	badgePadding = 6
+	// The runes narrower and wider than most, see badgeTextWidth.
+	badgeNarrowRunes    = "fijlrtI.,:;|!' "
+	badgeWideRunes      = "mwMW"
+	badgeUppercaseRunes = "ABCDEFGHJKLNOPQRSTUVXYZ"
+)
+
+// badgeResultNames are the words the pipeline badges show for the results.
+var badgeResultNames = map[string]string{
+	result.SUCCESS:   "success",
+	result.FAILURE:   "failure",
+	result.ATTENTION: "attention",
+	result.SKIPPED:   "skipped",
+}
+
+// badgeResultOrder is the order in which the results are counted on a badge, and
+// badgeSeverityOrder the one in which they pick its color: a badge is as red as its worst
+// pipeline.
+var (
+	badgeResultOrder   = []string{result.SUCCESS, result.FAILURE, result.ATTENTION, result.SKIPPED}
+	badgeSeverityOrder = []string{result.FAILURE, result.ATTENTION, result.SUCCESS, result.SKIPPED}
+)
+
+// badge is a shields-style status badge.
+type badge struct {
+	label   string
+	message string
+	color   string
+}
+
+// badgeHandlers serves the status badges with the options the server started with.
+type badgeHandlers struct {
+	options BadgeOptions
+}
+
+// PipelineBadge renders the result of the latest report of a pipeline.
+// @Summary Render the badge of a pipeline
+// @Description Render the result of the latest report of a pipeline as an SVG badge, such as "updatecli | success".
+// @Description A pipeline which never reported renders a "not found" badge.
+// @Tags Badges
+// @Param id path string true "Pipeline ID"
+// @Param label query string false "Text of the left part of the badge"
+// @Produce image/svg+xml
+// @Success 200 {string} string
+// @Success 304 {string} string
+// @Failure 404 {string} string
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/badges/pipelines/{id} [get]
+func (b badgeHandlers) PipelineBadge(c *gin.Context) {
+	counts, err := database.CountLatestResults(c, database.CountLatestResultsParams{
+		PipelineID: c.Param("id"),
+	})
+	if err != nil {
+		logrus.WithContext(c).Errorf("rendering pipeline badge: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	if len(counts) == 0 {
+		b.serve(c, http.StatusNotFound, b.notFound(c))
+		return
+	}
+
+	// A single pipeline has a single latest result.
+	for r := range counts {
+		message, found := badgeResultNames[r]
+		if !found {
+			message = r
+		}
+
+		b.serve(c, http.StatusOK, badge{
+			label:   b.label(c),
+			message: message,
+			color:   b.options.color(r),
+		})
+	}
+}
+
+// SCMBadge renders the results of the pipelines of an scm.
+// @Summary Render the badge of an scm
+// @Description Render the number of pipelines per result of an scm over the monitoring duration as an SVG badge,
+// @Description such as "updatecli | ✔ 3 ✗ 1", colored after the worst result. The counts are the ones of its summary.
+// @Description An unknown scm renders a "not found" badge.
+// @Tags Badges
+// @Param url query string true "SCM URL"
+// @Param branch query string true "SCM branch"
+// @Param label query string false "Text of the left part of the badge"
+// @Produce image/svg+xml
+// @Success 200 {string} string
+// @Success 304 {string} string
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 404 {string} string
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/badges/scm [get]
+func (b badgeHandlers) SCMBadge(c *gin.Context) {
+	url, branch := c.Query("url"), c.Query("branch")
+	if url == "" || branch == "" {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: "both url and branch must be provided",
+		})
+		return
+	}
+
+	rows, _, err := database.GetSCM(c, database.GetSCMParams{URL: url, Branch: branch})
+	if err != nil {
+		logrus.WithContext(c).Errorf("rendering scm badge: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	if len(rows) == 0 {
+		b.serve(c, http.StatusNotFound, b.notFound(c))
+		return
+	}
+
+	dataset, err := database.GetSCMSummary(database.GetSCMSummaryParams{
+		Ctx:                    c,
+		ScmRows:                rows,
+		MonitoringDurationDays: monitoringDurationDays,
+	})
+	if err != nil {
+		logrus.WithContext(c).Errorf("rendering scm badge: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	counts := map[string]int{}
+	if dataset != nil {
+		counts = dataset.Data[url][branch].TotalResultByType
+	}
+
+	b.serve(c, http.StatusOK, b.counts(c, counts))
+}
+
+// LabelsBadge renders the results of the pipelines carrying some labels.
+// @Summary Render the badge of labels
+// @Description Render the number of pipelines per result of their latest report, among the pipelines which reported
+// @Description over the monitoring duration with every provided label, as an SVG badge such as "updatecli | ✔ 3 ✗ 1",
+// @Description colored after the worst result.
+// @Tags Badges
+// @Param labels query object false "Labels, such as labels[team]=platform"
+// @Param label query string false "Text of the left part of the badge"
+// @Produce image/svg+xml
+// @Success 200 {string} string
+// @Success 304 {string} string
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/badges/labels [get]
+func (b badgeHandlers) LabelsBadge(c *gin.Context) {
+	counts, err := database.CountLatestResults(c, database.CountLatestResultsParams{
+		Labels: c.QueryMap("labels"),
+		Days:   monitoringDurationDays,
+	})
+	if err != nil {
+		logrus.WithContext(c).Errorf("rendering labels badge: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	b.serve(c, http.StatusOK, b.counts(c, counts))
+}
+
+// label returns the text of the left part of the badge, the label query parameter when set.
+func (b badgeHandlers) label(c *gin.Context) string {
+	if label := c.Query("label"); label != "" {
+		return label
+	}
+
+	return b.options.Label
+}
+
+// notFound returns the badge of a pipeline or an scm which does not exist.
+func (b badgeHandlers) notFound(c *gin.Context) badge {
+	return badge{
+		label:   b.label(c),
+		message: badgeNotFound,
+		color:   badgeUnknownColor,
+	}
+}
+
+// counts returns the badge counting the pipelines per result, such as "✔ 3 ✗ 1".
+func (b badgeHandlers) counts(c *gin.Context, counts map[string]int) badge {
+	message, color := badgeCounts(b.options, counts)
+
+	return badge{
+		label:   b.label(c),
+		message: message,
+		color:   color,
+	}
+}
+
+// badgeCounts returns the message and the color of a badge counting the pipelines per
+// result. The results which are not Updatecli ones are counted last, in order, and only
+// pick the color when no Updatecli one is counted.
+func badgeCounts(o BadgeOptions, counts map[string]int) (string, string) {
+	others := []string{}
+	for r := range counts {
+		if !slices.Contains(badgeResultOrder, r) {
+			others = append(others, r)
+		}
+	}
+	slices.Sort(others)
+
+	parts := []string{}
+	for _, r := range append(slices.Clone(badgeResultOrder), others...) {
+		if counts[r] > 0 {
+			parts = append(parts, r+" "+strconv.Itoa(counts[r]))
+		}
+	}
+
+	if len(parts) == 0 {
+		return badgeNoPipeline, badgeUnknownColor
+	}
+
+	for _, r := range append(slices.Clone(badgeSeverityOrder), others...) {
+		if counts[r] > 0 {
+			return strings.Join(parts, " "), o.color(r)
+		}
+	}
+
+	return strings.Join(parts, " "), badgeUnknownColor
+}
+
+// serve writes the badge along with its caching headers, or answers 304 when the client
+// already holds it.
+func (b badgeHandlers) serve(c *gin.Context, status int, badge badge) {
+	svg := renderBadge(badge)
+
+	sum := sha256.Sum256(svg)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	// A badge read with credentials may belong to a private API, the shared caches must
+	// not hand it to anyone else.
+	cacheControl := "public"
+	if c.GetHeader("Authorization") != "" {
+		cacheControl = "private"
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("%s, max-age=%d", cacheControl, int(b.options.MaxAge.Seconds())))
+	c.Header("ETag", etag)
+
+	if status == http.StatusOK && c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(status, "image/svg+xml; charset=utf-8", svg)
+}
+
+// renderBadge renders a badge in the flat style of shields.io.
+func renderBadge(b badge) []byte {
+	label, message, color := html.EscapeString(b.label), html.EscapeString(b.message), html.EscapeString(b.color)
+
+	labelWidth := badgeTextWidth(b.label) + 2*badgePadding
+	messageWidth := badgeTextWidth(b.message) + 2*badgePadding
+	width := labelWidth + messageWidth
+
+	var svg bytes.Buffer
+
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`,
+		width, label, message)
+	fmt.Fprintf(&svg, `<title>%s: %s</title>`, label, message)
+	svg.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/>` +
+		`<stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&svg, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, width)
+	fmt.Fprintf(&svg, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/>`, labelWidth)
+	fmt.Fprintf(&svg, `<rect x="%d" width="%d" height="20" fill="%s"/>`, labelWidth, messageWidth, color)
+	fmt.Fprintf(&svg, `<rect width="%d" height="20" fill="url(#s)"/></g>`, width)
+	svg.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+
+	for _, text := range []struct {
+		x     int
+		value string
+	}{
+		{labelWidth / 2, label},
+		{labelWidth + messageWidth/2, message},
+	} {
+		// The shadow first, a pixel below the text.
+		fmt.Fprintf(&svg, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>`, text.x, text.value)
+		fmt.Fprintf(&svg, `<text x="%d" y="14">%s</text>`, text.x, text.value)
+	}
+
+	svg.WriteString(`</g></svg>`)
+
+	return svg.Bytes()
+}
+
+// badgeTextWidth estimates the width of a text written in Verdana 11px, in pixels. The
+// badges are rendered without measuring the font, a close estimate is enough for the
+// text to fit.
+func badgeTextWidth(text string) int {
+	width := 0
+
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(badgeNarrowRunes, r):
+			width += 4
+		case strings.ContainsRune(badgeWideRunes, r):
+			width += 11
+		case strings.ContainsRune(badgeUppercaseRunes, r):
+			width += 8
+		case r < 128:
+			width += 7
+		default:
+			// Symbols such as "✔" are wider than letters.
+			width += 10
+		}
+	}
+
+	return width
+}
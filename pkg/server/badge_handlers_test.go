@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgeOptions(t *testing.T) {
+	o := BadgeOptions{Colors: map[string]string{"✗": "crimson"}}
+	o.Init()
+
+	assert.Equal(t, defaultBadgeLabel, o.Label)
+	assert.Equal(t, defaultBadgeMaxAge, o.MaxAge)
+	assert.Equal(t, "crimson", o.color("✗"))
+	assert.Equal(t, "#4c1", o.color("✔"))
+	assert.Equal(t, badgeUnknownColor, o.color("unknown"))
+	assert.Empty(t, o.validate())
+
+	o.Colors["✔"] = "#12345"
+	o.Colors["⚠"] = `"/><script>`
+	o.MaxAge = -time.Minute
+	assert.Len(t, o.validate(), 3)
+}
+
+func TestBadgeCounts(t *testing.T) {
+	o := BadgeOptions{}
+	o.Init()
+
+	for _, tt := range []struct {
+		name           string
+		counts         map[string]int
+		message, color string
+	}{
+		{"none", map[string]int{}, badgeNoPipeline, badgeUnknownColor},
+		{"zero", map[string]int{"✔": 0}, badgeNoPipeline, badgeUnknownColor},
+		{"success", map[string]int{"✔": 3}, "✔ 3", "#4c1"},
+		{"worst first", map[string]int{"-": 1, "✔": 3, "⚠": 2, "✗": 1}, "✔ 3 ✗ 1 ⚠ 2 - 1", "#e05d44"},
+		{"attention", map[string]int{"✔": 3, "⚠": 2}, "✔ 3 ⚠ 2", "#dfb317"},
+		{"others last", map[string]int{"?": 1, "✔": 3}, "✔ 3 ? 1", "#4c1"},
+		{"others only", map[string]int{"?": 1}, "? 1", badgeUnknownColor},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			message, color := badgeCounts(o, tt.counts)
+			assert.Equal(t, tt.message, message)
+			assert.Equal(t, tt.color, color)
+		})
+	}
+}
+
+func TestRenderBadge(t *testing.T) {
+	svg := string(renderBadge(badge{label: "<team>", message: "✔ 3", color: "#4c1"}))
+
+	assert.Contains(t, svg, `<title>&lt;team&gt;: ✔ 3</title>`)
+	assert.Contains(t, svg, `fill="#4c1"`)
+	assert.NotContains(t, svg, "<team>")
+
+	// The message part grows with its text.
+	assert.Less(t, len(renderBadge(badge{label: "a", message: "b"})), len(svg))
+	assert.Less(t, badgeTextWidth("ill"), badgeTextWidth("mwm"))
+}
+
+func TestServeBadge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	o := BadgeOptions{}
+	o.Init()
+	b := badgeHandlers{options: o}
+
+	r := gin.New()
+	r.GET("/badge", func(c *gin.Context) {
+		b.serve(c, http.StatusOK, badge{label: b.label(c), message: "success", color: o.color("✔")})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/badge?label=deps", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), "deps: success")
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	t.Run("not modified", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/badge?label=deps", nil)
+		req.Header.Set("If-None-Match", etag)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/badge", nil)
+		req.Header.Set("Authorization", "Bearer token")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, "private, max-age=300", w.Header().Get("Cache-Control"))
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	})
+}
@@ -59,7 +59,7 @@ func ListConfigSources(c *gin.Context) {
 	limit, page, err := getPaginationParamFromURLQuery(c)
 
 	if err != nil {
-		logrus.Errorf("getting pagination params: %s", err)
+		logrus.WithContext(c).Errorf("getting pagination params: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: ErrInvalidPaginationParams + ": " + err.Error(),
 		})
@@ -68,7 +68,7 @@ func ListConfigSources(c *gin.Context) {
 
 	rows, totalCount, err := database.GetSourceConfigs(c, kind, id, config, limit, page)
 	if err != nil {
-		logrus.Errorf("searching for config source: %s", err)
+		logrus.WithContext(c).Errorf("searching for config source: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -103,7 +103,7 @@ func SearchConfigSources(c *gin.Context) {
 	queryConfig := configResource{}
 
 	if err := c.ShouldBindJSON(&queryConfig); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -112,7 +112,7 @@ func SearchConfigSources(c *gin.Context) {
 
 	rows, totalCount, err := database.GetSourceConfigs(c, queryConfig.Kind, queryConfig.ID, string(queryConfig.Config), queryConfig.Limit, queryConfig.Page)
 	if err != nil {
-		logrus.Errorf("searching for config source: %s", err)
+		logrus.WithContext(c).Errorf("searching for config source: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -149,7 +149,7 @@ func SearchConfigKinds(c *gin.Context) {
 
 	kinds, err := database.GetConfigKind(c, resourceType)
 	if err != nil {
-		logrus.Errorf("searching for config source kind: %s", err)
+		logrus.WithContext(c).Errorf("searching for config source kind: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -174,7 +174,7 @@ func DeleteConfigSource(c *gin.Context) {
 
 	err := database.DeleteConfigResource(c, "source", id)
 	if err != nil {
-		logrus.Errorf("deleting config source: %s", err)
+		logrus.WithContext(c).Errorf("deleting config source: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -204,7 +204,7 @@ func ListConfigConditions(c *gin.Context) {
 
 	limit, page, err := getPaginationParamFromURLQuery(c)
 	if err != nil {
-		logrus.Errorf("getting pagination params: %s", err)
+		logrus.WithContext(c).Errorf("getting pagination params: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: ErrInvalidPaginationParams + ": " + err.Error(),
 		})
@@ -213,7 +213,7 @@ func ListConfigConditions(c *gin.Context) {
 
 	rows, totalCount, err := database.GetConditionConfigs(c, kind, id, config, limit, page)
 	if err != nil {
-		logrus.Errorf("searching for config condition: %s", err)
+		logrus.WithContext(c).Errorf("searching for config condition: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Message: err.Error(),
 		})
@@ -252,7 +252,7 @@ func SearchConfigConditions(c *gin.Context) {
 	queryConfig := configResource{}
 
 	if err := c.ShouldBindJSON(&queryConfig); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -261,7 +261,7 @@ func SearchConfigConditions(c *gin.Context) {
 
 	configs, totalCount, err := database.GetConditionConfigs(c, queryConfig.Kind, queryConfig.ID, string(queryConfig.Config), queryConfig.Limit, queryConfig.Page)
 	if err != nil {
-		logrus.Errorf("searching for config condition: %s", err)
+		logrus.WithContext(c).Errorf("searching for config condition: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Message: err.Error(),
 		})
@@ -286,7 +286,7 @@ func DeleteConfigCondition(c *gin.Context) {
 
 	err := database.DeleteConfigResource(c, "condition", id)
 	if err != nil {
-		logrus.Errorf("deleting config condition: %s", err)
+		logrus.WithContext(c).Errorf("deleting config condition: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Message: err.Error(),
 		})
@@ -316,7 +316,7 @@ func ListConfigTargets(c *gin.Context) {
 
 	limit, page, err := getPaginationParamFromURLQuery(c)
 	if err != nil {
-		logrus.Errorf("getting pagination params: %s", err)
+		logrus.WithContext(c).Errorf("getting pagination params: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: ErrInvalidPaginationParams + ": " + err.Error(),
 		})
@@ -325,7 +325,7 @@ func ListConfigTargets(c *gin.Context) {
 
 	rows, totalCount, err := database.GetTargetConfigs(c, kind, id, config, limit, page)
 	if err != nil {
-		logrus.Errorf("searching for config target: %s", err)
+		logrus.WithContext(c).Errorf("searching for config target: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -359,7 +359,7 @@ func SearchConfigTargets(c *gin.Context) {
 	queryConfig := configResource{}
 
 	if err := c.ShouldBindJSON(&queryConfig); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -368,7 +368,7 @@ func SearchConfigTargets(c *gin.Context) {
 
 	configs, totalCount, err := database.GetTargetConfigs(c, queryConfig.Kind, queryConfig.ID, string(queryConfig.Config), queryConfig.Limit, queryConfig.Page)
 	if err != nil {
-		logrus.Errorf("searching for config target: %s", err)
+		logrus.WithContext(c).Errorf("searching for config target: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -393,7 +393,7 @@ func DeleteConfigTarget(c *gin.Context) {
 
 	err := database.DeleteConfigResource(c, "target", id)
 	if err != nil {
-		logrus.Errorf("deleting config target: %s", err)
+		logrus.WithContext(c).Errorf("deleting config target: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cors returns a middleware applying the provided CORS policy.
+//
+// It must be installed on the engine rather than on a group. Preflight requests are
+// answered here and never reach the routes: they carry no credentials, so they would
+// otherwise be rejected by the authentication of a private API, and no route answers
+// OPTIONS anyway. The publicReadOnly middleware lets them through for the same reason.
+func cors(o CorsOptions) gin.HandlerFunc {
+	if !o.Enabled() {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	allowedMethods := strings.Join(o.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(o.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(o.ExposedHeaders, ", ")
+	anyHeader := len(o.AllowedHeaders) == 1 && o.AllowedHeaders[0] == "*"
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		// The answer depends on the origin, caches must not serve it to another one.
+		c.Writer.Header().Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !o.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			// A simple request is still served, the browser withholds the response from
+			// the page since it carries no Access-Control-Allow-Origin header.
+			c.Next()
+			return
+		}
+
+		// The origin is reflected rather than answered with the wildcard whenever
+		// credentials are allowed, browsers reject the wildcard along credentials.
+		if o.allowsAnyOrigin() && !o.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+
+		if o.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				c.Header("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		if !o.allowsMethod(c.GetHeader("Access-Control-Request-Method")) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Header("Access-Control-Allow-Methods", allowedMethods)
+
+		if anyHeader {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			c.Header("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+		} else {
+			c.Header("Access-Control-Allow-Headers", allowedHeaders)
+		}
+
+		if o.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(o.MaxAge))
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// newEngine mimics a private API: every route of the group requires a token, which
+	// preflight requests never carry.
+	newEngine := func(o CorsOptions) *gin.Engine {
+		o.Init()
+
+		r := gin.New()
+		r.Use(cors(o))
+
+		api := r.Group("/api/pipeline")
+		api.Use(func(c *gin.Context) {
+			if c.GetHeader("Authorization") == "" {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			c.Next()
+		})
+		api.POST("/reports", func(c *gin.Context) {
+			c.Status(http.StatusCreated)
+		})
+
+		return r
+	}
+
+	preflight := func(r *gin.Engine, origin, method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodOptions, "/api/pipeline/reports", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", "authorization,content-type")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		r := newEngine(CorsOptions{})
+
+		w := preflight(r, "https://front.example", http.MethodPost)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("preflight of an allowed origin bypasses authentication", func(t *testing.T) {
+		r := newEngine(CorsOptions{
+			AllowedOrigins:   []string{"https://front.example"},
+			AllowCredentials: true,
+			MaxAge:           600,
+		})
+
+		w := preflight(r, "https://front.example", http.MethodPost)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://front.example", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), http.MethodPost)
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("preflight of another origin is rejected", func(t *testing.T) {
+		r := newEngine(CorsOptions{AllowedOrigins: []string{"https://front.example"}})
+
+		w := preflight(r, "https://evil.example", http.MethodPost)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("preflight of a method not allowed is rejected", func(t *testing.T) {
+		r := newEngine(CorsOptions{
+			AllowedOrigins: []string{"https://front.example"},
+			AllowedMethods: []string{http.MethodGet},
+		})
+
+		w := preflight(r, "https://front.example", http.MethodPost)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("actual requests still require authentication", func(t *testing.T) {
+		r := newEngine(CorsOptions{AllowedOrigins: []string{"*"}})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/pipeline/reports", nil)
+		req.Header.Set("Origin", "https://front.example")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("credentials are never combined with any origin", func(t *testing.T) {
+		o := CorsOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+		o.Init()
+
+		assert.False(t, o.AllowCredentials)
+	})
+}
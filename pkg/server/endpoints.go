@@ -2,10 +2,14 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	_ "github.com/updatecli/udash/docs"
 	"github.com/zitadel/zitadel-go/v3/pkg/authorization"
@@ -13,8 +17,11 @@ import (
 	"github.com/zitadel/zitadel-go/v3/pkg/zitadel"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
 	"github.com/updatecli/udash/pkg/version"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger" // swagger middleware
@@ -22,6 +29,10 @@ import (
 
 type Server struct {
 	Options Options
+
+	// mu guards Options and live against a reload.
+	mu   sync.Mutex
+	live *liveSettings
 }
 
 type DefaultResponseModel struct {
@@ -75,18 +86,97 @@ func About(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// Run serves the API until ctx is cancelled, then stops gracefully: it stops accepting
+// connections and waits up to the shutdown timeout for the in-flight requests, such as a
+// report being inserted, to complete.
+//
 // @title Udash API
 // @version 1.0
 // @description API for managing Updatecli pipeline reports.
 // @BasePath /api/
-func (s *Server) Run() error {
+func (s *Server) Run(ctx context.Context) error {
+	// Cancelled on every return, it ends the watches of the key and certificate files.
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	s.mu.Lock()
 	// Init Server Option
 	s.Options.Init()
 
-	r := newGinEngine(s.Options)
+	if err := s.Options.Validate(); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("invalid server options: %w", err)
+	}
+
+	r, live := buildGinEngine(ctx, s.Options)
+	s.live = live
+	s.mu.Unlock()
 
-	// listen and server on 0.0.0.0:8080
-	return r.Run()
+	srv := &http.Server{
+		Handler:           r,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       s.Options.ReadTimeout,
+		WriteTimeout:      s.Options.WriteTimeout,
+		IdleTimeout:       s.Options.IdleTimeout,
+	}
+
+	if s.Options.TLS.Enabled() {
+		certificate, err := newCertificateReloader(ctx, s.Options.TLS)
+		if err != nil {
+			return err
+		}
+
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certificate.GetCertificate,
+		}
+	}
+
+	// The reports streams never complete on their own, they are ended for the shutdown not
+	// to wait for them. Their clients resume on another replica.
+	srv.RegisterOnShutdown(database.EndReportSubscriptions)
+
+	listener, err := listen(s.Options.Listen)
+	if err != nil {
+		return fmt.Errorf("listening on %q: %w", s.Options.Listen, err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.Options.TLS.Enabled() {
+			logrus.Infof("Listening and serving HTTPS on %s", s.Options.Listen)
+			// The certificate comes from the TLS config, hence the empty file names.
+			serveErr <- srv.ServeTLS(listener, "", "")
+			return
+		}
+
+		logrus.Infof("Listening and serving HTTP on %s", s.Options.Listen)
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logrus.Infof("Shutting down, waiting up to %s for in-flight requests", s.Options.ShutdownTimeout)
+
+	// ctx is already cancelled, the shutdown needs a deadline of its own.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.Options.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down the server: %w", err)
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	logrus.Infoln("Server stopped")
+
+	return nil
 }
 
 // publicReadOnly returns a middleware leaving the read endpoints open while requiring the
@@ -94,12 +184,22 @@ func (s *Server) Run() error {
 //
 // The read methods are the ones listed, and every other one requires authentication. It is
 // deliberately written that way around: enumerating the write methods instead left PUT
-// unauthenticated, and would leave out any method added later.
-func publicReadOnly(auth gin.HandlerFunc) gin.HandlerFunc {
+// unauthenticated, and would leave out any method added later. The searches are POST
+// requests which only read, they are listed by route in readOnlyRoutes.
+//
+// OPTIONS is among them because CORS preflight requests never carry credentials. They are
+// answered by the cors middleware before reaching this one whenever CORS is enabled.
+func publicReadOnly(auth gin.HandlerFunc, readOnlyRoutes map[string]bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		switch c.Request.Method {
 		case http.MethodGet, http.MethodHead, http.MethodOptions:
 			c.Next()
+		case http.MethodPost:
+			if readOnlyRoutes[c.FullPath()] {
+				c.Next()
+				return
+			}
+			auth(c)
 		default:
 			auth(c)
 		}
@@ -121,16 +221,52 @@ func zitadelAuthorization[T authorization.Ctx](interceptor *Interceptor[T], role
 	return interceptor.RequireAuthorization(authorization.WithRole(role))
 }
 
+// isTraced leaves the probes and the metrics scrapes out of the traces, they would otherwise
+// make up most of them.
+func isTraced(c *gin.Context) bool {
+	switch c.Request.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	default:
+		return true
+	}
+}
+
 func newGinEngine(opts Options) *gin.Engine {
-	r := gin.Default()
+	r, _ := buildGinEngine(context.Background(), opts)
+	return r
+}
 
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+// buildGinEngine returns the engine serving the API, and the middlewares Reload switches.
+// The files the authentication reads are watched until ctx is done.
+func buildGinEngine(ctx context.Context, opts Options) (*gin.Engine, *liveSettings) {
+	r := gin.New()
+
+	// The handlers pass their gin context down to pkg/database. Falling back to the context
+	// of the request is what makes the span and the id of the request, and its cancellation,
+	// reach the queries and their log lines.
+	r.ContextWithFallback = true
+
+	// gin trusts every proxy by default, which lets any client pick the IP it is rate
+	// limited by through X-Forwarded-For. Only the configured proxies are trusted.
+	if err := r.SetTrustedProxies(opts.TrustedProxies); err != nil {
+		slog.Error("trusted proxies could not be set", "error", err)
+		os.Exit(1)
+	}
+	r.Use(requestID())
+	r.Use(otelgin.Middleware("udash", otelgin.WithGinFilter(isTraced)))
+
+	var metricsRegistry *prometheus.Registry
+	if !opts.Metrics.Disabled {
+		var requestMetrics gin.HandlerFunc
+		metricsRegistry, requestMetrics = newMetricsRegistry(opts.Metrics)
+		r.Use(requestMetrics)
+	}
 
-	r.GET("/api", Landing)
-	r.GET("/api/ping", Ping)
-	r.GET("/api/about", About)
+	r.Use(accessLog(), recovery())
 
-	apiPipeline := r.Group("/api/pipeline")
+	// auth is the authentication required by the private endpoints, if any.
+	var auth gin.HandlerFunc
 
 	switch strings.ToLower(opts.Auth.Mode) {
 	case "oauth":
@@ -138,24 +274,15 @@ func newGinEngine(opts Options) *gin.Engine {
 
 		// Built once: the middleware caches the signing keys of the issuer, so building
 		// it per request would refetch them on every call.
-		auth, err := checkJWT()
+		jwtAuth, err := checkJWT(ctx)
 		if err != nil {
 			slog.Error("jwt middleware could not initialize", "error", err)
 			os.Exit(1)
 		}
-
-		switch opts.Auth.Visibility {
-		case VisibilityPublic:
-			logrus.Debugf("API visibility set to public, no authentication required for read endpoints")
-			apiPipeline.Use(publicReadOnly(auth))
-		case VisibilityPrivate:
-			logrus.Debugf("API visibility set to private, authentication required for all endpoints")
-			apiPipeline.Use(auth)
-		}
+		auth = jwtAuth
 
 	case "zitadel":
 		logrus.Debugf("Using ZITADEL authentication mode: %s", opts.Auth.Mode)
-		ctx := context.Background()
 
 		authZ, err := authorization.New(ctx, zitadel.New(opts.Auth.Zitadel.Domain), oauth.DefaultAuthorization(opts.Auth.Zitadel.KeyFile))
 		if err != nil {
@@ -164,49 +291,117 @@ func newGinEngine(opts Options) *gin.Engine {
 		}
 
 		zitadelInterceptor := NewZitadelGin(authZ)
-		auth := zitadelAuthorization(zitadelInterceptor, opts.Auth.Zitadel.Role)
-
-		switch opts.Auth.Visibility {
-		case VisibilityPublic:
-			logrus.Debugf("API visibility set to public, no authentication required for read endpoints")
-			apiPipeline.Use(publicReadOnly(auth))
-		case VisibilityPrivate:
-			logrus.Debugf("API visibility set to private, authentication required for all endpoints")
-			apiPipeline.Use(auth)
-		}
+		auth = zitadelAuthorization(zitadelInterceptor, opts.Auth.Zitadel.Role)
 	}
 
-	apiPipeline.GET("/labels", ListLabels)
-	apiPipeline.GET("/scms", ListSCMs)
-	apiPipeline.GET("/reports", ListPipelineReports)
-	apiPipeline.GET("/reports/:id", GetPipelineReportByID)
-	apiPipeline.GET("/config/kinds", SearchConfigKinds)
-	apiPipeline.GET("/config/sources", ListConfigSources)
-	apiPipeline.GET("/config/conditions", ListConfigConditions)
-	apiPipeline.GET("/config/targets", ListConfigTargets)
-
-	// Public endpoints when API visibility is set to public
-	if opts.Auth.Mode != "" && opts.Auth.Visibility == VisibilityPublic {
-		r.POST("/api/pipeline/config/sources/search", SearchConfigSources)
-		r.POST("/api/pipeline/config/conditions/search", SearchConfigConditions)
-		r.POST("/api/pipeline/config/targets/search", SearchConfigTargets)
-		r.POST("/api/pipeline/labels/search", SearchLabels)
-		r.POST("/api/pipeline/reports/search", SearchPipelineReports)
-		r.POST("/api/pipeline/reports/summary", SearchPipelineReportsSummary)
-		r.POST("/api/pipeline/scms/search", SearchSCMs)
-	} else {
-		apiPipeline.POST("/config/sources/search", SearchConfigSources)
-		apiPipeline.POST("/config/conditions/search", SearchConfigConditions)
-		apiPipeline.POST("/config/targets/search", SearchConfigTargets)
-		apiPipeline.POST("/labels/search", SearchLabels)
-		apiPipeline.POST("/reports/search", SearchPipelineReports)
-		apiPipeline.POST("/reports/summary", SearchPipelineReportsSummary)
-		apiPipeline.POST("/scms/search", SearchSCMs)
-	}
-
-	apiPipeline.POST("/reports", CreatePipelineReport)
-	apiPipeline.PUT("/reports/:id", UpdatePipelineReport)
-	apiPipeline.DELETE("/reports/:id", DeletePipelineReport)
+	// The POST routes which only read, left open by a public API.
+	readOnlyRoutes := map[string]bool{}
+	for _, path := range []string{
+		"/config/sources/search",
+		"/config/conditions/search",
+		"/config/targets/search",
+		"/labels/search",
+		"/reports/search",
+		"/reports/summary",
+		"/reports/export",
+		"/scms/search",
+	} {
+		readOnlyRoutes["/api/pipeline"+path] = true
+	}
 
-	return r
+	// The middlewares of the options applied without a restart are looked up on every
+	// request. The limiters are still built once so that every route of a kind draws
+	// from the same budget.
+	live := newLiveSettings(opts, auth, readOnlyRoutes)
+	r.Use(live.cors.handle)
+
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	// The probes are left out of the authentication and the rate limits, a probe rejected
+	// by either would take a healthy replica out of rotation.
+	r.GET("/healthz", Healthz)
+	r.GET("/readyz", Readyz)
+
+	r.GET("/api", Landing)
+	r.GET("/api/ping", Ping)
+	r.GET("/api/about", About)
+
+	apiPipeline := r.Group("/api/pipeline")
+	apiPipeline.Use(live.authentication.handle, queryTimeout(), readPrimary())
+
+	// The reports stream and the reports export last as long as the client reads them, they
+	// are left out of the query timeout. The stream bounds the query resuming it itself.
+	apiStream := r.Group("/api/pipeline")
+	apiStream.Use(live.authentication.handle, readPrimary())
+
+	// The badges follow the visibility of the API, as the pipelines they render do.
+	apiBadges := r.Group("/api/badges")
+	apiBadges.Use(live.authentication.handle, queryTimeout(), readPrimary())
+
+	apiFeeds := r.Group("/api/feeds")
+	apiFeeds.Use(live.authentication.handle, queryTimeout(), readPrimary())
+
+	if metricsRegistry != nil {
+		r.GET("/metrics", live.metricsAuth.handle, metricsHandler(metricsRegistry))
+	}
+
+	readLimit := live.readLimit.handle
+	searchLimit := live.searchLimit.handle
+	publishLimit := live.publishLimit.handle
+
+	apiPipeline.GET("/labels", readLimit, ListLabels)
+	apiPipeline.GET("/scms", readLimit, ListSCMs)
+	apiPipeline.GET("/reports", readLimit, ListPipelineReports)
+	apiPipeline.GET("/reports/:id", readLimit, GetPipelineReportByID)
+	apiPipeline.GET("/config/kinds", readLimit, SearchConfigKinds)
+	apiPipeline.GET("/config/sources", readLimit, ListConfigSources)
+	apiPipeline.GET("/config/conditions", readLimit, ListConfigConditions)
+	apiPipeline.GET("/config/targets", readLimit, ListConfigTargets)
+	apiPipeline.GET("/acknowledgements", readLimit, ListAcknowledgements)
+	apiPipeline.GET("/intervals", readLimit, ListReportingIntervals)
+	apiStream.GET("/reports/stream", readLimit, StreamPipelineReports)
+
+	badges := badgeHandlers{options: opts.Badges}
+	apiBadges.GET("/pipelines/:id", readLimit, badges.PipelineBadge)
+	apiBadges.GET("/scm", readLimit, badges.SCMBadge)
+	apiBadges.GET("/labels", readLimit, badges.LabelsBadge)
+
+	apiFeeds.GET("/labels", readLimit, LabelsFeed)
+	apiFeeds.GET("/scm", readLimit, SCMFeed)
+
+	apiPipeline.POST("/config/sources/search", searchLimit, SearchConfigSources)
+	apiPipeline.POST("/config/conditions/search", searchLimit, SearchConfigConditions)
+	apiPipeline.POST("/config/targets/search", searchLimit, SearchConfigTargets)
+	apiPipeline.POST("/labels/search", searchLimit, SearchLabels)
+	apiPipeline.POST("/reports/search", searchLimit, SearchPipelineReports)
+	apiPipeline.POST("/reports/summary", searchLimit, SearchPipelineReportsSummary)
+	apiPipeline.POST("/scms/search", searchLimit, SearchSCMs)
+	apiStream.POST("/reports/export", searchLimit, ExportPipelineReports)
+
+	apiPipeline.POST("/reports", publishLimit, live.reportSizeLimiter.handle, CreatePipelineReport)
+	apiPipeline.PUT("/reports/:id", publishLimit, UpdatePipelineReport)
+	apiPipeline.DELETE("/reports/:id", publishLimit, DeletePipelineReport)
+	apiPipeline.POST("/acknowledgements", publishLimit, CreateAcknowledgement)
+	apiPipeline.DELETE("/acknowledgements/:id", publishLimit, DeleteAcknowledgement)
+	apiPipeline.POST("/intervals", publishLimit, CreateReportingInterval)
+	apiPipeline.DELETE("/intervals/:id", publishLimit, DeleteReportingInterval)
+
+	// The admin endpoints go through every report, they are left out of the query timeout.
+	// They require authentication whatever the visibility, the read ones included: the
+	// delivery log tells where the notifications are sent.
+	apiAdmin := r.Group("/api/admin")
+	if auth != nil {
+		apiAdmin.Use(auth)
+	}
+
+	apiAdmin.POST("/db/check", publishLimit, CheckDatabase)
+	apiAdmin.GET("/reprocess", readLimit, ListReprocessJobs)
+	apiAdmin.GET("/reprocess/:id", readLimit, GetReprocessJob)
+	apiAdmin.POST("/reprocess", publishLimit, CreateReprocessJob)
+	apiAdmin.POST("/reprocess/:id/cancel", publishLimit, CancelReprocessJob)
+	apiAdmin.GET("/notifications/deliveries", readLimit, ListNotificationDeliveries)
+	apiAdmin.POST("/notifications/rules/:name/test", publishLimit, TestNotificationRule)
+	apiAdmin.POST("/notifications/digests/:name/send", publishLimit, SendNotificationDigest)
+
+	return r, live
 }
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,7 +12,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -41,9 +45,9 @@ func TestEndpoints(t *testing.T) {
 	require.NoError(t, err)
 
 	// Connect to the database and run migrations
-	require.NoError(t, database.Connect(database.Options{URI: dbURL}))
+	require.NoError(t, database.Connect(ctx, database.Options{URI: dbURL}))
 	t.Log("Postgres Container connected")
-	require.NoError(t, database.RunMigrationUp())
+	require.NoError(t, database.RunMigrationUp(ctx))
 	t.Log("Postgres Container migrations run")
 
 	t.Run("GET /api", func(t *testing.T) {
@@ -60,6 +64,32 @@ func TestEndpoints(t *testing.T) {
 		}, assert.Equal)
 	})
 
+	t.Run("GET /healthz", func(t *testing.T) {
+		resp := doGetRequest(t, srv, "/healthz")
+		assertJSONResponse(t, resp, map[string]any{
+			"status": "ok",
+		}, assert.Equal)
+	})
+
+	t.Run("GET /readyz", func(t *testing.T) {
+		expected, err := database.ExpectedSchemaVersion()
+		require.NoError(t, err)
+
+		resp := doGetRequest(t, srv, "/readyz")
+		assertJSONResponse(t, resp, map[string]any{
+			"status": "ok",
+			"checks": map[string]any{
+				"database": map[string]any{
+					"status": "ok",
+				},
+				"migrations": map[string]any{
+					"status":  "ok",
+					"message": fmt.Sprintf("schema version %d", expected),
+				},
+			},
+		}, assert.Equal)
+	})
+
 	t.Run("GET /api/about", func(t *testing.T) {
 		resp := doGetRequest(t, srv, "/api/about")
 		assertJSONResponse(t, resp, map[string]any{
@@ -173,6 +203,8 @@ func TestEndpoints(t *testing.T) {
 					"ConditionConfigIDs": map[string]any{},
 					"SourceConfigIDs":    map[string]any{},
 					"TargetConfigIDs":    map[string]any{},
+					"Acknowledgement":    nil,
+					"Stale":              false,
 				},
 			}, removeFieldsAsserter("data", "CreatedAt", "UpdatedAt", "Labels"))
 		})
@@ -235,6 +267,8 @@ func TestEndpoints(t *testing.T) {
 					"ConditionConfigIDs": map[string]any{},
 					"SourceConfigIDs":    map[string]any{},
 					"TargetConfigIDs":    map[string]any{},
+					"Acknowledgement":    nil,
+					"Stale":              false,
 				},
 			}, removeFieldsAsserter("data", "CreatedAt", "UpdatedAt", "Labels"))
 		})
@@ -1159,6 +1193,554 @@ func TestEndpoints(t *testing.T) {
 		})
 	})
 
+	t.Run("acknowledging a pipeline", func(t *testing.T) {
+		truncateReports(t)
+		t.Cleanup(func() {
+			truncateReports(t)
+
+			_, err := database.DB.Exec(context.TODO(), "DELETE FROM acknowledgements")
+			require.NoError(t, err)
+		})
+
+		for _, r := range []reports.Report{
+			{Name: "known failure", Result: "✗", ID: "known", PipelineID: "known"},
+			{Name: "flaky", Result: "✗", ID: "flaky", PipelineID: "flaky", Labels: map[string]string{"team": "qa"}},
+			{Name: "healthy", Result: "✔", ID: "healthy", PipelineID: "healthy"},
+		} {
+			_, err := database.InsertReport(ctx, r)
+			require.NoError(t, err)
+		}
+
+		acknowledge := func(body map[string]any) (int, map[string]any) {
+			t.Helper()
+
+			resp := doPostRequest(t, srv, "/api/pipeline/acknowledgements", body)
+			defer resp.Body.Close()
+
+			blob := map[string]any{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+
+			return resp.StatusCode, blob
+		}
+
+		t.Run("rejects an invalid acknowledgement", func(t *testing.T) {
+			for _, body := range []map[string]any{
+				{"reason": "no selector", "author": "ops"},
+				{"pipeline_id": "known", "labels": map[string]string{"team": "qa"}, "reason": "both", "author": "ops"},
+				{"pipeline_id": "known", "author": "ops"},
+				{"pipeline_id": "known", "reason": "anonymous"},
+				{"pipeline_id": "known", "reason": "expired", "author": "ops", "expires_at": time.Now().Add(-time.Hour)},
+			} {
+				code, _ := acknowledge(body)
+				assert.Equal(t, http.StatusBadRequest, code, body)
+			}
+		})
+
+		code, byID := acknowledge(map[string]any{
+			"pipeline_id": "known", "reason": "upstream outage", "author": "ops",
+		})
+		require.Equal(t, http.StatusCreated, code)
+
+		code, _ = acknowledge(map[string]any{
+			"labels": map[string]string{"team": "qa"}, "reason": "flaky tests", "author": "qa",
+			"expires_at": time.Now().Add(time.Hour),
+		})
+		require.Equal(t, http.StatusCreated, code)
+
+		t.Run("lists the acknowledgements", func(t *testing.T) {
+			resp := doGetRequest(t, srv, "/api/pipeline/acknowledgements")
+			defer resp.Body.Close()
+
+			blob := AcknowledgementsResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+			require.Len(t, blob.Data, 2)
+			assert.Equal(t, "flaky tests", blob.Data[0].Reason)
+			assert.Equal(t, "upstream outage", blob.Data[1].Reason)
+		})
+
+		t.Run("flags the acknowledged reports", func(t *testing.T) {
+			resp := doPostRequest(t, srv, "/api/pipeline/reports/search", map[string]any{})
+			defer resp.Body.Close()
+
+			blob := struct {
+				Data []struct {
+					Name            string
+					Acknowledgement *database.Acknowledgement
+				}
+			}{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+
+			reasons := map[string]string{}
+			for _, report := range blob.Data {
+				if report.Acknowledgement != nil {
+					reasons[report.Name] = report.Acknowledgement.Reason
+				}
+			}
+
+			assert.Equal(t, map[string]string{
+				"known failure": "upstream outage",
+				"flaky":         "flaky tests",
+			}, reasons)
+		})
+
+		t.Run("leaves the acknowledged reports out of the summary on demand", func(t *testing.T) {
+			countOf := func(body map[string]any) float64 {
+				t.Helper()
+
+				blob := map[string]any{}
+				resp := doPostRequest(t, srv, "/api/pipeline/reports/summary", body)
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+				defer resp.Body.Close()
+
+				return blob["total_count"].(float64)
+			}
+
+			assert.Equal(t, float64(3), countOf(map[string]any{"days": 1}))
+			assert.Equal(t, float64(1), countOf(map[string]any{"days": 1, "exclude_acknowledged": true}))
+		})
+
+		t.Run("deletes an acknowledgement", func(t *testing.T) {
+			id := byID["data"].(map[string]any)["id"].(string)
+
+			for _, expected := range []int{http.StatusOK, http.StatusNotFound} {
+				r, err := http.NewRequest(http.MethodDelete, srv.URL+"/api/pipeline/acknowledgements/"+id, nil)
+				require.NoError(t, err)
+
+				resp, err := srv.Client().Do(r)
+				require.NoError(t, err)
+				resp.Body.Close()
+
+				assert.Equal(t, expected, resp.StatusCode)
+			}
+
+			acknowledgement, err := database.FindAcknowledgement(ctx, "known", nil)
+			require.NoError(t, err)
+			assert.Nil(t, acknowledgement)
+		})
+	})
+
+	t.Run("detecting the stale pipelines", func(t *testing.T) {
+		truncateReports(t)
+		t.Cleanup(func() {
+			truncateReports(t)
+
+			_, err := database.DB.Exec(context.TODO(), "DELETE FROM reporting_intervals")
+			require.NoError(t, err)
+			_, err = database.DB.Exec(context.TODO(), "DELETE FROM stale_pipelines")
+			require.NoError(t, err)
+		})
+
+		for _, r := range []reports.Report{
+			{Name: "silent", Result: "✔", ID: "silent", PipelineID: "silent"},
+			{Name: "nightly", Result: "✔", ID: "nightly", PipelineID: "nightly", Labels: map[string]string{"schedule": "nightly"}},
+		} {
+			_, err := database.InsertReport(ctx, r)
+			require.NoError(t, err)
+		}
+
+		// Both pipelines last reported two hours ago.
+		_, err := database.DB.Exec(ctx, "UPDATE pipelineReports SET updated_at = localtimestamp - interval '2 hours'")
+		require.NoError(t, err)
+
+		expect := func(body map[string]any) (int, map[string]any) {
+			t.Helper()
+
+			resp := doPostRequest(t, srv, "/api/pipeline/intervals", body)
+			defer resp.Body.Close()
+
+			blob := map[string]any{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+
+			return resp.StatusCode, blob
+		}
+
+		t.Run("rejects an invalid reporting interval", func(t *testing.T) {
+			for _, body := range []map[string]any{
+				{"interval": "soon"},
+				{"interval": "30s"},
+				{"pipeline_id": "silent", "labels": map[string]string{"schedule": "nightly"}, "interval": "1h"},
+			} {
+				code, _ := expect(body)
+				assert.Equal(t, http.StatusBadRequest, code, body)
+			}
+		})
+
+		code, byID := expect(map[string]any{"pipeline_id": "silent", "interval": "1h"})
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, float64(3600), byID["data"].(map[string]any)["interval_seconds"])
+
+		code, _ = expect(map[string]any{"labels": map[string]string{"schedule": "nightly"}, "interval": "24h"})
+		require.Equal(t, http.StatusCreated, code)
+
+		// The catch-all interval is overridden by the ones above.
+		code, _ = expect(map[string]any{"interval": "1m"})
+		require.Equal(t, http.StatusCreated, code)
+
+		t.Run("lists the reporting intervals", func(t *testing.T) {
+			resp := doGetRequest(t, srv, "/api/pipeline/intervals")
+			defer resp.Body.Close()
+
+			blob := ReportingIntervalsResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+			assert.Len(t, blob.Data, 3)
+		})
+
+		t.Run("filters the reports of the stale pipelines", func(t *testing.T) {
+			for stale, expected := range map[bool][]string{true: {"silent"}, false: {"nightly"}} {
+				resp := doPostRequest(t, srv, "/api/pipeline/reports/search", map[string]any{"stale": stale})
+
+				blob := struct {
+					Data []struct {
+						Name  string
+						Stale bool
+					}
+				}{}
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+				resp.Body.Close()
+
+				names := []string{}
+				for _, report := range blob.Data {
+					assert.Equal(t, stale, report.Stale)
+					names = append(names, report.Name)
+				}
+				assert.Equal(t, expected, names, "stale: %t", stale)
+			}
+		})
+
+		t.Run("claims a stale pipeline once", func(t *testing.T) {
+			claimed, err := database.ClaimStalePipelines(ctx)
+			require.NoError(t, err)
+			require.Len(t, claimed, 1)
+			assert.Equal(t, "silent", claimed[0].Report.ID)
+			assert.Equal(t, time.Hour, claimed[0].Interval)
+			assert.WithinDuration(t, time.Now().Add(-2*time.Hour), claimed[0].LastReportAt, time.Minute)
+
+			claimed, err = database.ClaimStalePipelines(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, claimed)
+		})
+
+		t.Run("deletes a reporting interval", func(t *testing.T) {
+			id := byID["data"].(map[string]any)["id"].(string)
+
+			for _, expected := range []int{http.StatusOK, http.StatusNotFound} {
+				r, err := http.NewRequest(http.MethodDelete, srv.URL+"/api/pipeline/intervals/"+id, nil)
+				require.NoError(t, err)
+
+				resp, err := srv.Client().Do(r)
+				require.NoError(t, err)
+				resp.Body.Close()
+
+				assert.Equal(t, expected, resp.StatusCode)
+			}
+		})
+	})
+
+	t.Run("GET /api/pipeline/reports/stream", func(t *testing.T) {
+		truncateReports(t)
+		t.Cleanup(func() { truncateReports(t) })
+
+		listenCtx, stopListening := context.WithCancel(ctx)
+		listenDone := make(chan struct{})
+		go func() {
+			defer close(listenDone)
+			database.ListenReports(listenCtx)
+		}()
+		t.Cleanup(func() {
+			stopListening()
+			<-listenDone
+		})
+		t.Cleanup(database.OnReportInserted(database.PublishReportInserted))
+
+		// The reports inserted before the listener listens are not announced.
+		require.Eventually(t, func() bool {
+			listening := 0
+			err := database.DB.QueryRow(ctx,
+				"SELECT count(*) FROM pg_stat_activity WHERE query = 'LISTEN udash_reports'",
+			).Scan(&listening)
+			return err == nil && listening > 0
+		}, 10*time.Second, 50*time.Millisecond)
+
+		insert := func(name, result string) string {
+			t.Helper()
+
+			id, err := database.InsertReport(ctx, reports.Report{Name: name, Result: result, ID: name, PipelineID: name})
+			require.NoError(t, err)
+
+			return id
+		}
+
+		last := insert("received", "✗")
+		insert("missed success", "✔")
+		missed := insert("missed failure", "✗")
+
+		t.Run("rejects an invalid last event id", func(t *testing.T) {
+			resp := doGetRequest(t, srv, "/api/pipeline/reports/stream?last_event_id=latest")
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+
+		requestCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		r, err := http.NewRequestWithContext(requestCtx, http.MethodGet,
+			srv.URL+"/api/pipeline/reports/stream?results="+url.QueryEscape("✗"), nil)
+		require.NoError(t, err)
+		r.Header.Set("Last-Event-ID", last)
+
+		resp, err := srv.Client().Do(r)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		events := bufio.NewReader(resp.Body)
+		next := func() (string, database.StreamedReport) {
+			t.Helper()
+
+			id, report := "", database.StreamedReport{}
+			for {
+				line, err := events.ReadString('\n')
+				require.NoError(t, err)
+
+				line = strings.TrimSuffix(line, "\n")
+				switch {
+				case line == "" && id != "":
+					return id, report
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "data: "):
+					require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &report))
+				}
+			}
+		}
+
+		t.Run("replays the missed reports", func(t *testing.T) {
+			id, report := next()
+			assert.Equal(t, missed, id)
+			assert.Equal(t, "missed failure", report.Name)
+			assert.Equal(t, "✗", report.Result)
+		})
+
+		t.Run("streams the inserted reports", func(t *testing.T) {
+			insert("new success", "✔")
+			inserted := insert("new failure", "✗")
+
+			id, report := next()
+			assert.Equal(t, inserted, id)
+			assert.Equal(t, "new failure", report.PipelineID)
+		})
+	})
+
+	t.Run("GET /api/badges", func(t *testing.T) {
+		truncateReports(t)
+		t.Cleanup(func() { truncateReports(t) })
+
+		for _, r := range []reports.Report{
+			{Name: "web", Result: "✔", ID: "web", PipelineID: "web", Labels: map[string]string{"team": "platform"}},
+			{Name: "api", Result: "✗", ID: "api", PipelineID: "api", Labels: map[string]string{"team": "platform"}},
+			{Name: "docs", Result: "✔", ID: "docs", PipelineID: "docs", Labels: map[string]string{"team": "docs"}},
+		} {
+			_, err := database.InsertReport(ctx, r)
+			require.NoError(t, err)
+		}
+
+		expect := func(path string, status int, message string) {
+			t.Helper()
+
+			resp := doGetRequest(t, srv, path)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, status, resp.StatusCode, path)
+			assert.Equal(t, "image/svg+xml; charset=utf-8", resp.Header.Get("Content-Type"), path)
+			assert.NotEmpty(t, resp.Header.Get("ETag"), path)
+			assert.Contains(t, string(body), "<title>badge: "+message+"</title>", path)
+		}
+
+		expect("/api/badges/pipelines/api?label=badge", http.StatusOK, "failure")
+		expect("/api/badges/pipelines/unknown?label=badge", http.StatusNotFound, badgeNotFound)
+		expect("/api/badges/labels?label=badge&labels[team]=platform", http.StatusOK, "✔ 1 ✗ 1")
+		expect("/api/badges/labels?label=badge&labels[team]=none", http.StatusOK, badgeNoPipeline)
+		expect("/api/badges/scm?label=badge&url=https://example.invalid&branch=main", http.StatusNotFound, badgeNotFound)
+
+		resp := doGetRequest(t, srv, "/api/badges/scm?url=https://example.invalid")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("GET /api/feeds", func(t *testing.T) {
+		truncateReports(t)
+		t.Cleanup(func() { truncateReports(t) })
+
+		ids := []string{}
+		for _, r := range []reports.Report{
+			{Name: "web", Result: "✔", ID: "web", PipelineID: "web", Labels: map[string]string{"team": "platform"}},
+			{Name: "web", Result: "✗", ID: "web", PipelineID: "web", Labels: map[string]string{"team": "platform"}},
+			{Name: "web", Result: "✗", ID: "web", PipelineID: "web", Labels: map[string]string{"team": "platform"}},
+			{Name: "docs", Result: "✗", ID: "docs", PipelineID: "docs", Labels: map[string]string{"team": "docs"}},
+		} {
+			id, err := database.InsertReport(ctx, r)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+
+		// Only the report changing the result of web is an entry: the first report of a
+		// pipeline is not a change, nor is a report keeping its result.
+		for _, format := range []string{"atom", "rss"} {
+			resp := doGetRequest(t, srv, "/api/feeds/labels?format="+format)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode, format)
+			assert.Equal(t, "application/"+format+"+xml; charset=utf-8", resp.Header.Get("Content-Type"))
+			assert.Equal(t, 1, strings.Count(string(body), "urn:uuid:"), format)
+			assert.Contains(t, string(body), "urn:uuid:"+ids[1], format)
+			assert.Contains(t, string(body), "✗ web changed from ✔ to ✗", format)
+		}
+
+		resp := doGetRequest(t, srv, "/api/feeds/labels?labels[team]=docs")
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.NotContains(t, string(body), "<entry>")
+
+		resp = doGetRequest(t, srv, "/api/feeds/scm?url=https://example.invalid&branch=main")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("POST /api/pipeline/reports/export", func(t *testing.T) {
+		truncateReports(t)
+		t.Cleanup(func() { truncateReports(t) })
+
+		for i := range 120 {
+			name := fmt.Sprintf("export-%d", i)
+			r := reports.Report{Name: name, Result: "✔", ID: name, PipelineID: name, Labels: map[string]string{"team": "platform"}}
+			if i%2 == 1 {
+				r.Result = "✗"
+			}
+
+			_, err := database.InsertReport(ctx, r)
+			require.NoError(t, err)
+		}
+
+		// The pagination of the search is ignored.
+		t.Run("as CSV", func(t *testing.T) {
+			resp := doPostRequest(t, srv, "/api/pipeline/reports/export", map[string]any{
+				"results": []string{"✗"},
+				"limit":   10,
+			})
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+
+			records, err := csv.NewReader(resp.Body).ReadAll()
+			require.NoError(t, err)
+			require.Len(t, records, 61)
+			assert.Equal(t, exportCSVHeader, records[0])
+			assert.Equal(t, "✗", records[1][3])
+			assert.Equal(t, "team=platform", records[1][5])
+		})
+
+		t.Run("as NDJSON", func(t *testing.T) {
+			resp := doPostRequest(t, srv, "/api/pipeline/reports/export", map[string]any{"format": "ndjson"})
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+			exported := 0
+			decoder := json.NewDecoder(resp.Body)
+			for decoder.More() {
+				report := database.SearchLatestReportData{}
+				require.NoError(t, decoder.Decode(&report))
+				assert.Equal(t, report.Name, report.Report.Name)
+				exported++
+			}
+			assert.Equal(t, 120, exported)
+		})
+	})
+
+	t.Run("projecting the reports on some fields", func(t *testing.T) {
+		truncateReports(t)
+		t.Cleanup(func() {
+			truncateReports(t)
+
+			_, err := database.DB.Exec(context.TODO(), "DELETE FROM acknowledgements")
+			require.NoError(t, err)
+		})
+
+		_, err := database.InsertReport(ctx, reports.Report{
+			Name: "Projected", Result: "✗", ID: "projected", PipelineID: "projected",
+			Labels: map[string]string{"team": "platform"},
+		})
+		require.NoError(t, err)
+
+		_, err = database.CreateAcknowledgement(ctx, database.NewAcknowledgement{
+			Labels: map[string]string{"team": "platform"},
+			Reason: "known failure",
+			Author: "test",
+		})
+		require.NoError(t, err)
+
+		decode := func(t *testing.T, resp *http.Response) []map[string]any {
+			t.Helper()
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			blob := struct {
+				Data       []map[string]any `json:"data"`
+				TotalCount int              `json:"total_count"`
+			}{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&blob))
+			require.Len(t, blob.Data, 1)
+			assert.Equal(t, 1, blob.TotalCount)
+
+			return blob.Data
+		}
+
+		t.Run("POST /api/pipeline/reports/search", func(t *testing.T) {
+			data := decode(t, doPostRequest(t, srv, "/api/pipeline/reports/search", map[string]any{
+				"fields": []string{"Name", "Result", "Acknowledgement"},
+			}))
+
+			assert.ElementsMatch(t, []string{"Name", "Result", "Acknowledgement"}, slices.Collect(maps.Keys(data[0])))
+			assert.Equal(t, "Projected", data[0]["Name"])
+			assert.Equal(t, "✗", data[0]["Result"])
+			assert.NotNil(t, data[0]["Acknowledgement"], "the acknowledgements match the labels without the payload")
+		})
+
+		t.Run("GET /api/pipeline/reports", func(t *testing.T) {
+			data := decode(t, doGetRequest(t, srv, "/api/pipeline/reports?fields=ID,Name&fields=Report"))
+			assert.ElementsMatch(t, []string{"ID", "Name", "Report"}, slices.Collect(maps.Keys(data[0])))
+			assert.Equal(t, "projected", data[0]["Report"].(map[string]any)["ID"])
+
+			data = decode(t, doGetRequest(t, srv, "/api/pipeline/reports?include_payload=false"))
+			assert.NotContains(t, data[0], "Report")
+			assert.Equal(t, "Projected", data[0]["Name"])
+			assert.Equal(t, "✗", data[0]["Result"])
+		})
+
+		t.Run("with an unknown field", func(t *testing.T) {
+			resp := doGetRequest(t, srv, "/api/pipeline/reports?fields=Name,Payload")
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+
+		t.Run("with an invalid include_payload", func(t *testing.T) {
+			resp := doGetRequest(t, srv, "/api/pipeline/reports?include_payload=maybe")
+			assertErrorResponse(t, resp, http.StatusBadRequest, ErrInvalidIncludePayloadParam)
+		})
+	})
+
 	t.Run("POST /api/pipeline/reports/search combining resource filters", func(t *testing.T) {
 		truncateReports(t)
 
@@ -1275,6 +1857,47 @@ func TestEndpoints(t *testing.T) {
 			assertErrorResponse(t, resp, http.StatusBadRequest, ErrInvalidTimeRangeParams)
 		})
 	})
+
+	t.Run("POST /api/admin/db/check repairs a drifted report", func(t *testing.T) {
+		reportID, err := database.InsertReport(ctx, reports.Report{
+			Name: "drifted", Result: "✔", ID: "drifted", PipelineID: "drifted",
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			deleteReport(t, reportID)
+		})
+
+		_, err = database.DB.Exec(ctx, "UPDATE pipelineReports SET pipeline_result = '' WHERE id = $1", reportID)
+		require.NoError(t, err)
+
+		resp := doPostRequest(t, srv, "/api/admin/db/check?repair=true", nil)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body := CheckDatabaseResponse{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.NotZero(t, body.Data.Repaired)
+		assert.Contains(t, body.Data.Reports, database.ReportDrift{
+			ID:      uuid.MustParse(reportID),
+			Columns: []string{"pipeline_result"},
+		})
+
+		resp = doPostRequest(t, srv, "/api/admin/db/check", nil)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body = CheckDatabaseResponse{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		for _, drift := range body.Data.Reports {
+			assert.NotEqual(t, reportID, drift.ID.String())
+		}
+	})
+
+	t.Run("POST /api/admin/db/check with an invalid repair", func(t *testing.T) {
+		resp := doPostRequest(t, srv, "/api/admin/db/check?repair=maybe", nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
 }
 
 // hourStart returns the beginning of the UTC hour of the provided time.
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+const (
+	// exportFormatCSV and exportFormatNDJSON are the formats the reports are exported in.
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+	// exportFlushInterval is how many reports are exported between two flushes, so that
+	// the client receives the export as it is read rather than once it is complete.
+	exportFlushInterval = 100
+)
+
+// exportContentTypes are the content types of the export formats.
+var exportContentTypes = map[string]string{
+	exportFormatCSV:    "text/csv; charset=utf-8",
+	exportFormatNDJSON: "application/x-ndjson",
+}
+
+// exportMediaTypes are the media types an Accept header may request, the preferred one
+// first, and the format of each.
+var exportMediaTypes = []struct {
+	mediaType, format string
+}{
+	{"text/csv", exportFormatCSV},
+	{"application/x-ndjson", exportFormatNDJSON},
+	{"application/ndjson", exportFormatNDJSON},
+}
+
+// exportCSVHeader are the columns of the CSV export.
+var exportCSVHeader = []string{
+	"id",
+	"pipeline_id",
+	"pipeline_name",
+	"result",
+	"scms",
+	"labels",
+	"created_at",
+	"updated_at",
+	"open_action",
+}
+
+// ExportPipelineReportsRequest represents the filters of the reports to export.
+type ExportPipelineReportsRequest struct {
+	SearchPipelineReportsRequest
+	// Format is the format of the export, "csv" or "ndjson". It takes precedence over the
+	// Accept header, and defaults to "csv" when neither is set.
+	Format string `json:"format,omitempty"`
+}
+
+// ExportPipelineReports exports every pipeline report matching the search filters.
+// @Summary Export pipeline reports
+// @Description Export every pipeline report matching the filters of the reports search, without pagination: limit
+// @Description and page are ignored. The reports are streamed as they are read, either as CSV with one flattened row
+// @Description per report, or as NDJSON with one report per line. The format is the format field of the body, else the
+// @Description one the Accept header requests, text/csv or application/x-ndjson. The NDJSON export honors the fields
+// @Description and include_payload filters, the CSV one ignores them as its columns are read out of the payload.
+// @Tags Pipeline Reports
+// @Accept json
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param body body ExportPipelineReportsRequest true "Export filters"
+// @Success 200 {string} string
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 406 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/reports/export [post]
+func ExportPipelineReports(c *gin.Context) {
+	request := ExportPipelineReportsRequest{}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	format := request.Format
+	switch format {
+	case exportFormatCSV, exportFormatNDJSON:
+	case "":
+		format = negotiateExportFormat(c)
+		if format == "" {
+			c.JSON(http.StatusNotAcceptable, DefaultResponseModel{
+				Err: fmt.Sprintf("unsupported Accept header, accepted values are %q and %q",
+					"text/csv", "application/x-ndjson"),
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: fmt.Sprintf("invalid format %q, accepted values are %q and %q",
+				request.Format, exportFormatCSV, exportFormatNDJSON),
+		})
+		return
+	}
+
+	if err := validateTimeRangeParams(request.StartTime, request.EndTime); err != nil {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	// The columns of the CSV export are read out of the payload, it is not projected.
+	projection := reportProjection{}
+	if format == exportFormatNDJSON {
+		var err error
+		projection, err = request.projection()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: err.Error(),
+			})
+			return
+		}
+	}
+
+	params := request.params(c)
+	params.Limit, params.Page = 0, 0
+	params.ExcludePayload = projection.excludePayload
+
+	// An export lasts as long as the client reads it, the write timeout of the server
+	// would cut it.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logrus.WithContext(c).Debugf("clearing the write deadline of the reports export: %s", err)
+	}
+
+	export := newReportExport(c, format, projection)
+
+	exported := 0
+	err := database.StreamLatestReports(params, func(report database.SearchLatestReportData) error {
+		if err := export.write(report); err != nil {
+			return err
+		}
+
+		exported++
+		if exported%exportFlushInterval == 0 {
+			return export.flush()
+		}
+
+		return nil
+	})
+
+	switch {
+	case err != nil && !export.started:
+		logrus.WithContext(c).Errorf("exporting reports: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	case err != nil:
+		// The status is already sent, the client is left with a truncated export. It
+		// does not tell an export cut short by the client itself.
+		if c.Request.Context().Err() == nil {
+			logrus.WithContext(c).Errorf("exporting reports, after %d of them: %s", exported, err)
+		}
+		return
+	}
+
+	if err := export.flush(); err != nil {
+		logrus.WithContext(c).Debugf("flushing the reports export: %s", err)
+	}
+}
+
+// negotiateExportFormat returns the export format the Accept header requests, the
+// preferred one when it accepts any or when it is not set, none when it accepts neither.
+func negotiateExportFormat(c *gin.Context) string {
+	offered := []string{}
+	for _, m := range exportMediaTypes {
+		offered = append(offered, m.mediaType)
+	}
+
+	negotiated := c.NegotiateFormat(offered...)
+	for _, m := range exportMediaTypes {
+		if m.mediaType == negotiated {
+			return m.format
+		}
+	}
+
+	return ""
+}
+
+// reportExport writes the exported reports in a format. The response starts with the first
+// report, so that an error reading the reports is still answered with a 500 until then.
+type reportExport struct {
+	c          *gin.Context
+	format     string
+	projection reportProjection
+	csv        *csv.Writer
+	ndjson     *json.Encoder
+	started    bool
+}
+
+func newReportExport(c *gin.Context, format string, projection reportProjection) *reportExport {
+	return &reportExport{
+		c:          c,
+		format:     format,
+		projection: projection,
+		csv:        csv.NewWriter(c.Writer),
+		ndjson:     json.NewEncoder(c.Writer),
+	}
+}
+
+// start writes the headers of the response, and the header row of the CSV.
+func (e *reportExport) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	e.c.Header("Content-Type", exportContentTypes[e.format])
+	e.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "reports."+e.format))
+	// Tells nginx not to buffer the export.
+	e.c.Header("X-Accel-Buffering", "no")
+	e.c.Status(http.StatusOK)
+
+	if e.format == exportFormatCSV {
+		return e.csv.Write(exportCSVHeader)
+	}
+
+	return nil
+}
+
+// write writes an exported report.
+func (e *reportExport) write(report database.SearchLatestReportData) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	if e.format == exportFormatNDJSON && e.projection.projected() {
+		return e.ndjson.Encode(e.projection.project(report))
+	}
+
+	if e.format == exportFormatNDJSON {
+		return e.ndjson.Encode(report)
+	}
+
+	return e.csv.Write(exportCSVRecord(report))
+}
+
+// flush sends what was written so far to the client, the response is started if it was
+// not yet, for an empty export to still be one.
+func (e *reportExport) flush() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	e.csv.Flush()
+	if err := e.csv.Error(); err != nil {
+		return err
+	}
+
+	e.c.Writer.Flush()
+
+	return nil
+}
+
+// exportCSVRecord flattens a report into the columns of exportCSVHeader. The scms and the
+// labels, of which a report has several, are joined with ";".
+func exportCSVRecord(r database.SearchLatestReportData) []string {
+	labels := []string{}
+	for _, key := range slices.Sorted(maps.Keys(r.Report.Labels)) {
+		labels = append(labels, key+"="+r.Report.Labels[key])
+	}
+
+	return []string{
+		r.ID,
+		r.Report.ID,
+		r.Name,
+		r.Result,
+		strings.Join(exportSCMs(r.Report), ";"),
+		strings.Join(labels, ";"),
+		r.CreatedAt,
+		r.UpdatedAt,
+		strconv.FormatBool(exportOpenAction(r.Report)),
+	}
+}
+
+// exportSCMs returns the scms targeted by a report, as "url@branch", sorted.
+func exportSCMs(report reports.Report) []string {
+	found := []string{}
+
+	for _, target := range report.Targets {
+		if target == nil || target.Scm.URL == "" || target.Scm.Branch.Target == "" {
+			continue
+		}
+
+		scm := target.Scm.URL + "@" + target.Scm.Branch.Target
+		if !slices.Contains(found, scm) {
+			found = append(found, scm)
+		}
+	}
+
+	slices.Sort(found)
+
+	return found
+}
+
+// exportOpenAction reports whether a report carries an open action, as openActionSQLExpr
+// does in pkg/database.
+func exportOpenAction(report reports.Report) bool {
+	for _, action := range report.Actions {
+		if action != nil && action.Link != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+	"github.com/updatecli/updatecli/pkg/core/result"
+)
+
+func TestExportCSVRecord(t *testing.T) {
+	target := func(url, branch string) *result.Target {
+		t := &result.Target{}
+		t.Scm.URL = url
+		t.Scm.Branch.Target = branch
+		return t
+	}
+
+	record := exportCSVRecord(database.SearchLatestReportData{
+		ID:     "5b4b3c51-8a1e-4c6b-9f7e-0c1f1b2a3d4e",
+		Name:   "Bump dependencies",
+		Result: "✔",
+		Report: reports.Report{
+			ID:     "deps",
+			Labels: map[string]string{"team": "platform", "env": "prod"},
+			Targets: map[string]*result.Target{
+				"web":  target("https://github.com/org/web", "main"),
+				"api":  target("https://github.com/org/api", "main"),
+				"api2": target("https://github.com/org/api", "main"),
+				"none": {},
+			},
+			Actions: map[string]*reports.Action{"pr": {Link: "https://github.com/org/web/pull/1"}},
+		},
+		CreatedAt: "created",
+		UpdatedAt: "updated",
+	})
+
+	assert.Len(t, record, len(exportCSVHeader))
+	assert.Equal(t, []string{
+		"5b4b3c51-8a1e-4c6b-9f7e-0c1f1b2a3d4e",
+		"deps",
+		"Bump dependencies",
+		"✔",
+		"https://github.com/org/api@main;https://github.com/org/web@main",
+		"env=prod;team=platform",
+		"created",
+		"updated",
+		"true",
+	}, record)
+
+	assert.Equal(t, "false", exportCSVRecord(database.SearchLatestReportData{})[8])
+}
+
+func TestExportRejectsInvalidRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/export", ExportPipelineReports)
+
+	// None of them reaches the database, which is not connected.
+	for _, tt := range []struct {
+		body, accept string
+		status       int
+	}{
+		{`{`, "", http.StatusBadRequest},
+		{`{"format": "xlsx"}`, "", http.StatusBadRequest},
+		{`{}`, "application/json", http.StatusNotAcceptable},
+		{`{"format": "csv", "start_time": "2026-01-01T00:00:00Z"}`, "application/json", http.StatusBadRequest},
+		{`{"format": "ndjson", "fields": ["Payload"]}`, "", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/export", strings.NewReader(tt.body))
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.status, w.Code, "%s %s", tt.body, tt.accept)
+	}
+}
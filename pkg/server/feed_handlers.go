@@ -0,0 +1,345 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+const (
+	// feedLength is the number of entries of a feed, the latest ones. A feed reader
+	// polling every few hours does not miss any of them unless a fleet changes at once.
+	feedLength = 50
+	// feedFormatAtom and feedFormatRSS are the formats a feed is served in.
+	feedFormatAtom = "atom"
+	feedFormatRSS  = "rss"
+)
+
+// feed describes a feed, whatever its format.
+type feed struct {
+	// id identifies the feed, it is the url it is served on.
+	id      string
+	title   string
+	entries []database.FeedEntry
+}
+
+// atomFeed is a feed in the Atom format, RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated string    `xml:"updated"`
+	Link    *atomLink `xml:"link,omitempty"`
+	Summary string    `xml:"summary"`
+}
+
+// rssFeed is a feed in the RSS 2.0 format.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        rssGUID `xml:"guid"`
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// LabelsFeed serves the changes of the pipelines carrying some labels.
+// @Summary Get the feed of labels
+// @Description Get the reports which changed the result of their pipeline, or opened a new action, over the
+// @Description monitoring duration, among the pipelines carrying every provided label, as an Atom or an RSS feed.
+// @Description The id of an entry is derived from the id of its report, it is stable across requests.
+// @Tags Feeds
+// @Param labels query object false "Labels, such as labels[team]=platform"
+// @Param format query string false "Feed format, atom by default or rss"
+// @Produce application/atom+xml
+// @Produce application/rss+xml
+// @Success 200 {string} string
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/feeds/labels [get]
+func LabelsFeed(c *gin.Context) {
+	format, ok := feedFormat(c)
+	if !ok {
+		return
+	}
+
+	labels := c.QueryMap("labels")
+
+	title := "udash: every pipeline"
+	if len(labels) > 0 {
+		selectors := []string{}
+		for _, key := range slices.Sorted(maps.Keys(labels)) {
+			selectors = append(selectors, key+"="+labels[key])
+		}
+		title = "udash: pipelines labelled " + strings.Join(selectors, ", ")
+	}
+
+	serveFeed(c, format, title, database.SearchFeedEntriesParams{Labels: labels})
+}
+
+// SCMFeed serves the changes of the pipelines of an scm.
+// @Summary Get the feed of an scm
+// @Description Get the reports which changed the result of their pipeline, or opened a new action, over the
+// @Description monitoring duration, among the reports targeting an scm, as an Atom or an RSS feed. The id of an
+// @Description entry is derived from the id of its report, it is stable across requests.
+// @Tags Feeds
+// @Param url query string true "SCM URL"
+// @Param branch query string true "SCM branch"
+// @Param format query string false "Feed format, atom by default or rss"
+// @Produce application/atom+xml
+// @Produce application/rss+xml
+// @Success 200 {string} string
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 404 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/feeds/scm [get]
+func SCMFeed(c *gin.Context) {
+	format, ok := feedFormat(c)
+	if !ok {
+		return
+	}
+
+	url, branch := c.Query("url"), c.Query("branch")
+	if url == "" || branch == "" {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: "both url and branch must be provided",
+		})
+		return
+	}
+
+	rows, _, err := database.GetSCM(c, database.GetSCMParams{URL: url, Branch: branch})
+	if err != nil {
+		logrus.WithContext(c).Errorf("serving scm feed: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	if len(rows) == 0 {
+		c.JSON(http.StatusNotFound, DefaultResponseModel{
+			Err: "scm not found",
+		})
+		return
+	}
+
+	serveFeed(c, format, fmt.Sprintf("udash: %s (%s)", url, branch), database.SearchFeedEntriesParams{
+		ScmID: rows[0].ID.String(),
+	})
+}
+
+// feedFormat returns the format requested by the format query parameter, or answers 400
+// when it is not a known one.
+func feedFormat(c *gin.Context) (string, bool) {
+	switch format := c.DefaultQuery("format", feedFormatAtom); format {
+	case feedFormatAtom, feedFormatRSS:
+		return format, true
+	default:
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: fmt.Sprintf("invalid format %q, accepted values are %q and %q", format, feedFormatAtom, feedFormatRSS),
+		})
+		return "", false
+	}
+}
+
+// serveFeed writes the feed of the entries selected by params in the provided format.
+func serveFeed(c *gin.Context, format, title string, params database.SearchFeedEntriesParams) {
+	params.Days = monitoringDurationDays
+	params.Limit = feedLength
+
+	entries, err := database.SearchFeedEntries(c, params)
+	if err != nil {
+		logrus.WithContext(c).Errorf("serving feed: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	f := feed{
+		id:      requestBaseURL(c) + c.Request.URL.RequestURI(),
+		title:   title,
+		entries: entries,
+	}
+
+	var document any = f.atom()
+	contentType := "application/atom+xml; charset=utf-8"
+	if format == feedFormatRSS {
+		document = f.rss()
+		contentType = "application/rss+xml; charset=utf-8"
+	}
+
+	body, err := xml.Marshal(document)
+	if err != nil {
+		logrus.WithContext(c).Errorf("encoding feed: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), body...))
+}
+
+// requestBaseURL returns the scheme and the host a request was sent to, as the client
+// sees them when a proxy forwards them.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	return scheme + "://" + c.Request.Host
+}
+
+// atom returns the feed in the Atom format.
+func (f feed) atom() atomFeed {
+	updated := time.Now().UTC()
+	if len(f.entries) > 0 {
+		updated = f.entries[0].UpdatedAt.UTC()
+	}
+
+	feed := atomFeed{
+		ID:      f.id,
+		Title:   f.title,
+		Updated: updated.Format(time.RFC3339),
+		Author:  atomAuthor{Name: "udash"},
+		Link:    atomLink{Href: f.id, Rel: "self"},
+		Entries: []atomEntry{},
+	}
+
+	for _, e := range f.entries {
+		entry := atomEntry{
+			ID:      feedEntryID(e),
+			Title:   feedEntryTitle(e),
+			Updated: e.UpdatedAt.UTC().Format(time.RFC3339),
+			Summary: feedEntrySummary(e),
+		}
+		if link := feedEntryLink(e); link != "" {
+			entry.Link = &atomLink{Href: link}
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
+
+// rss returns the feed in the RSS 2.0 format.
+func (f feed) rss() rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.title,
+			Link:        f.id,
+			Description: "The pipelines which changed result or opened a new action",
+			Items:       []rssItem{},
+		},
+	}
+
+	for _, e := range f.entries {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			GUID:        rssGUID{Value: feedEntryID(e)},
+			Title:       feedEntryTitle(e),
+			Link:        feedEntryLink(e),
+			Description: feedEntrySummary(e),
+			PubDate:     e.UpdatedAt.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return feed
+}
+
+// feedEntryID returns the id of an entry, the same for as long as its report exists so
+// that the feed readers do not show it twice.
+func feedEntryID(e database.FeedEntry) string {
+	return "urn:uuid:" + e.ReportID
+}
+
+// feedEntryTitle tells what changed, as the headline of the notifications does.
+func feedEntryTitle(e database.FeedEntry) string {
+	name := e.PipelineName
+	if name == "" {
+		name = e.PipelineID
+	}
+
+	changes := []string{}
+	if e.Result != e.PreviousResult {
+		changes = append(changes, fmt.Sprintf("changed from %s to %s", e.PreviousResult, e.Result))
+	}
+	switch len(e.NewActionURLs) {
+	case 0:
+	case 1:
+		changes = append(changes, "opened a new action")
+	default:
+		changes = append(changes, fmt.Sprintf("opened %d new actions", len(e.NewActionURLs)))
+	}
+
+	return fmt.Sprintf("%s %s %s", e.Result, name, strings.Join(changes, " and "))
+}
+
+// feedEntrySummary lists the new actions of an entry, if any.
+func feedEntrySummary(e database.FeedEntry) string {
+	lines := []string{fmt.Sprintf("Pipeline %s, result %s, previously %s.", e.PipelineID, e.Result, e.PreviousResult)}
+	for _, link := range e.NewActionURLs {
+		lines = append(lines, "New action: "+link)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// feedEntryLink returns the link of an entry: the action it opened, else its report on the
+// Updatecli side, if any.
+func feedEntryLink(e database.FeedEntry) string {
+	if len(e.NewActionURLs) > 0 {
+		return e.NewActionURLs[0]
+	}
+
+	return e.ReportURL
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+func TestFeed(t *testing.T) {
+	updatedAt := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	f := feed{
+		id:    "https://udash.example/api/feeds/labels?labels[team]=platform",
+		title: "udash: pipelines labelled team=platform",
+		entries: []database.FeedEntry{
+			{
+				ReportID:       "5b4b3c51-8a1e-4c6b-9f7e-0c1f1b2a3d4e",
+				PipelineID:     "deps",
+				PipelineName:   "Bump dependencies",
+				Result:         "✔",
+				PreviousResult: "✔",
+				NewActionURLs:  []string{"https://github.com/org/repo/pull/1"},
+				UpdatedAt:      updatedAt,
+			},
+			{
+				ReportID:       "0d6f3e2a-1b7c-4d9e-8f0a-2b3c4d5e6f70",
+				PipelineID:     "web",
+				Result:         "✗",
+				PreviousResult: "✔",
+				NewActionURLs:  []string{},
+				ReportURL:      "https://app.updatecli.io/reports/1",
+				UpdatedAt:      updatedAt.Add(-time.Hour),
+			},
+		},
+	}
+
+	t.Run("atom", func(t *testing.T) {
+		body, err := xml.Marshal(f.atom())
+		require.NoError(t, err)
+
+		parsed := atomFeed{}
+		require.NoError(t, xml.Unmarshal(body, &parsed))
+
+		assert.Equal(t, f.id, parsed.ID)
+		assert.Equal(t, "2026-03-02T10:00:00Z", parsed.Updated)
+		require.Len(t, parsed.Entries, 2)
+
+		assert.Equal(t, "urn:uuid:5b4b3c51-8a1e-4c6b-9f7e-0c1f1b2a3d4e", parsed.Entries[0].ID)
+		assert.Equal(t, "✔ Bump dependencies opened a new action", parsed.Entries[0].Title)
+		assert.Equal(t, "https://github.com/org/repo/pull/1", parsed.Entries[0].Link.Href)
+
+		assert.Equal(t, "✗ web changed from ✔ to ✗", parsed.Entries[1].Title)
+		assert.Equal(t, "https://app.updatecli.io/reports/1", parsed.Entries[1].Link.Href)
+	})
+
+	t.Run("rss", func(t *testing.T) {
+		body, err := xml.Marshal(f.rss())
+		require.NoError(t, err)
+
+		parsed := rssFeed{}
+		require.NoError(t, xml.Unmarshal(body, &parsed))
+
+		require.Len(t, parsed.Channel.Items, 2)
+		assert.Equal(t, "urn:uuid:0d6f3e2a-1b7c-4d9e-8f0a-2b3c4d5e6f70", parsed.Channel.Items[1].GUID.Value)
+		assert.False(t, parsed.Channel.Items[1].GUID.IsPermaLink)
+		assert.Equal(t, "Mon, 02 Mar 2026 09:00:00 +0000", parsed.Channel.Items[1].PubDate)
+	})
+
+	t.Run("both changes", func(t *testing.T) {
+		e := database.FeedEntry{PipelineID: "api", Result: "⚠", PreviousResult: "✔", NewActionURLs: []string{"a", "b"}}
+		assert.Equal(t, "⚠ api changed from ✔ to ⚠ and opened 2 new actions", feedEntryTitle(e))
+	})
+}
+
+func TestFeedRejectsInvalidFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/labels", LabelsFeed)
+	r.GET("/scm", SCMFeed)
+
+	// None of them reaches the database, which is not connected.
+	for _, path := range []string{"/labels?format=json", "/scm?format=atom&url=https://example.invalid"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+const (
+	// healthStatusOK reports a passing check.
+	healthStatusOK = "ok"
+	// healthStatusFailed reports a failing check.
+	healthStatusFailed = "failed"
+	// readinessTimeout bounds how long the readiness checks may take altogether. A probe
+	// which hangs is as bad as one which fails, and kubelet gives up after a second by
+	// default anyway.
+	readinessTimeout = 2 * time.Second
+)
+
+// HealthCheck is the outcome of a single health check.
+type HealthCheck struct {
+	// Status is either "ok" or "failed".
+	Status string `json:"status"`
+	// Message details the outcome of the check.
+	Message string `json:"message,omitempty"`
+}
+
+// HealthResponseModel represents the response of the health endpoints.
+type HealthResponseModel struct {
+	// Status is "ok" when every check passed, "failed" otherwise.
+	Status string `json:"status"`
+	// Checks contains the outcome of every check, by name.
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// Healthz reports whether the process is alive.
+// @Summary Liveness probe
+// @Description Report whether the process is alive. It does not check any dependency, so that a database outage does not get every replica restarted.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} HealthResponseModel
+// @Router /healthz [get]
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponseModel{
+		Status: healthStatusOK,
+	})
+}
+
+// Readyz reports whether the server can serve requests: a database connection can be
+// acquired and the schema is at the version the binary expects.
+// @Summary Readiness probe
+// @Description Report whether the server can serve requests: a database connection can be acquired
+// @Description and the database schema is at the version of the migrations embedded in the binary.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} HealthResponseModel
+// @Failure 503 {object} HealthResponseModel
+// @Router /readyz [get]
+func Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, readinessTimeout)
+	defer cancel()
+
+	resp := HealthResponseModel{
+		Status: healthStatusOK,
+		Checks: map[string]HealthCheck{
+			"database":   checkDatabase(ctx),
+			"migrations": checkMigrations(ctx),
+		},
+	}
+
+	statusCode := http.StatusOK
+	for _, check := range resp.Checks {
+		if check.Status != healthStatusOK {
+			resp.Status = healthStatusFailed
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(statusCode, resp)
+}
+
+// checkDatabase checks a connection can be acquired from the pool.
+func checkDatabase(ctx context.Context) HealthCheck {
+	if err := database.Ping(ctx); err != nil {
+		return HealthCheck{Status: healthStatusFailed, Message: err.Error()}
+	}
+
+	return HealthCheck{Status: healthStatusOK}
+}
+
+// checkMigrations checks the schema is at the version of the embedded migrations.
+//
+// A schema ahead of the binary fails the check too: it happens while a newer release is
+// rolled out, and the older replicas may then query columns which no longer exist.
+func checkMigrations(ctx context.Context) HealthCheck {
+	expected, err := database.ExpectedSchemaVersion()
+	if err != nil {
+		return HealthCheck{Status: healthStatusFailed, Message: err.Error()}
+	}
+
+	current, dirty, err := database.SchemaVersion(ctx)
+	if err != nil {
+		return HealthCheck{Status: healthStatusFailed, Message: err.Error()}
+	}
+
+	switch {
+	case dirty:
+		return HealthCheck{
+			Status:  healthStatusFailed,
+			Message: fmt.Sprintf("migration %d failed halfway, the schema is dirty", current),
+		}
+	case current != expected:
+		return HealthCheck{
+			Status:  healthStatusFailed,
+			Message: fmt.Sprintf("schema version %d, expected %d", current, expected),
+		}
+	}
+
+	return HealthCheck{
+		Status:  healthStatusOK,
+		Message: fmt.Sprintf("schema version %d", current),
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+// ReportingIntervalRequest describes a reporting interval to record.
+type ReportingIntervalRequest struct {
+	// PipelineID selects a single pipeline, by the id of its reports.
+	PipelineID string `json:"pipeline_id,omitempty"`
+	// Labels selects the pipelines whose report carries every one of them, with the same
+	// value. It cannot be combined with pipeline_id, and the interval applies to every
+	// pipeline when neither is set.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Interval is the longest a pipeline may go without reporting before it is stale, as a
+	// duration such as "24h". It is at least a minute.
+	Interval string `json:"interval"`
+}
+
+// ReportingIntervalResponse represents the response of the reporting interval creation.
+type ReportingIntervalResponse struct {
+	Message string                     `json:"message"`
+	Data    database.ReportingInterval `json:"data"`
+}
+
+// ReportingIntervalsResponse represents the response listing the reporting intervals.
+type ReportingIntervalsResponse struct {
+	Message string                       `json:"message"`
+	Data    []database.ReportingInterval `json:"data"`
+}
+
+// CreateReportingInterval records how often pipelines are expected to report.
+// @Summary Expect pipelines to report
+// @Description Record how often a pipeline, the pipelines carrying some labels, or every pipeline are expected to
+// @Description publish a report. A pipeline whose latest report is older than its interval is stale: it is flagged
+// @Description on the reports and the scm summaries, and notified once to the rules selecting the pipeline_stale event.
+// @Tags Reporting intervals
+// @Accept json
+// @Produce json
+// @Param body body ReportingIntervalRequest true "Reporting interval"
+// @Success 201 {object} ReportingIntervalResponse
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/intervals [post]
+func CreateReportingInterval(c *gin.Context) {
+	var request ReportingIntervalRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	interval, err := time.ParseDuration(request.Interval)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: fmt.Sprintf("invalid interval %q, a duration such as 24h is expected", request.Interval),
+		})
+		return
+	}
+
+	reportingInterval, err := database.CreateReportingInterval(c, database.NewReportingInterval{
+		PipelineID: request.PipelineID,
+		Labels:     request.Labels,
+		Interval:   interval,
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidReportingInterval) {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: err.Error(),
+			})
+			return
+		}
+
+		logrus.WithContext(c).Errorf("recording reporting interval: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	logrus.WithContext(c).Infof("Reporting interval %s created", reportingInterval.ID)
+
+	c.JSON(http.StatusCreated, ReportingIntervalResponse{
+		Message: "success!",
+		Data:    reportingInterval,
+	})
+}
+
+// ListReportingIntervals lists the reporting intervals.
+// @Summary List the reporting intervals
+// @Description List how often the pipelines are expected to report, latest first
+// @Tags Reporting intervals
+// @Produce json
+// @Success 200 {object} ReportingIntervalsResponse
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/intervals [get]
+func ListReportingIntervals(c *gin.Context) {
+	intervals, err := database.ListReportingIntervals(c)
+	if err != nil {
+		logrus.WithContext(c).Errorf("listing reporting intervals: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReportingIntervalsResponse{
+		Message: "success!",
+		Data:    intervals,
+	})
+}
+
+// DeleteReportingInterval deletes a reporting interval.
+// @Summary Delete a reporting interval
+// @Description Delete a reporting interval, the pipelines it selected fall back to the next matching one
+// @Tags Reporting intervals
+// @Param id path string true "Reporting interval ID"
+// @Produce json
+// @Success 200 {object} DefaultResponseModel
+// @Failure 404 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/intervals/{id} [delete]
+func DeleteReportingInterval(c *gin.Context) {
+	id := c.Param("id")
+
+	err := pgx.ErrNoRows
+	if _, parseErr := uuid.Parse(id); parseErr == nil {
+		err = database.DeleteReportingInterval(c, id)
+	}
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, DefaultResponseModel{
+			Err: "reporting interval not found",
+		})
+		return
+	case err != nil:
+		logrus.WithContext(c).Errorf("deleting reporting interval: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	logrus.WithContext(c).Infof("Reporting interval %s deleted", id)
+
+	c.JSON(http.StatusOK, DefaultResponseModel{
+		Message: "Reporting interval deleted successfully",
+	})
+}
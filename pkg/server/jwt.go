@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -55,26 +56,112 @@ func parseIssuerURL(issuer string) (*url.URL, error) {
 	return issuerURL, nil
 }
 
+// signatureAlgorithm returns the algorithm tokens must be signed with.
+//
+// A shared secret and an asymmetric algorithm are never combined: verifying an RS256 token
+// with an HMAC secret, or the other way around, is the classic algorithm confusion attack,
+// so the configuration is rejected rather than letting the validator sort it out.
+func signatureAlgorithm(o OauthOptions) (validator.SignatureAlgorithm, error) {
+	algorithm := validator.SignatureAlgorithm(strings.ToUpper(o.Algorithm))
+	if algorithm == "" {
+		algorithm = validator.RS256
+		if o.SharedSecret != "" {
+			algorithm = validator.HS256
+		}
+	}
+
+	switch algorithm {
+	case validator.RS256, validator.ES256:
+		if o.SharedSecret != "" {
+			return "", fmt.Errorf("a shared secret cannot verify %s tokens", algorithm)
+		}
+	case validator.HS256:
+		if o.SharedSecret == "" {
+			return "", fmt.Errorf("%s tokens require a shared secret", algorithm)
+		}
+	default:
+		return "", fmt.Errorf("unsupported signature algorithm %q, accepted values are: %q, %q, %q",
+			o.Algorithm, validator.RS256, validator.ES256, validator.HS256)
+	}
+
+	return algorithm, nil
+}
+
+// oauthKeyFunc returns the function the validator retrieves the signing keys with.
+//
+// The keys are fetched from the issuer unless a local source is configured, which is what
+// air-gapped deployments rely on. Only one source may be configured: silently picking one
+// of them would leave the other one looking active while it is ignored. The local sources
+// are watched until ctx is done.
+func oauthKeyFunc(ctx context.Context, o OauthOptions, issuerURL *url.URL) (func(context.Context) (interface{}, error), error) {
+	configured := 0
+	for _, source := range []string{o.SharedSecret, o.JWKSFile, o.PublicKeyFile} {
+		if source != "" {
+			configured++
+		}
+	}
+
+	if configured > 1 {
+		return nil, errors.New("only one of sharedsecret, jwksfile and publickeyfile can be set")
+	}
+
+	switch {
+	case o.SharedSecret != "":
+		secret := []byte(o.SharedSecret)
+		return func(context.Context) (interface{}, error) {
+			return secret, nil
+		}, nil
+
+	case o.JWKSFile != "":
+		provider, err := newStaticKeyProvider(ctx, o.JWKSFile, parseJWKS)
+		if err != nil {
+			return nil, fmt.Errorf("loading jwks file: %w", err)
+		}
+		return provider.KeyFunc, nil
+
+	case o.PublicKeyFile != "":
+		provider, err := newStaticKeyProvider(ctx, o.PublicKeyFile, parsePublicKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("loading public key file: %w", err)
+		}
+		return provider.KeyFunc, nil
+	}
+
+	return jwks.NewCachingProvider(issuerURL, 5*time.Minute).KeyFunc, nil
+}
+
 // checkJWT builds a gin.HandlerFunc middleware that will check the validity of our JWT.
 //
 // It must be called once, when the routes are set up, and the returned middleware reused
 // for every request: the JWKS provider it builds caches the signing keys of the issuer,
 // and rebuilding it per request means fetching them again on every single call.
 //
+// The signing keys are read from local files when configured so, in which case they are
+// watched and reloaded rather than cached, until ctx is done.
+//
 // A setup failure is reported rather than logged: carrying on would leave a nil validator
 // behind, which panics on the first request it is asked to authenticate.
-func checkJWT() (gin.HandlerFunc, error) {
+func checkJWT(ctx context.Context) (gin.HandlerFunc, error) {
 
 	issuerURL, err := parseIssuerURL(authOption.Oauth.Issuer)
 	if err != nil {
 		return nil, fmt.Errorf("parsing the issuer url: %w", err)
 	}
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
+
+	algorithm, err := signatureAlgorithm(authOption.Oauth)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFunc, err := oauthKeyFunc(ctx, authOption.Oauth, issuerURL)
+	if err != nil {
+		return nil, err
+	}
 
 	// Set up the validator.
 	jwtValidator, err := validator.New(
-		provider.KeyFunc,
-		validator.RS256,
+		keyFunc,
+		algorithm,
 		issuerURL.String(),
 		authOption.Oauth.Audience,
 		validator.WithCustomClaims(customClaims),
@@ -99,6 +186,9 @@ func checkJWT() (gin.HandlerFunc, error) {
 		var handler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
 			encounteredError = false
 			ctx.Request = r
+			if claims, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims); ok {
+				ctx.Set(principalContextKey, claims.RegisteredClaims.Subject)
+			}
 			ctx.Next()
 		}
 
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	jose "gopkg.in/go-jose/go-jose.v2"
+)
+
+// keyParser turns the content of a key file into a key the validator accepts.
+type keyParser func(data []byte) (interface{}, error)
+
+// staticKeyProvider serves the signing keys of the issuer from a local file rather than
+// fetching them from its JWKS endpoint, for the deployments which cannot reach it.
+//
+// The file is reloaded whenever it changes so that keys can be rotated without a restart.
+// A file which cannot be parsed anymore is reported and ignored, the keys loaded last
+// remain in use: rejecting every token because of a half written file would lock every
+// client out until the next successful write.
+type staticKeyProvider struct {
+	path  string
+	parse keyParser
+
+	mu  sync.RWMutex
+	key interface{}
+}
+
+// newStaticKeyProvider loads the keys from path and watches it for changes until ctx is done.
+func newStaticKeyProvider(ctx context.Context, path string, parse keyParser) (*staticKeyProvider, error) {
+	p := &staticKeyProvider{
+		path:  path,
+		parse: parse,
+	}
+
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+
+	if err := p.watch(ctx); err != nil {
+		return nil, fmt.Errorf("watching %q: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// KeyFunc returns the keys loaded last, it matches the signature expected by the validator.
+func (p *staticKeyProvider) KeyFunc(_ context.Context) (interface{}, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.key, nil
+}
+
+// load reads and parses the key file, replacing the keys in use on success only.
+func (p *staticKeyProvider) load() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", p.path, err)
+	}
+
+	key, err := p.parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", p.path, err)
+	}
+
+	p.mu.Lock()
+	p.key = key
+	p.mu.Unlock()
+
+	return nil
+}
+
+// watch reloads the keys whenever the key file changes.
+func (p *staticKeyProvider) watch(ctx context.Context) error {
+	return watchFiles(ctx, []string{p.path}, func() {
+		if err := p.load(); err != nil {
+			logrus.Errorf("reloading jwt signing keys, keeping the previous ones: %s", err)
+			return
+		}
+
+		logrus.Debugf("jwt signing keys reloaded from %q", p.path)
+	})
+}
+
+// parseJWKS parses a JSON Web Key Set, as served by the jwks_uri of an OIDC provider.
+//
+// The validator picks the key matching the kid header of a token out of a set, and rejects
+// a token without one. A set of a single key is therefore returned as that key so that,
+// like a PEM public key, it also verifies the tokens which do not name their key.
+func parseJWKS(data []byte) (interface{}, error) {
+	keySet := jose.JSONWebKeySet{}
+
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, err
+	}
+
+	switch len(keySet.Keys) {
+	case 0:
+		return nil, errors.New("no key found")
+	case 1:
+		return keySet.Keys[0].Key, nil
+	}
+
+	return &keySet, nil
+}
+
+// parsePublicKeyPEM parses the first PEM block of data, either a public key, in its PKIX or
+// PKCS#1 form, or a certificate whose public key is used.
+func parsePublicKeyPEM(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
@@ -1,10 +1,24 @@
 package server
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	jose "gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
 )
 
 func TestParseIssuerURL(t *testing.T) {
@@ -79,3 +93,190 @@ func TestParseIssuerURL(t *testing.T) {
 		})
 	}
 }
+
+func TestSignatureAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		options OauthOptions
+		want    validator.SignatureAlgorithm
+		wantErr bool
+	}{
+		{
+			name: "defaults to RS256",
+			want: validator.RS256,
+		},
+		{
+			name:    "defaults to HS256 with a shared secret",
+			options: OauthOptions{SharedSecret: "secret"},
+			want:    validator.HS256,
+		},
+		{
+			name:    "is case insensitive",
+			options: OauthOptions{Algorithm: "es256"},
+			want:    validator.ES256,
+		},
+		{
+			name:    "HS256 requires a shared secret",
+			options: OauthOptions{Algorithm: "HS256"},
+			wantErr: true,
+		},
+		{
+			// Verifying an asymmetric token with an HMAC secret is the algorithm
+			// confusion attack, the combination must never be accepted.
+			name:    "a shared secret cannot verify RS256 tokens",
+			options: OauthOptions{Algorithm: "RS256", SharedSecret: "secret"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithms are rejected",
+			options: OauthOptions{Algorithm: "none"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signatureAlgorithm(tt.options)
+
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStaticSigningKeys(t *testing.T) {
+	const issuer = "https://issuer.example/"
+	audience := []string{"https://udash.example/api"}
+
+	issuerURL, err := parseIssuerURL(issuer)
+	require.NoError(t, err)
+
+	// validate builds a validator out of the provided options, the same way checkJWT
+	// does, and runs the provided token through it.
+	validate := func(t *testing.T, o OauthOptions, token string) error {
+		t.Helper()
+
+		algorithm, err := signatureAlgorithm(o)
+		require.NoError(t, err)
+
+		keyFunc, err := oauthKeyFunc(t.Context(), o, issuerURL)
+		require.NoError(t, err)
+
+		v, err := validator.New(keyFunc, algorithm, issuer, audience)
+		require.NoError(t, err)
+
+		_, err = v.ValidateToken(context.Background(), token)
+		return err
+	}
+
+	sign := func(t *testing.T, algorithm jose.SignatureAlgorithm, key interface{}, kid string) string {
+		t.Helper()
+
+		opts := (&jose.SignerOptions{}).WithType("JWT")
+		if kid != "" {
+			opts = opts.WithHeader("kid", kid)
+		}
+
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: key}, opts)
+		require.NoError(t, err)
+
+		token, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Issuer:   issuer,
+			Audience: audience,
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).CompactSerialize()
+		require.NoError(t, err)
+
+		return token
+	}
+
+	writePublicKey := func(t *testing.T, path string, key interface{}) {
+		t.Helper()
+
+		der, err := x509.MarshalPKIXPublicKey(key)
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	}
+
+	t.Run("HS256 shared secret", func(t *testing.T) {
+		o := OauthOptions{SharedSecret: "a-shared-secret-long-enough-for-hs256"}
+
+		require.NoError(t, validate(t, o, sign(t, jose.HS256, []byte(o.SharedSecret), "")))
+		require.Error(t, validate(t, o, sign(t, jose.HS256, []byte("another-secret-long-enough-for-hs256"), "")))
+	})
+
+	t.Run("ES256 PEM public key", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "issuer.pem")
+		writePublicKey(t, path, key.Public())
+
+		o := OauthOptions{Algorithm: "ES256", PublicKeyFile: path}
+		require.NoError(t, validate(t, o, sign(t, jose.ES256, key, "")))
+	})
+
+	t.Run("RS256 JWKS file picks the key by kid", func(t *testing.T) {
+		first, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		second, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		data, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: first.Public(), KeyID: "first", Algorithm: "RS256", Use: "sig"},
+			{Key: second.Public(), KeyID: "second", Algorithm: "RS256", Use: "sig"},
+		}})
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		o := OauthOptions{JWKSFile: path}
+		require.NoError(t, validate(t, o, sign(t, jose.RS256, first, "first")))
+		require.NoError(t, validate(t, o, sign(t, jose.RS256, second, "second")))
+		require.Error(t, validate(t, o, sign(t, jose.RS256, first, "second")))
+	})
+
+	t.Run("public key file is reloaded when it changes", func(t *testing.T) {
+		before, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		after, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "issuer.pem")
+		writePublicKey(t, path, before.Public())
+
+		provider, err := newStaticKeyProvider(t.Context(), path, parsePublicKeyPEM)
+		require.NoError(t, err)
+
+		v, err := validator.New(provider.KeyFunc, validator.RS256, issuer, audience)
+		require.NoError(t, err)
+
+		token := sign(t, jose.RS256, after, "")
+		_, err = v.ValidateToken(context.Background(), token)
+		require.Error(t, err)
+
+		// A broken file must not replace the keys in use.
+		require.NoError(t, os.WriteFile(path, []byte("not a key"), 0o600))
+		time.Sleep(100 * time.Millisecond)
+		_, err = v.ValidateToken(context.Background(), sign(t, jose.RS256, before, ""))
+		require.NoError(t, err)
+
+		writePublicKey(t, path, after.Public())
+		assert.Eventually(t, func() bool {
+			_, err := v.ValidateToken(context.Background(), token)
+			return err == nil
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("only one key source can be configured", func(t *testing.T) {
+		_, err := oauthKeyFunc(t.Context(), OauthOptions{SharedSecret: "secret", JWKSFile: "jwks.json"}, issuerURL)
+		require.Error(t, err)
+	})
+}
@@ -53,7 +53,7 @@ func ListLabels(c *gin.Context) {
 
 	limit, page, err := getPaginationParamFromURLQuery(c)
 	if err != nil {
-		logrus.Errorf("getting pagination params: %s", err)
+		logrus.WithContext(c).Errorf("getting pagination params: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: ErrInvalidPaginationParams + ": " + err.Error(),
 		})
@@ -77,7 +77,7 @@ func ListLabels(c *gin.Context) {
 	case true:
 		results, totalCount, err := database.GetLabelKeyOnlyRecords(c, startTime, endTime, limit, page)
 		if err != nil {
-			logrus.Errorf("searching for labels: %s", err)
+			logrus.WithContext(c).Errorf("searching for labels: %s", err)
 			c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 				Err: err.Error(),
 			})
@@ -95,7 +95,7 @@ func ListLabels(c *gin.Context) {
 	case false:
 		results, totalCount, err := database.GetLabelRecords(c, id, key, value, startTime, endTime, limit, page)
 		if err != nil {
-			logrus.Errorf("searching for labels: %s", err)
+			logrus.WithContext(c).Errorf("searching for labels: %s", err)
 			c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 				Err: err.Error(),
 			})
@@ -154,7 +154,7 @@ func SearchLabels(c *gin.Context) {
 	queryParams := SearchLabelsRequest{}
 
 	if err := c.ShouldBindJSON(&queryParams); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -171,7 +171,7 @@ func SearchLabels(c *gin.Context) {
 			queryParams.Page,
 		)
 		if err != nil {
-			logrus.Errorf("searching for labels: %s", err)
+			logrus.WithContext(c).Errorf("searching for labels: %s", err)
 			c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 				Err: err.Error(),
 			})
@@ -197,7 +197,7 @@ func SearchLabels(c *gin.Context) {
 			queryParams.Limit,
 			queryParams.Page)
 		if err != nil {
-			logrus.Errorf("searching for labels: %s", err)
+			logrus.WithContext(c).Errorf("searching for labels: %s", err)
 			c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 				Err: err.Error(),
 			})
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// unixSocketPrefix identifies a listen address as a unix socket.
+const unixSocketPrefix = "unix:"
+
+// listen opens the listener for the provided address, either a TCP address or a unix
+// socket prefixed by "unix:" such as "unix:///run/udash/udash.sock".
+//
+// A socket file left behind by a previous run is removed first, as binding would fail on
+// it. Anything else found at that path is left alone and reported.
+func listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixSocketPrefix) {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(address, unixSocketPrefix), "//")
+	if path == "" {
+		return nil, fmt.Errorf("unix socket address %q has no path", address)
+	}
+
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	case info.Mode()&fs.ModeSocket == 0:
+		return nil, fmt.Errorf("%q exists and is not a unix socket", path)
+	default:
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale unix socket: %w", err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// certificateReloader serves the certificate of the server, reloading it whenever its
+// files change so that renewed certificates are picked up without a restart.
+//
+// The certificate and its key are rarely replaced at once, so in between the two files do
+// not match. That state is ignored and the previous certificate kept until both do again.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertificateReloader loads the certificate and watches its files until ctx is done.
+func newCertificateReloader(ctx context.Context, o TLSOptions) (*certificateReloader, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, errors.New("both the tls certificate and key files must be set")
+	}
+
+	r := &certificateReloader{
+		certFile: o.CertFile,
+		keyFile:  o.KeyFile,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	err := watchFiles(ctx, []string{r.certFile, r.keyFile}, func() {
+		if err := r.load(); err != nil {
+			logrus.Errorf("reloading tls certificate, keeping the previous one: %s", err)
+			return
+		}
+		logrus.Debugf("tls certificate reloaded from %q", r.certFile)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("watching tls certificate: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *certificateReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading tls certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+
+	return nil
+}
+
+// GetCertificate returns the certificate loaded last, it matches tls.Config.GetCertificate.
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
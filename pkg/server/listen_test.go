@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		l, err := listen("127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+
+		assert.Equal(t, "tcp", l.Addr().Network())
+	})
+
+	t.Run("unix socket replaces a stale one", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "udash.sock")
+
+		// A listener which does not remove its socket when closed, as after a crash.
+		stale, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		l, err := listen("unix://" + path)
+		require.NoError(t, err)
+		defer l.Close()
+
+		assert.Equal(t, "unix", l.Addr().Network())
+	})
+
+	t.Run("unix socket never removes a regular file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "udash.sock")
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+		_, err := listen("unix:" + path)
+		require.Error(t, err)
+		assert.FileExists(t, path)
+	})
+}
+
+func TestServerGracefulShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "udash.sock")
+
+	s := Server{Options: Options{Listen: "unix://" + path}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+
+	require.Eventually(t, func() bool {
+		resp, err := client.Get("http://udash/api/ping")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+
+	assert.NoFileExists(t, path)
+}
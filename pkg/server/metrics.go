@@ -0,0 +1,116 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+// unmatchedRoute labels the requests which matched no route. The path itself is not used,
+// every scanner probing random paths would otherwise add series without bound.
+const unmatchedRoute = "unmatched"
+
+// httpMetrics measures the requests served by the gin engine.
+type httpMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "udash",
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests served, per route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "udash",
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to serve an HTTP request, per route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "udash",
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests being served.",
+		}),
+	}
+}
+
+func (m *httpMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+	m.inFlight.Describe(ch)
+}
+
+func (m *httpMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+	m.inFlight.Collect(ch)
+}
+
+// middleware returns the gin middleware recording every request.
+//
+// The route is the pattern the request matched, such as "/api/pipeline/reports/:id", rather
+// than its path, so that the number of series stays bounded by the number of routes.
+func (m *httpMetrics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		m.requests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+		m.duration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// newMetricsRegistry returns the registry served on /metrics, along with the middleware
+// measuring the requests served.
+//
+// Each engine gets a registry of its own rather than the global one, which would panic as
+// soon as a second engine registered the same collectors.
+func newMetricsRegistry(opts MetricsOptions) (*prometheus.Registry, gin.HandlerFunc) {
+	staleAfter := opts.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultMetricsStaleAfter
+	}
+
+	requests := newHTTPMetrics()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests,
+		database.NewPoolCollector(),
+		database.NewFleetCollector(staleAfter),
+	)
+	registry.MustRegister(database.IngestionCollectors()...)
+
+	return registry, requests.middleware()
+}
+
+// metricsHandler serves the metrics of the registry in the Prometheus exposition format.
+func metricsHandler(registry *prometheus.Registry) gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		// A collector failing, such as the database being unreachable, must not hide the
+		// metrics of every other one, which are needed the most at that very moment.
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+}
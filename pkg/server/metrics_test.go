@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	get := func(r *gin.Engine, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("requests are counted per route", func(t *testing.T) {
+		r := newGinEngine(Options{})
+
+		get(r, "/api/ping")
+		get(r, "/api/ping")
+		get(r, "/does/not/exist/42")
+
+		w := get(r, "/metrics")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		body := w.Body.String()
+		assert.Contains(t, body, `udash_http_requests_total{code="200",method="GET",route="/api/ping"} 2`)
+		assert.Contains(t, body, `udash_http_requests_total{code="404",method="GET",route="unmatched"} 1`)
+		assert.Contains(t, body, `udash_http_request_duration_seconds_count{method="GET",route="/api/ping"} 2`)
+		assert.NotContains(t, body, "/does/not/exist")
+		assert.Contains(t, body, "go_goroutines")
+	})
+
+	t.Run("engines do not share their registry", func(t *testing.T) {
+		first := newGinEngine(Options{})
+		second := newGinEngine(Options{})
+
+		get(first, "/api/ping")
+
+		assert.NotContains(t, get(second, "/metrics").Body.String(), `route="/api/ping"`)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		r := newGinEngine(Options{Metrics: MetricsOptions{Disabled: true}})
+
+		assert.Equal(t, http.StatusNotFound, get(r, "/metrics").Code)
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/udash/pkg/notification"
+)
+
+// NotificationDeliveryResponse represents the response of the notification test.
+type NotificationDeliveryResponse struct {
+	Message string                        `json:"message"`
+	Data    database.NotificationDelivery `json:"data"`
+}
+
+// NotificationDeliveriesResponse represents the response listing the notification deliveries.
+type NotificationDeliveriesResponse struct {
+	Message string                          `json:"message"`
+	Data    []database.NotificationDelivery `json:"data"`
+}
+
+// TestNotificationRule sends a test notification to the endpoint of a rule.
+// @Summary Test a notification rule
+// @Description Send a webhook describing no actual pipeline, flagged as a test, to the endpoint of a notification
+// @Description rule. It is sent once, without retry, and recorded in the delivery log along with the outcome.
+// @Tags Admin
+// @Param name path string true "Rule name"
+// @Produce json
+// @Success 200 {object} NotificationDeliveryResponse
+// @Failure 404 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/admin/notifications/rules/{name}/test [post]
+func TestNotificationRule(c *gin.Context) {
+	delivery, err := notification.Test(c, c.Param("name"))
+	if err != nil {
+		if errors.Is(err, notification.ErrUnknownRule) {
+			c.JSON(http.StatusNotFound, DefaultResponseModel{
+				Err: err.Error(),
+			})
+			return
+		}
+
+		logrus.WithContext(c).Errorf("testing notification rule: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	logrus.WithContext(c).Infof("Test notification of rule %q: %s", delivery.Rule, delivery.Status)
+
+	c.JSON(http.StatusOK, NotificationDeliveryResponse{
+		Message: "success!",
+		Data:    delivery,
+	})
+}
+
+// ListNotificationDeliveries lists the latest notification deliveries.
+// @Summary List the notification deliveries
+// @Description List the latest notifications sent, or to be sent, and the outcome of their last attempt, latest first
+// @Tags Admin
+// @Param rule query string false "Restrict the list to the deliveries of a rule"
+// @Param status query string false "Restrict the list to the deliveries of a status, pending, delivered or failed"
+// @Param limit query int false "Number of deliveries returned, 50 by default and at most 500"
+// @Produce json
+// @Success 200 {object} NotificationDeliveriesResponse
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/admin/notifications/deliveries [get]
+func ListNotificationDeliveries(c *gin.Context) {
+	params := database.ListNotificationDeliveriesParams{
+		Rule:   c.Query("rule"),
+		Status: c.Query("status"),
+	}
+
+	if params.Status != "" && !slices.Contains([]string{
+		database.DeliveryPending,
+		database.DeliveryDelivered,
+		database.DeliveryFailed,
+	}, params.Status) {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: "invalid status parameter, pending, delivered or failed is expected",
+		})
+		return
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: ErrInvalidPaginationParams,
+			})
+			return
+		}
+		params.Limit = limit
+	}
+
+	deliveries, err := database.ListNotificationDeliveries(c, params)
+	if err != nil {
+		logrus.WithContext(c).Errorf("listing notification deliveries: %s", err)
+		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, NotificationDeliveriesResponse{
+		Message: "success!",
+		Data:    deliveries,
+	})
+}
+
+// SendNotificationDigest sends a digest right away.
+// @Summary Send a digest
+// @Description Send a digest by email right away, over the period ending now, whatever its schedule. The digest
+// @Description sent this way is not recorded, the scheduled one is sent nonetheless.
+// @Tags Admin
+// @Param name path string true "Digest name"
+// @Produce json
+// @Success 200 {object} DefaultResponseModel
+// @Failure 404 {object} DefaultResponseModel
+// @Failure 502 {object} DefaultResponseModel
+// @Router /api/admin/notifications/digests/{name}/send [post]
+func SendNotificationDigest(c *gin.Context) {
+	if err := notification.SendDigest(c, c.Param("name")); err != nil {
+		if errors.Is(err, notification.ErrUnknownDigest) {
+			c.JSON(http.StatusNotFound, DefaultResponseModel{
+				Err: err.Error(),
+			})
+			return
+		}
+
+		logrus.WithContext(c).Errorf("sending digest: %s", err)
+		c.JSON(http.StatusBadGateway, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	logrus.WithContext(c).Infof("Digest %q sent", c.Param("name"))
+
+	c.JSON(http.StatusOK, DefaultResponseModel{
+		Message: "success!",
+	})
+}
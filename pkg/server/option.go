@@ -1,10 +1,98 @@
 package server
 
+import (
+	"os"
+	"time"
+)
+
+const (
+	// defaultListen is the address the server listens on when none is configured.
+	defaultListen = ":8080"
+	// defaultIdleTimeout is how long a keep-alive connection is kept open without any request.
+	defaultIdleTimeout = 2 * time.Minute
+	// defaultShutdownTimeout is how long in-flight requests are waited for on shutdown.
+	defaultShutdownTimeout = 30 * time.Second
+	// readHeaderTimeout bounds how long a client may take to send the headers of a request.
+	// It is not configurable: no legitimate client needs more, and leaving it unbounded lets
+	// a handful of slow connections exhaust the server.
+	readHeaderTimeout = 10 * time.Second
+)
+
 // Options holds the server options
 type Options struct {
 	Auth AuthOptions
+	// RateLimit defines the rate limits applied per client to the /api/pipeline routes
+	RateLimit RateLimitOptions
+	// TrustedProxies are the addresses or CIDR ranges of the proxies allowed to set the client
+	// IP through the X-Forwarded-For and X-Real-IP headers, which the rate limits and the
+	// access log account requests to.
+	// Default to none: the client IP is the address of the connection
+	TrustedProxies []string
+	// MaxReportSize is the largest pipeline report accepted, in bytes.
+	// Default to 0, which does not limit anything
+	MaxReportSize int64
+	// Cors defines the Cross-Origin Resource Sharing policy of the API
+	Cors CorsOptions
+	// Metrics defines the Prometheus metrics served on /metrics
+	Metrics MetricsOptions
+	// Badges defines the status badges served under /api/badges
+	Badges BadgeOptions
+	// Listen is the address the server listens on, either a TCP address such as ":8080"
+	// or a unix socket such as "unix:///run/udash/udash.sock".
+	// Default to ":8080", or to the port set by the PORT environment variable
+	Listen string
+	// TLS enables HTTPS
+	TLS TLSOptions
+	// ReadTimeout is the maximum duration for reading an entire request, body included.
+	// Default to 0, which does not time out
+	ReadTimeout time.Duration
+	// WriteTimeout is the maximum duration for writing a response.
+	// Default to 0, which does not time out
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection is kept open without any request.
+	// Default to 2m
+	IdleTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests are waited for when the server stops.
+	// Default to 30s
+	ShutdownTimeout time.Duration
+}
+
+// TLSOptions defines the certificate the server is served with.
+// Both files are reloaded when they change.
+type TLSOptions struct {
+	// CertFile is the path to the PEM encoded certificate, chain included
+	// example: /etc/udash/tls.crt
+	CertFile string
+	// KeyFile is the path to the PEM encoded private key
+	// example: /etc/udash/tls.key
+	KeyFile string
+}
+
+// Enabled reports whether the server is served over HTTPS.
+func (t TLSOptions) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
 }
 
 func (o *Options) Init() {
 	o.Auth.Init()
+	o.Cors.Init()
+	o.Metrics.Init()
+	o.Badges.Init()
+
+	// gin listens on the port set by PORT when it is given no address, which is what the
+	// server did before the address could be configured.
+	if o.Listen == "" {
+		o.Listen = defaultListen
+		if port := os.Getenv("PORT"); port != "" {
+			o.Listen = ":" + port
+		}
+	}
+
+	if o.IdleTimeout == 0 {
+		o.IdleTimeout = defaultIdleTimeout
+	}
+
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = defaultShutdownTimeout
+	}
 }
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"time"
+
+	"github.com/updatecli/updatecli/pkg/core/result"
+)
+
+const (
+	// defaultBadgeLabel is the text of the left part of the badges.
+	defaultBadgeLabel = "updatecli"
+	// defaultBadgeMaxAge is how long a badge may be cached, short enough for a README to
+	// follow the pipelines within minutes.
+	defaultBadgeMaxAge = 5 * time.Minute
+	// badgeUnknownColor is the color of the badges whose result has no color, and of the
+	// ones showing nothing was found.
+	badgeUnknownColor = "#9f9f9f"
+)
+
+// defaultBadgeColors are the colors of the results, the ones shields.io uses.
+var defaultBadgeColors = map[string]string{
+	result.SUCCESS:   "#4c1",
+	result.FAILURE:   "#e05d44",
+	result.ATTENTION: "#dfb317",
+	result.SKIPPED:   badgeUnknownColor,
+}
+
+// badgeColorPattern matches the colors accepted in the badges, either hexadecimal such as
+// "#e05d44" or named such as "orange".
+var badgeColorPattern = regexp.MustCompile(`^(#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})|[a-zA-Z]+)$`)
+
+// BadgeOptions defines the status badges served under /api/badges.
+//
+// The badges follow the API visibility: they require authentication when the API is
+// private, which the images embedded in a README cannot provide.
+type BadgeOptions struct {
+	// Label is the text of the left part of the badges, a badge may set its own with the
+	// label query parameter.
+	// Default to "updatecli"
+	Label string
+	// Colors maps a pipeline result to the color of the badges showing it, such as
+	// {"✗": "#e05d44"}. The configured colors are merged over the default ones.
+	// Default to green, red, yellow and grey for "✔", "✗", "⚠" and "-"
+	Colors map[string]string
+	// MaxAge is how long a badge may be cached by the browsers and the proxies.
+	// Default to 5m
+	MaxAge time.Duration
+}
+
+// Init sets the defaults of the unset options.
+func (o *BadgeOptions) Init() {
+	if o.Label == "" {
+		o.Label = defaultBadgeLabel
+	}
+
+	if o.MaxAge == 0 {
+		o.MaxAge = defaultBadgeMaxAge
+	}
+
+	colors := maps.Clone(defaultBadgeColors)
+	maps.Copy(colors, o.Colors)
+	o.Colors = colors
+}
+
+// validate reports the options which cannot be served.
+func (o BadgeOptions) validate() []error {
+	errs := []error{}
+
+	if o.MaxAge < 0 {
+		errs = append(errs, errors.New("badges max age cannot be negative"))
+	}
+
+	for r, color := range o.Colors {
+		if !badgeColorPattern.MatchString(color) {
+			errs = append(errs, fmt.Errorf("invalid badge color %q for result %q, a color such as %q or %q is expected",
+				color, r, "#e05d44", "red"))
+		}
+	}
+
+	return errs
+}
+
+// color returns the color of the badges showing the provided result.
+func (o BadgeOptions) color(r string) string {
+	if color, found := o.Colors[r]; found {
+		return color
+	}
+
+	return badgeUnknownColor
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// corsDefaultMethods are the methods allowed when none are configured, every method the API serves.
+	corsDefaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+	// corsDefaultHeaders are the request headers allowed when none are configured, the ones the frontend sends.
+	corsDefaultHeaders = []string{"Authorization", "Content-Type"}
+)
+
+// CorsOptions defines the Cross-Origin Resource Sharing policy of the API,
+// required when the frontend is served from another origin than the API.
+type CorsOptions struct {
+	// AllowedOrigins lists the origins allowed to call the API, such as "https://udash.example".
+	// "*" allows any origin.
+	// Default to none, which disables CORS
+	AllowedOrigins []string
+	// AllowedMethods lists the methods allowed for cross-origin requests.
+	// Default to every method the API serves
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers allowed for cross-origin requests.
+	// "*" allows any header.
+	// Default to "Authorization" and "Content-Type"
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers the browser exposes to the frontend,
+	// such as "Retry-After".
+	ExposedHeaders []string
+	// AllowCredentials allows cross-origin requests to carry cookies and
+	// authorization headers. It cannot be combined with the "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long, in seconds, a browser may cache the answer to a preflight request.
+	// Default to 0, which leaves it to the browser
+	MaxAge int
+}
+
+// Enabled reports whether any origin is allowed.
+func (o CorsOptions) Enabled() bool {
+	return len(o.AllowedOrigins) > 0
+}
+
+// Init sets the defaults of the unset options.
+func (o *CorsOptions) Init() {
+	if !o.Enabled() {
+		return
+	}
+
+	if len(o.AllowedMethods) == 0 {
+		o.AllowedMethods = corsDefaultMethods
+	}
+
+	if len(o.AllowedHeaders) == 0 {
+		o.AllowedHeaders = corsDefaultHeaders
+	}
+
+	// Browsers refuse credentials along a wildcard origin, so the combination can only
+	// ever fail in their console. Reflecting any origin instead would work, but it would
+	// hand every website the credentials of the visitors, which is not something to
+	// enable by accident.
+	if o.AllowCredentials && o.allowsAnyOrigin() {
+		logrus.Errorf("CORS credentials cannot be allowed for any origin %q, disabling them", "*")
+		o.AllowCredentials = false
+	}
+
+	logrus.Debugf("CORS enabled for origins %q", o.AllowedOrigins)
+}
+
+// allowsAnyOrigin reports whether the wildcard origin is configured.
+func (o CorsOptions) allowsAnyOrigin() bool {
+	return slices.Contains(o.AllowedOrigins, "*")
+}
+
+// allowsOrigin reports whether the provided origin may call the API. Origins are
+// compared case insensitively as their scheme and host are.
+func (o CorsOptions) allowsOrigin(origin string) bool {
+	if o.allowsAnyOrigin() {
+		return true
+	}
+
+	return slices.ContainsFunc(o.AllowedOrigins, func(allowed string) bool {
+		return strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin)
+	})
+}
+
+// allowsMethod reports whether the provided method may be used by a cross-origin request.
+func (o CorsOptions) allowsMethod(method string) bool {
+	return slices.ContainsFunc(o.AllowedMethods, func(allowed string) bool {
+		return strings.EqualFold(allowed, method)
+	})
+}
@@ -0,0 +1,28 @@
+package server
+
+import "time"
+
+// defaultMetricsStaleAfter is how long a pipeline may go without reporting before it is
+// counted as not reported, a week covering pipelines which only run on weekdays.
+const defaultMetricsStaleAfter = 7 * 24 * time.Hour
+
+// MetricsOptions defines the Prometheus metrics served on /metrics.
+//
+// The endpoint follows the API visibility: it requires authentication when the API is
+// private, as the fleet metrics expose the name and the state of every pipeline.
+type MetricsOptions struct {
+	// Disabled removes the /metrics endpoint.
+	// Default to false
+	Disabled bool
+	// StaleAfter is how long a pipeline may go without reporting before it is counted
+	// by udash_pipelines_not_reported.
+	// Default to 168h
+	StaleAfter time.Duration
+}
+
+// Init sets the defaults of the unset options.
+func (o *MetricsOptions) Init() {
+	if o.StaleAfter <= 0 {
+		o.StaleAfter = defaultMetricsStaleAfter
+	}
+}
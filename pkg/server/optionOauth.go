@@ -53,11 +53,29 @@ type ZitadelOptions struct {
 	Role string
 }
 
+// OauthOptions defines Oauth specific options
+// for authentication
 type OauthOptions struct {
 	// The issuer of our token.
 	Issuer string
 	// The audience of our token.
 	Audience []string
+	// Algorithm is the signature algorithm tokens must be signed with.
+	// Accepted values are: "RS256", "ES256", "HS256"
+	// Default to "HS256" when a shared secret is configured, "RS256" otherwise
+	Algorithm string
+	// JWKSFile is the path to a local JSON Web Key Set holding the signing keys
+	// of the issuer, used instead of fetching them from the issuer.
+	// The file is reloaded when it changes.
+	// example: /etc/udash/jwks.json
+	JWKSFile string
+	// PublicKeyFile is the path to a PEM encoded public key, or certificate,
+	// used instead of fetching the signing keys from the issuer.
+	// The file is reloaded when it changes.
+	// example: /etc/udash/issuer.pem
+	PublicKeyFile string
+	// SharedSecret is the secret tokens signed with HS256 are verified with.
+	SharedSecret string
 }
 
 func (a *AuthOptions) Init() {
@@ -98,6 +116,22 @@ func (a *AuthOptions) Init() {
 		if len(a.Oauth.Audience) == 0 {
 			a.Oauth.Audience = []string{os.Getenv("UDASH_AUTH_OAUTH_AUDIENCE")}
 		}
+
+		if a.Oauth.Algorithm == "" {
+			a.Oauth.Algorithm = os.Getenv("UDASH_AUTH_OAUTH_ALGORITHM")
+		}
+
+		if a.Oauth.JWKSFile == "" {
+			a.Oauth.JWKSFile = os.Getenv("UDASH_AUTH_OAUTH_JWKS_FILE")
+		}
+
+		if a.Oauth.PublicKeyFile == "" {
+			a.Oauth.PublicKeyFile = os.Getenv("UDASH_AUTH_OAUTH_PUBLIC_KEY_FILE")
+		}
+
+		if a.Oauth.SharedSecret == "" {
+			a.Oauth.SharedSecret = os.Getenv("UDASH_AUTH_OAUTH_SHARED_SECRET")
+		}
 	case ModeNone, "":
 		//
 	default:
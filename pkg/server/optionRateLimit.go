@@ -0,0 +1,42 @@
+package server
+
+// RateLimitOptions defines the rate limits applied to the /api/pipeline routes.
+//
+// Every client gets its own budget per kind of request: the authenticated principal when
+// there is one, the client IP otherwise. A limit left to zero does not limit anything.
+type RateLimitOptions struct {
+	// Read limits the requests reading a single resource or listing them
+	Read RateLimitRule
+	// Search limits the search and summary requests, which are the most expensive ones
+	Search RateLimitRule
+	// Publish limits the requests changing the stored data, such as publishing a report
+	Publish RateLimitRule
+}
+
+// RateLimitRule defines a token bucket.
+type RateLimitRule struct {
+	// RequestsPerMinute is the rate the bucket refills at.
+	// Default to 0, which disables the limit
+	RequestsPerMinute float64
+	// Burst is the number of requests a client may send at once.
+	// Default to the number of requests allowed per minute, and at least 1
+	Burst int
+}
+
+// Enabled reports whether the rule limits anything.
+func (r RateLimitRule) Enabled() bool {
+	return r.RequestsPerMinute > 0
+}
+
+// burst returns the configured burst, or a default derived from the rate.
+func (r RateLimitRule) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+
+	if r.RequestsPerMinute < 1 {
+		return 1
+	}
+
+	return int(r.RequestsPerMinute)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/updatecli/udash/pkg/database"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimitIdleTimeout is how long the bucket of a client which stopped sending
+	// requests is kept around. By then it is full again, so dropping it is lossless.
+	rateLimitIdleTimeout = 10 * time.Minute
+	// rateLimitSweepInterval is how often idle buckets are looked for.
+	rateLimitSweepInterval = time.Minute
+)
+
+// rateLimitClient is the bucket of a single client.
+type rateLimitClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter holds one token bucket per client for a single RateLimitRule.
+type rateLimiter struct {
+	rule RateLimitRule
+
+	mu        sync.Mutex
+	clients   map[string]*rateLimitClient
+	lastSweep time.Time
+}
+
+func newRateLimiter(rule RateLimitRule) *rateLimiter {
+	return &rateLimiter{
+		rule:    rule,
+		clients: map[string]*rateLimitClient{},
+	}
+}
+
+// reserve takes a token out of the bucket of the provided client. It returns zero when the
+// request may proceed, or how long the client has to wait before a token is available.
+func (l *rateLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &rateLimitClient{
+			limiter: rate.NewLimiter(rate.Limit(l.rule.RequestsPerMinute/60), l.rule.burst()),
+		}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+
+	reservation := client.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return rateLimitIdleTimeout
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		// The request is rejected rather than delayed, so the token it reserved must be
+		// handed back. Otherwise a client retrying too early would push its own
+		// Retry-After further away with every attempt.
+		reservation.CancelAt(now)
+	}
+
+	return delay
+}
+
+// sweep drops the buckets of the clients which have been idle for a while, so that the
+// memory used does not grow with every address which ever sent a request.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, client := range l.clients {
+		if now.Sub(client.lastSeen) > rateLimitIdleTimeout {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// rateLimit returns a middleware enforcing the provided rule, per client.
+//
+// Clients are told when to retry through the Retry-After header, in whole seconds rounded
+// up: rounding down would send them back a bit too early, into another rejection.
+func rateLimit(rule RateLimitRule) gin.HandlerFunc {
+	if !rule.Enabled() {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	limiter := newRateLimiter(rule)
+
+	return func(c *gin.Context) {
+		delay := limiter.reserve(rateLimitKey(c), time.Now())
+		if delay <= 0 {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, DefaultResponseModel{
+			Err: ErrTooManyRequests,
+		})
+	}
+}
+
+// rateLimitKey identifies the client a request is accounted to: the authenticated principal
+// when the request carries one, the client IP otherwise.
+//
+// The two are kept apart by a prefix so that a principal named like an address does not
+// share its budget.
+func rateLimitKey(c *gin.Context) string {
+	if principal := c.GetString(principalContextKey); principal != "" {
+		return "principal:" + principal
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+// limitRequestBody returns a middleware rejecting the request bodies larger than maxBytes.
+// A value lower than one does not limit anything.
+//
+// A request announcing a larger body is rejected straight away. The body is limited as
+// well, as the announced length may be missing or wrong, and the handler reading it is
+// expected to report a *http.MaxBytesError with isRequestBodyTooLarge.
+func limitRequestBody(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes < 1 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, DefaultResponseModel{
+				Err: ErrRequestBodyTooLarge,
+			})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// isRequestBodyTooLarge reports whether err was caused by a body exceeding the limit set by
+// limitRequestBody.
+func isRequestBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// queryTimeout returns a middleware bounding the time the queries of a request may take
+// altogether, as configured by the database options. The handlers pass their gin context to
+// pkg/database, which falls back to the context of the request and so carries the deadline.
+func queryTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := database.WithQueryTimeout(c.Request.Context())
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	t.Run("burst then rate", func(t *testing.T) {
+		l := newRateLimiter(RateLimitRule{RequestsPerMinute: 60, Burst: 2})
+
+		assert.Zero(t, l.reserve("a", now))
+		assert.Zero(t, l.reserve("a", now))
+		assert.Equal(t, time.Second, l.reserve("a", now))
+
+		// A rejected request hands its token back, retrying too early must not push the
+		// next available token further away.
+		assert.Equal(t, time.Second, l.reserve("a", now))
+
+		assert.Zero(t, l.reserve("a", now.Add(time.Second)))
+	})
+
+	t.Run("clients have their own bucket", func(t *testing.T) {
+		l := newRateLimiter(RateLimitRule{RequestsPerMinute: 1, Burst: 1})
+
+		assert.Zero(t, l.reserve("a", now))
+		assert.Positive(t, l.reserve("a", now))
+		assert.Zero(t, l.reserve("b", now))
+	})
+
+	t.Run("idle clients are dropped", func(t *testing.T) {
+		l := newRateLimiter(RateLimitRule{RequestsPerMinute: 1, Burst: 1})
+
+		l.reserve("a", now)
+		l.reserve("b", now.Add(rateLimitIdleTimeout+time.Minute))
+
+		assert.NotContains(t, l.clients, "a")
+		assert.Contains(t, l.clients, "b")
+	})
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/reports",
+		rateLimit(RateLimitRule{RequestsPerMinute: 1, Burst: 1}),
+		limitRequestBody(16),
+		func(c *gin.Context) {
+			if _, err := c.GetRawData(); err != nil {
+				if isRequestBodyTooLarge(err) {
+					c.Status(http.StatusRequestEntityTooLarge)
+					return
+				}
+				c.Status(http.StatusBadRequest)
+				return
+			}
+			c.Status(http.StatusCreated)
+		},
+	)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(body))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("{}")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = post("{}")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	t.Run("body size", func(t *testing.T) {
+		r := gin.New()
+		r.POST("/reports", limitRequestBody(16), func(c *gin.Context) {
+			_, err := c.GetRawData()
+			assert.True(t, isRequestBodyTooLarge(err))
+			c.Status(http.StatusRequestEntityTooLarge)
+		})
+
+		// Without a content length the limit is only noticed while reading the body.
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(strings.Repeat("a", 32)))
+		req.ContentLength = -1
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		// With one the request is rejected before the handler runs.
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(strings.Repeat("a", 32))))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// get sends a request from the address httptest uses, 192.0.2.1, claiming to be
+	// forwarded for the provided address.
+	get := func(r *gin.Engine, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	newEngine := func(opts Options) *gin.Engine {
+		r := newGinEngine(opts)
+		r.GET("/limited", rateLimit(RateLimitRule{RequestsPerMinute: 1, Burst: 1}), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		return r
+	}
+
+	t.Run("a spoofed X-Forwarded-For shares the bucket of the caller", func(t *testing.T) {
+		r := newEngine(Options{})
+
+		require.Equal(t, http.StatusNoContent, get(r, "198.51.100.1"))
+		assert.Equal(t, http.StatusTooManyRequests, get(r, "198.51.100.2"))
+	})
+
+	t.Run("a trusted proxy forwards the client IP", func(t *testing.T) {
+		r := newEngine(Options{TrustedProxies: []string{"192.0.2.0/24"}})
+
+		require.Equal(t, http.StatusNoContent, get(r, "198.51.100.1"))
+		assert.Equal(t, http.StatusNoContent, get(r, "198.51.100.2"))
+		assert.Equal(t, http.StatusTooManyRequests, get(r, "198.51.100.1"))
+	})
+}
+
+func TestQueryTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/", queryTimeout(), func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		// No timeout is configured outside of a running server.
+		assert.False(t, ok)
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
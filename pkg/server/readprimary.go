@@ -0,0 +1,25 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+// readPrimaryHeader lets a client read from the primary database although a read replica is
+// configured, typically to list the report it has just published: the replica may not have
+// replayed it yet.
+const readPrimaryHeader = "X-Udash-Read-Primary"
+
+// readPrimary returns a middleware routing the searches of the requests setting
+// readPrimaryHeader to a true value to the primary database.
+func readPrimary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if primary, err := strconv.ParseBool(c.GetHeader(readPrimaryHeader)); err == nil && primary {
+			c.Request = c.Request.WithContext(database.WithPrimary(c.Request.Context()))
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+func TestReadPrimary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/", readPrimary(), func(c *gin.Context) {
+		c.String(http.StatusOK, "%t", database.IsPrimary(c.Request.Context()))
+	})
+
+	for header, expected := range map[string]string{
+		"":      "false",
+		"true":  "true",
+		"1":     "true",
+		"false": "false",
+		"maybe": "false",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set(readPrimaryHeader, header)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, expected, w.Body.String(), "header %q", header)
+	}
+}
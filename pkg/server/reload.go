@@ -0,0 +1,243 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// reloadableHandler is a middleware which can be replaced while the server runs. Requests
+// already past it keep the middleware they started with.
+type reloadableHandler struct {
+	handler atomic.Pointer[gin.HandlerFunc]
+}
+
+func newReloadableHandler(h gin.HandlerFunc) *reloadableHandler {
+	r := &reloadableHandler{}
+	r.store(h)
+	return r
+}
+
+func (r *reloadableHandler) store(h gin.HandlerFunc) {
+	r.handler.Store(&h)
+}
+
+func (r *reloadableHandler) handle(c *gin.Context) {
+	(*r.handler.Load())(c)
+}
+
+// liveSettings holds the middlewares of the options which are applied without a restart.
+type liveSettings struct {
+	// auth is the authentication built at startup, nil when there is none. Changing the
+	// authentication mode requires a restart, only the visibility is applied live.
+	auth gin.HandlerFunc
+	// readOnlyRoutes are the POST routes which only read, left open by a public API.
+	readOnlyRoutes map[string]bool
+
+	options Options
+
+	authentication    *reloadableHandler
+	metricsAuth       *reloadableHandler
+	cors              *reloadableHandler
+	readLimit         *reloadableHandler
+	searchLimit       *reloadableHandler
+	publishLimit      *reloadableHandler
+	reportSizeLimiter *reloadableHandler
+}
+
+func newLiveSettings(opts Options, auth gin.HandlerFunc, readOnlyRoutes map[string]bool) *liveSettings {
+	l := &liveSettings{
+		auth:              auth,
+		readOnlyRoutes:    readOnlyRoutes,
+		options:           opts,
+		authentication:    newReloadableHandler(nil),
+		metricsAuth:       newReloadableHandler(nil),
+		cors:              newReloadableHandler(cors(opts.Cors)),
+		readLimit:         newReloadableHandler(rateLimit(opts.RateLimit.Read)),
+		searchLimit:       newReloadableHandler(rateLimit(opts.RateLimit.Search)),
+		publishLimit:      newReloadableHandler(rateLimit(opts.RateLimit.Publish)),
+		reportSizeLimiter: newReloadableHandler(limitRequestBody(opts.MaxReportSize)),
+	}
+	l.applyVisibility(opts.Auth.Visibility)
+
+	return l
+}
+
+// applyVisibility installs the authentication required by the provided visibility.
+func (l *liveSettings) applyVisibility(visibility string) {
+	pass := func(c *gin.Context) { c.Next() }
+
+	if l.auth == nil {
+		l.authentication.store(pass)
+		l.metricsAuth.store(pass)
+		return
+	}
+
+	switch visibility {
+	case VisibilityPrivate:
+		logrus.Debugf("API visibility set to private, authentication required for all endpoints")
+		l.authentication.store(l.auth)
+		// The fleet metrics expose every pipeline, they are as private as the API is.
+		l.metricsAuth.store(l.auth)
+	default:
+		logrus.Debugf("API visibility set to public, no authentication required for read endpoints")
+		l.authentication.store(publicReadOnly(l.auth, l.readOnlyRoutes))
+		l.metricsAuth.store(pass)
+	}
+}
+
+// apply switches the middlewares to the provided options. A rate limit is only rebuilt
+// when its rule changed, rebuilding it hands every client a full budget again.
+func (l *liveSettings) apply(opts Options) {
+	if opts.Auth.Visibility != l.options.Auth.Visibility {
+		l.applyVisibility(opts.Auth.Visibility)
+	}
+
+	if !reflect.DeepEqual(opts.Cors, l.options.Cors) {
+		l.cors.store(cors(opts.Cors))
+	}
+
+	if opts.RateLimit.Read != l.options.RateLimit.Read {
+		l.readLimit.store(rateLimit(opts.RateLimit.Read))
+	}
+
+	if opts.RateLimit.Search != l.options.RateLimit.Search {
+		l.searchLimit.store(rateLimit(opts.RateLimit.Search))
+	}
+
+	if opts.RateLimit.Publish != l.options.RateLimit.Publish {
+		l.publishLimit.store(rateLimit(opts.RateLimit.Publish))
+	}
+
+	if opts.MaxReportSize != l.options.MaxReportSize {
+		l.reportSizeLimiter.store(limitRequestBody(opts.MaxReportSize))
+	}
+
+	l.options = opts
+}
+
+// Validate reports the options which cannot be served, once Init has set the defaults.
+func (o Options) Validate() error {
+	errs := []error{}
+
+	switch strings.ToLower(o.Auth.Mode) {
+	case "", ModeNone, ModeOauth, ModeZitadel:
+	default:
+		errs = append(errs, fmt.Errorf("unknown authentication mode %q, accepted values are %q, %q and %q",
+			o.Auth.Mode, ModeNone, ModeOauth, ModeZitadel))
+	}
+
+	switch o.Auth.Visibility {
+	case VisibilityPublic, VisibilityPrivate:
+	default:
+		errs = append(errs, fmt.Errorf("unknown API visibility %q, accepted values are %q and %q",
+			o.Auth.Visibility, VisibilityPublic, VisibilityPrivate))
+	}
+
+	rules := map[string]RateLimitRule{
+		"read":    o.RateLimit.Read,
+		"search":  o.RateLimit.Search,
+		"publish": o.RateLimit.Publish,
+	}
+	for name, rule := range rules {
+		if rule.RequestsPerMinute < 0 || rule.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate limit %q cannot be negative", name))
+		}
+	}
+
+	for _, proxy := range o.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("trusted proxy %q is neither an IP address nor a CIDR range", proxy))
+		}
+	}
+
+	if o.MaxReportSize < 0 {
+		errs = append(errs, errors.New("maximum report size cannot be negative"))
+	}
+
+	for _, origin := range o.Cors.AllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			errs = append(errs, errors.New("CORS allowed origins cannot be empty"))
+			break
+		}
+	}
+
+	errs = append(errs, o.Badges.validate()...)
+
+	return errors.Join(errs...)
+}
+
+// restartRequired returns the options which differ between current and next and are only
+// read when the server starts.
+func restartRequired(current, next Options) []string {
+	changed := []string{}
+
+	fields := []struct {
+		name          string
+		current, next any
+	}{
+		{"server.listen", current.Listen, next.Listen},
+		{"server.tls", current.TLS, next.TLS},
+		{"server.readtimeout", current.ReadTimeout, next.ReadTimeout},
+		{"server.writetimeout", current.WriteTimeout, next.WriteTimeout},
+		{"server.idletimeout", current.IdleTimeout, next.IdleTimeout},
+		{"server.shutdowntimeout", current.ShutdownTimeout, next.ShutdownTimeout},
+		{"server.trustedproxies", current.TrustedProxies, next.TrustedProxies},
+		{"server.auth.mode", current.Auth.Mode, next.Auth.Mode},
+		{"server.auth.oauth", current.Auth.Oauth, next.Auth.Oauth},
+		{"server.auth.zitadel", current.Auth.Zitadel, next.Auth.Zitadel},
+		{"server.metrics", current.Metrics, next.Metrics},
+		{"server.badges", current.Badges, next.Badges},
+	}
+
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.current, f.next) {
+			changed = append(changed, f.name)
+		}
+	}
+
+	return changed
+}
+
+// Reload applies the options which can change while the server runs: the API visibility,
+// the rate limits, the maximum report size and the CORS policy. Invalid options are
+// rejected as a whole and the current ones kept.
+//
+// It returns the options which changed but only take effect on the next start.
+func (s *Server) Reload(o Options) ([]string, error) {
+	o.Init()
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The current options are only initialized once the server runs.
+	current := s.Options
+	current.Init()
+
+	changed := restartRequired(current, o)
+
+	// The options which require a restart keep their current value, so that s.Options
+	// keeps describing what is being served.
+	live := current
+	live.Auth.Visibility = o.Auth.Visibility
+	live.RateLimit = o.RateLimit
+	live.MaxReportSize = o.MaxReportSize
+	live.Cors = o.Cors
+
+	if s.live != nil {
+		s.live.apply(live)
+	}
+	s.Options = live
+
+	return changed, nil
+}
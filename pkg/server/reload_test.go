@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// fakeAuth stands for the authentication of a private API, any Authorization header
+	// is accepted.
+	fakeAuth := func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+
+	newEngine := func(opts Options) (*gin.Engine, *liveSettings) {
+		opts.Init()
+		live := newLiveSettings(opts, fakeAuth, map[string]bool{"/api/pipeline/reports/search": true})
+
+		r := gin.New()
+		r.Use(live.cors.handle)
+		api := r.Group("/api/pipeline")
+		api.Use(live.authentication.handle)
+
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		api.GET("/reports", live.readLimit.handle, ok)
+		api.POST("/reports/search", live.searchLimit.handle, ok)
+		api.POST("/reports", live.publishLimit.handle, ok)
+
+		return r, live
+	}
+
+	serve := func(r *gin.Engine, method, path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	t.Run("visibility", func(t *testing.T) {
+		r, live := newEngine(Options{})
+
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/api/pipeline/reports"))
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodPost, "/api/pipeline/reports/search"))
+		assert.Equal(t, http.StatusUnauthorized, serve(r, http.MethodPost, "/api/pipeline/reports"))
+
+		private := live.options
+		private.Auth.Visibility = VisibilityPrivate
+		live.apply(private)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(r, http.MethodGet, "/api/pipeline/reports"))
+		assert.Equal(t, http.StatusUnauthorized, serve(r, http.MethodPost, "/api/pipeline/reports/search"))
+	})
+
+	t.Run("rate limits", func(t *testing.T) {
+		r, live := newEngine(Options{})
+
+		limited := live.options
+		limited.RateLimit.Read = RateLimitRule{RequestsPerMinute: 1, Burst: 1}
+		live.apply(limited)
+
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/api/pipeline/reports"))
+		assert.Equal(t, http.StatusTooManyRequests, serve(r, http.MethodGet, "/api/pipeline/reports"))
+
+		// Applying the same rule again must not hand the clients a new budget.
+		live.apply(limited)
+		assert.Equal(t, http.StatusTooManyRequests, serve(r, http.MethodGet, "/api/pipeline/reports"))
+
+		live.apply(Options{Auth: limited.Auth})
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/api/pipeline/reports"))
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		s := Server{Options: Options{RateLimit: RateLimitOptions{Read: RateLimitRule{RequestsPerMinute: 10}}}}
+
+		_, err := s.Reload(Options{Auth: AuthOptions{Visibility: "secret"}})
+		require.Error(t, err)
+
+		_, err = s.Reload(Options{RateLimit: RateLimitOptions{Search: RateLimitRule{RequestsPerMinute: -1}}})
+		require.Error(t, err)
+
+		_, err = s.Reload(Options{TrustedProxies: []string{"proxy.example"}})
+		require.Error(t, err)
+
+		assert.Equal(t, float64(10), s.Options.RateLimit.Read.RequestsPerMinute)
+	})
+
+	t.Run("options read on startup require a restart", func(t *testing.T) {
+		s := Server{Options: Options{Listen: ":8080"}}
+
+		changed, err := s.Reload(Options{
+			Listen:    ":9090",
+			RateLimit: RateLimitOptions{Read: RateLimitRule{RequestsPerMinute: 10}},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"server.listen"}, changed)
+		// The listen address keeps describing what is served, the rate limit is applied.
+		assert.Equal(t, ":8080", s.Options.Listen)
+		assert.Equal(t, float64(10), s.Options.RateLimit.Read.RequestsPerMinute)
+	})
+}
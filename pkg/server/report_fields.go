@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/updatecli/udash/pkg/database"
+)
+
+// reportPayloadField is the field carrying the payload of a report, by far the largest one.
+const reportPayloadField = "Report"
+
+// reportFields are the fields a report search can be projected on, by their key in the
+// response, and how to read each of them.
+var reportFields = map[string]func(database.SearchLatestReportData) any{
+	"ID":                 func(r database.SearchLatestReportData) any { return r.ID },
+	"Name":               func(r database.SearchLatestReportData) any { return r.Name },
+	"Result":             func(r database.SearchLatestReportData) any { return r.Result },
+	reportPayloadField:   func(r database.SearchLatestReportData) any { return r.Report },
+	"FilteredResourceID": func(r database.SearchLatestReportData) any { return r.FilteredResourceID },
+	"CreatedAt":          func(r database.SearchLatestReportData) any { return r.CreatedAt },
+	"UpdatedAt":          func(r database.SearchLatestReportData) any { return r.UpdatedAt },
+	"TargetConfigIDs":    func(r database.SearchLatestReportData) any { return r.TargetConfigIDs },
+	"ConditionConfigIDs": func(r database.SearchLatestReportData) any { return r.ConditionConfigIDs },
+	"SourceConfigIDs":    func(r database.SearchLatestReportData) any { return r.SourceConfigIDs },
+	"Acknowledgement":    func(r database.SearchLatestReportData) any { return r.Acknowledgement },
+	"Stale":              func(r database.SearchLatestReportData) any { return r.Stale },
+}
+
+// reportProjection describes what a report search returns of every report.
+type reportProjection struct {
+	// fields are the fields returned, in the requested order, every one when empty.
+	fields []string
+	// excludePayload tells the payload is not read at all.
+	excludePayload bool
+}
+
+// newReportProjection resolves the fields and include_payload options of a report search.
+// A field list leaves the payload out unless it names the Report field, include_payload
+// set to true adds it, and set to false leaves it out of the full reports.
+func newReportProjection(fields []string, includePayload *bool) (reportProjection, error) {
+	p := reportProjection{}
+
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "", slices.Contains(p.fields, field):
+			continue
+		case reportFields[field] == nil:
+			return reportProjection{}, fmt.Errorf("%s: unknown field %q, accepted values are %s",
+				ErrInvalidFieldsParam, field, strings.Join(slices.Sorted(maps.Keys(reportFields)), ", "))
+		}
+		p.fields = append(p.fields, field)
+	}
+
+	if len(p.fields) == 0 {
+		p.excludePayload = includePayload != nil && !*includePayload
+		return p, nil
+	}
+
+	named := slices.Contains(p.fields, reportPayloadField)
+	switch {
+	case includePayload == nil:
+	case *includePayload && !named:
+		p.fields = append(p.fields, reportPayloadField)
+		named = true
+	case !*includePayload && named:
+		return reportProjection{}, fmt.Errorf("%s: field %q requested with include_payload set to false",
+			ErrInvalidFieldsParam, reportPayloadField)
+	}
+	p.excludePayload = !named
+
+	return p, nil
+}
+
+// projected reports whether the reports are returned as a subset of their fields.
+func (p reportProjection) projected() bool {
+	return len(p.fields) > 0
+}
+
+// project returns the requested fields of a report.
+func (p reportProjection) project(r database.SearchLatestReportData) map[string]any {
+	projected := make(map[string]any, len(p.fields))
+	for _, field := range p.fields {
+		projected[field] = reportFields[field](r)
+	}
+
+	return projected
+}
+
+// splitFieldsParam returns the fields listed by the fields query parameter, which is
+// either comma separated or repeated.
+func splitFieldsParam(values []string) []string {
+	fields := []string{}
+	for _, value := range values {
+		fields = append(fields, strings.Split(value, ",")...)
+	}
+
+	return fields
+}
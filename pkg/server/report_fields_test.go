@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/updatecli/udash/pkg/database"
+	"github.com/updatecli/updatecli/pkg/core/reports"
+)
+
+func TestNewReportProjection(t *testing.T) {
+	yes, no := true, false
+
+	for _, tt := range []struct {
+		name           string
+		fields         []string
+		includePayload *bool
+		expected       reportProjection
+		err            bool
+	}{
+		{name: "default", expected: reportProjection{}},
+		{name: "without payload", includePayload: &no, expected: reportProjection{excludePayload: true}},
+		{name: "with payload", includePayload: &yes, expected: reportProjection{}},
+		{
+			name:     "light fields",
+			fields:   []string{"Name", " Result", "", "Name"},
+			expected: reportProjection{fields: []string{"Name", "Result"}, excludePayload: true},
+		},
+		{
+			name:     "fields naming the payload",
+			fields:   []string{"ID", "Report"},
+			expected: reportProjection{fields: []string{"ID", "Report"}},
+		},
+		{
+			name:           "fields with payload",
+			fields:         []string{"ID"},
+			includePayload: &yes,
+			expected:       reportProjection{fields: []string{"ID", "Report"}},
+		},
+		{name: "fields naming the payload without payload", fields: []string{"Report"}, includePayload: &no, err: true},
+		{name: "unknown field", fields: []string{"Name", "name"}, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			projection, err := newReportProjection(tt.fields, tt.includePayload)
+			if tt.err {
+				require.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), ErrInvalidFieldsParam))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, projection)
+		})
+	}
+}
+
+func TestReportProjectionProject(t *testing.T) {
+	projection, err := newReportProjection([]string{"Result", "Name", "Stale"}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"Name": "deps", "Result": "✔", "Stale": true}, projection.project(database.SearchLatestReportData{
+		ID:     "5b4b3c51-8a1e-4c6b-9f7e-0c1f1b2a3d4e",
+		Name:   "deps",
+		Result: "✔",
+		Report: reports.Report{ID: "deps"},
+		Stale:  true,
+	}))
+}
+
+func TestSplitFieldsParam(t *testing.T) {
+	assert.Equal(t, []string{"ID", "Name", "Result"}, splitFieldsParam([]string{"ID,Name", "Result"}))
+	assert.Empty(t, splitFieldsParam(nil))
+}
+
+func TestReportSearchesRejectInvalidProjections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/reports", ListPipelineReports)
+	r.POST("/reports/search", SearchPipelineReports)
+
+	// None of them reaches the database, which is not connected.
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/reports?fields=Name,Payload", nil),
+		httptest.NewRequest(http.MethodGet, "/reports?include_payload=maybe", nil),
+		httptest.NewRequest(http.MethodPost, "/reports/search", strings.NewReader(`{"fields": ["Payload"]}`)),
+		httptest.NewRequest(http.MethodPost, "/reports/search", strings.NewReader(`{"fields": ["Report"], "include_payload": false}`)),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, req.URL.String())
+	}
+}
@@ -26,13 +26,22 @@ type CreatePipelineReportResponse struct {
 // @Produce json
 // @Success 201 {object} CreatePipelineReportResponse
 // @Failure 400 {object} DefaultResponseModel
+// @Failure 413 {object} DefaultResponseModel
+// @Failure 429 {object} DefaultResponseModel
 // @Failure 500 {object} DefaultResponseModel
 // @Router /api/pipeline/reports [post]
 func CreatePipelineReport(c *gin.Context) {
 	var p reports.Report
 
-	if err := c.BindJSON(&p); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+	if err := c.ShouldBindJSON(&p); err != nil {
+		if isRequestBodyTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, DefaultResponseModel{
+				Err: ErrRequestBodyTooLarge,
+			})
+			return
+		}
+
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -41,7 +50,7 @@ func CreatePipelineReport(c *gin.Context) {
 
 	newReportID, err := database.InsertReport(c, p)
 	if err != nil {
-		logrus.Errorf("insert reports: %s", err)
+		logrus.WithContext(c).Errorf("insert reports: %s", err)
 		c.JSON(
 			http.StatusInternalServerError,
 			DefaultResponseModel{
@@ -68,7 +77,7 @@ func DeletePipelineReport(c *gin.Context) {
 	id := c.Param("id")
 
 	if err := database.DeleteReport(c, id); err != nil {
-		logrus.Errorf("query failed: %s", err)
+		logrus.WithContext(c).Errorf("query failed: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -85,71 +94,141 @@ type GetPipelineReportsResponse struct {
 	TotalCount int                               `json:"total_count"`
 }
 
+// GetPipelineReportsProjectionResponse is the response of a report search projected on
+// some fields, every report only carries the requested ones.
+type GetPipelineReportsProjectionResponse struct {
+	Data       []map[string]any `json:"data"`
+	TotalCount int              `json:"total_count"`
+}
+
+// SearchPipelineReportsRequest represents the filters used to search pipeline reports.
+type SearchPipelineReportsRequest struct {
+	// ScmID is the ID of the SCM to filter reports by
+	// This is optional and can be used to filter reports by a specific SCM
+	ScmID string `json:"scmid"`
+	// SourceID is the ID of the source to filter reports by
+	// This is optional and can be used to filter reports by a specific source
+	SourceID string `json:"sourceid"`
+	// ConditionID is the ID of the condition to filter reports by
+	// This is optional and can be used to filter reports by a specific condition
+	ConditionID string `json:"conditionid"`
+	// TargetID is the ID of the target to filter reports by
+	// This is optional and can be used to filter reports by a specific target
+	TargetID string `json:"targetid"`
+	// Limit is the maximum number of reports to return
+	// This is optional and can be used to limit the number of reports returned
+	Limit int `json:"limit"`
+	// Page is the page number for pagination
+	// This is optional and can be used to paginate the results
+	Page int `json:"page"`
+	// StartTime is the start time for the time range filter
+	// This is optional and can be used to filter reports by a specific start time
+	// Time format is RFC3339: 2006-01-02T15:04:05Z07:00
+	StartTime string `json:"start_time"`
+	// EndTime is the end time for the time range filter
+	// This is optional and can be used to filter reports by a specific end time
+	// Time format is RFC3339: 2006-01-02T15:04:05Z07:00
+	EndTime string `json:"end_time"`
+	// Latest indicates whether to return only the latest report per pipeline ID
+	// This is optional and defaults to false
+	Latest bool `json:"latest"`
+	// Labels is a map of labels to filter reports by
+	Labels map[string]string `json:"labels,omitempty"`
+	// Results is a list of pipeline results to filter reports by, such as
+	// "✔", "✗", "⚠" or "-". A report matches when its result is any of them.
+	// This is optional and an empty list does not filter anything out.
+	Results []string `json:"results,omitempty"`
+	// OpenAction filters reports by whether they carry an action left open, such as a
+	// pull request still waiting to be merged. This is optional: unset does not filter
+	// anything out, true only keeps the reports with an open action and false only the
+	// ones without.
+	//
+	// Combined with results it isolates the pipelines which succeeded because their
+	// change is already waiting in a pull request, which a result alone cannot express:
+	// {"results": ["✔"], "open_action": true}.
+	OpenAction *bool `json:"open_action,omitempty"`
+	// Stale filters reports by whether their pipeline has not reported for longer than
+	// its reporting interval. This is optional: unset does not filter anything out, true
+	// only keeps the reports of the stale pipelines and false only the other ones.
+	Stale *bool `json:"stale,omitempty"`
+	// Fields is the list of fields to return of every report, by their key in the response,
+	// such as ["ID", "Name", "Result"]. This is optional and every field is returned when
+	// empty. The payload of the reports is neither read nor returned unless it lists
+	// "Report".
+	Fields []string `json:"fields,omitempty"`
+	// IncludePayload tells whether the payload of the reports is read and returned under
+	// the "Report" key. This is optional: unset returns it unless fields leaves it out.
+	IncludePayload *bool `json:"include_payload,omitempty"`
+}
+
+// projection returns what the request asks to return of every report.
+func (r SearchPipelineReportsRequest) projection() (reportProjection, error) {
+	return newReportProjection(r.Fields, r.IncludePayload)
+}
+
+// params returns the database search parameters of the request.
+func (r SearchPipelineReportsRequest) params(c *gin.Context) database.SearchLatestReportsParams {
+	return database.SearchLatestReportsParams{
+		Ctx:         c,
+		ScmID:       r.ScmID,
+		SourceID:    r.SourceID,
+		ConditionID: r.ConditionID,
+		TargetID:    r.TargetID,
+		Options:     database.ReportSearchOptions{Days: monitoringDurationDays},
+		StartTime:   r.StartTime,
+		EndTime:     r.EndTime,
+		Limit:       r.Limit,
+		Page:        r.Page,
+		Latest:      r.Latest,
+		Labels:      r.Labels,
+		Results:     r.Results,
+		OpenAction:  r.OpenAction,
+		Stale:       r.Stale,
+	}
+}
+
+// respondPipelineReports answers a report search, projected on the requested fields if any.
+func respondPipelineReports(c *gin.Context, projection reportProjection, dataset []database.SearchLatestReportData, totalCount int) {
+	if !projection.projected() {
+		c.JSON(http.StatusOK, GetPipelineReportsResponse{
+			Data:       dataset,
+			TotalCount: totalCount,
+		})
+		return
+	}
+
+	projected := make([]map[string]any, 0, len(dataset))
+	for _, report := range dataset {
+		projected = append(projected, projection.project(report))
+	}
+
+	c.JSON(http.StatusOK, GetPipelineReportsProjectionResponse{
+		Data:       projected,
+		TotalCount: totalCount,
+	})
+}
+
 // SearchPipelineReports returns all pipeline reports from the database using advanced filtering
 // @Summary Search pipeline reports
 // @Description Search pipeline reports in the database using advanced filtering
+// @Description The fields filter projects every report on the listed fields, and leaves their payload out
+// @Description unless it lists Report, so does include_payload set to false.
 // @Param limit query string false "Limit the number of reports returned, default is 100"
 // @Param page query string false "Page number for pagination, default is 1"
 // @Tags Pipeline Reports
 // @Accept json
 // @Produce json
 // @Success 200 {object} GetPipelineReportsResponse
+// @Success 200 {object} GetPipelineReportsProjectionResponse
 // @Failure 400 {object} DefaultResponseModel
 // @Failure 500 {object} DefaultResponseModel
 // @Router /api/pipeline/reports/search [post]
 func SearchPipelineReports(c *gin.Context) {
 
-	type queryData struct {
-		// ScmID is the ID of the SCM to filter reports by
-		// This is optional and can be used to filter reports by a specific SCM
-		ScmID string `json:"scmid"`
-		// SourceID is the ID of the source to filter reports by
-		// This is optional and can be used to filter reports by a specific source
-		SourceID string `json:"sourceid"`
-		// ConditionID is the ID of the condition to filter reports by
-		// This is optional and can be used to filter reports by a specific condition
-		ConditionID string `json:"conditionid"`
-		// TargetID is the ID of the target to filter reports by
-		// This is optional and can be used to filter reports by a specific target
-		TargetID string `json:"targetid"`
-		// Limit is the maximum number of reports to return
-		// This is optional and can be used to limit the number of reports returned
-		Limit int `json:"limit"`
-		// Page is the page number for pagination
-		// This is optional and can be used to paginate the results
-		Page int `json:"page"`
-		// StartTime is the start time for the time range filter
-		// This is optional and can be used to filter reports by a specific start time
-		// Time format is RFC3339: 2006-01-02T15:04:05Z07:00
-		StartTime string `json:"start_time"`
-		// EndTime is the end time for the time range filter
-		// This is optional and can be used to filter reports by a specific end time
-		// Time format is RFC3339: 2006-01-02T15:04:05Z07:00
-		EndTime string `json:"end_time"`
-		// Latest indicates whether to return only the latest report per pipeline ID
-		// This is optional and defaults to false
-		Latest bool `json:"latest"`
-		// Labels is a map of labels to filter reports by
-		Labels map[string]string `json:"labels,omitempty"`
-		// Results is a list of pipeline results to filter reports by, such as
-		// "✔", "✗", "⚠" or "-". A report matches when its result is any of them.
-		// This is optional and an empty list does not filter anything out.
-		Results []string `json:"results,omitempty"`
-		// OpenAction filters reports by whether they carry an action left open, such as a
-		// pull request still waiting to be merged. This is optional: unset does not filter
-		// anything out, true only keeps the reports with an open action and false only the
-		// ones without.
-		//
-		// Combined with results it isolates the pipelines which succeeded because their
-		// change is already waiting in a pull request, which a result alone cannot express:
-		// {"results": ["✔"], "open_action": true}.
-		OpenAction *bool `json:"open_action,omitempty"`
-	}
-
-	queryParams := queryData{}
+	queryParams := SearchPipelineReportsRequest{}
 
 	if err := c.ShouldBindJSON(&queryParams); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -163,36 +242,27 @@ func SearchPipelineReports(c *gin.Context) {
 		return
 	}
 
-	dataset, totalCount, err := database.SearchLatestReports(
-		database.SearchLatestReportsParams{
-			Ctx:         c,
-			ScmID:       queryParams.ScmID,
-			SourceID:    queryParams.SourceID,
-			ConditionID: queryParams.ConditionID,
-			TargetID:    queryParams.TargetID,
-			Options:     database.ReportSearchOptions{Days: monitoringDurationDays},
-			StartTime:   queryParams.StartTime,
-			EndTime:     queryParams.EndTime,
-			Limit:       queryParams.Limit,
-			Page:        queryParams.Page,
-			Latest:      queryParams.Latest,
-			Labels:      queryParams.Labels,
-			Results:     queryParams.Results,
-			OpenAction:  queryParams.OpenAction,
-		},
-	)
+	projection, err := queryParams.projection()
 	if err != nil {
-		logrus.Errorf("searching for latest report: %s", err)
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
+	params := queryParams.params(c)
+	params.ExcludePayload = projection.excludePayload
+
+	dataset, totalCount, err := database.SearchLatestReports(params)
+	if err != nil {
+		logrus.WithContext(c).Errorf("searching for latest report: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, GetPipelineReportsResponse{
-		Data:       dataset,
-		TotalCount: totalCount,
-	})
+	respondPipelineReports(c, projection, dataset, totalCount)
 }
 
 // SearchPipelineReportsSummaryRequest represents the filters used to summarize
@@ -227,6 +297,9 @@ type SearchPipelineReportsSummaryRequest struct {
 	// The same breakdown is reported without filtering anything out under the open_actions
 	// key of every bucket.
 	OpenAction *bool `json:"open_action,omitempty"`
+	// ExcludeAcknowledged leaves out the reports of the pipelines acknowledged right now,
+	// whose failure is known and accepted.
+	ExcludeAcknowledged bool `json:"exclude_acknowledged,omitempty"`
 	// StartTime is the start time for the time range filter.
 	// Time format is: 2006-01-02 15:04:05Z07:00
 	StartTime string `json:"start_time,omitempty"`
@@ -267,7 +340,7 @@ func SearchPipelineReportsSummary(c *gin.Context) {
 	queryParams := SearchPipelineReportsSummaryRequest{}
 
 	if err := c.ShouldBindJSON(&queryParams); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -337,18 +410,19 @@ func SearchPipelineReportsSummary(c *gin.Context) {
 
 	dataset, totalCount, err := database.SearchReportsSummary(
 		database.ReportSummaryParams{
-			Ctx:         c,
-			Days:        days,
-			Hours:       hours,
-			Granularity: granularity,
-			MaxDays:     maxMonitoringDurationDays,
-			MaxBuckets:  maxSummaryBuckets,
-			ScmID:       queryParams.ScmID,
-			Labels:      queryParams.Labels,
-			Results:     queryParams.Results,
-			OpenAction:  queryParams.OpenAction,
-			StartTime:   queryParams.StartTime,
-			EndTime:     queryParams.EndTime,
+			Ctx:                 c,
+			Days:                days,
+			Hours:               hours,
+			Granularity:         granularity,
+			MaxDays:             maxMonitoringDurationDays,
+			MaxBuckets:          maxSummaryBuckets,
+			ScmID:               queryParams.ScmID,
+			Labels:              queryParams.Labels,
+			Results:             queryParams.Results,
+			OpenAction:          queryParams.OpenAction,
+			StartTime:           queryParams.StartTime,
+			EndTime:             queryParams.EndTime,
+			ExcludeAcknowledged: queryParams.ExcludeAcknowledged,
 		},
 	)
 	if err != nil {
@@ -370,7 +444,7 @@ func SearchPipelineReportsSummary(c *gin.Context) {
 			return
 		}
 
-		logrus.Errorf("summarizing reports: %s", err)
+		logrus.WithContext(c).Errorf("summarizing reports: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -395,9 +469,12 @@ func SearchPipelineReportsSummary(c *gin.Context) {
 // @Param start_time query string false "Start time for filtering reports (RFC3339 format)"
 // @Param end_time query string false "End time for filtering reports (RFC3339 format)"
 // @Param latest query string false "Only return the latest report per pipeline ID, default is true"
+// @Param fields query string false "Comma separated fields to return of every report, such as ID,Name,Result"
+// @Param include_payload query string false "Return the payload of the reports, default is true unless fields leaves it out"
 // @Accept json
 // @Produce json
 // @Success 200 {object} GetPipelineReportsResponse
+// @Success 200 {object} GetPipelineReportsProjectionResponse
 // @Failure 400 {object} DefaultResponseModel
 // @Failure 500 {object} DefaultResponseModel
 // @Router /api/pipeline/reports [get]
@@ -422,6 +499,27 @@ func ListPipelineReports(c *gin.Context) {
 		latest = parsedLatest
 	}
 
+	var includePayload *bool
+	if includePayloadStr := queryParams.Get("include_payload"); includePayloadStr != "" {
+		parsedIncludePayload, err := strconv.ParseBool(includePayloadStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: ErrInvalidIncludePayloadParam,
+			})
+			return
+		}
+
+		includePayload = &parsedIncludePayload
+	}
+
+	projection, err := newReportProjection(splitFieldsParam(queryParams["fields"]), includePayload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, DefaultResponseModel{
+			Err: err.Error(),
+		})
+		return
+	}
+
 	if err := validateTimeRangeParams(startTime, endTime); err != nil {
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
@@ -431,7 +529,7 @@ func ListPipelineReports(c *gin.Context) {
 
 	limit, page, err := getPaginationParamFromURLQuery(c)
 	if err != nil {
-		logrus.Errorf("getting pagination params: %s", err)
+		logrus.WithContext(c).Errorf("getting pagination params: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: ErrInvalidPaginationParams + ": " + err.Error(),
 		})
@@ -440,32 +538,30 @@ func ListPipelineReports(c *gin.Context) {
 
 	dataset, totalCount, err := database.SearchLatestReports(
 		database.SearchLatestReportsParams{
-			Ctx:         c,
-			ScmID:       scmID,
-			SourceID:    "",
-			ConditionID: "",
-			TargetID:    "",
-			Options:     database.ReportSearchOptions{Days: monitoringDurationDays},
-			StartTime:   startTime,
-			EndTime:     endTime,
-			Limit:       limit,
-			Page:        page,
-			Latest:      latest,
+			Ctx:            c,
+			ScmID:          scmID,
+			SourceID:       "",
+			ConditionID:    "",
+			TargetID:       "",
+			Options:        database.ReportSearchOptions{Days: monitoringDurationDays},
+			StartTime:      startTime,
+			EndTime:        endTime,
+			Limit:          limit,
+			Page:           page,
+			Latest:         latest,
+			ExcludePayload: projection.excludePayload,
 		},
 	)
 
 	if err != nil {
-		logrus.Errorf("searching for latest report: %s", err)
+		logrus.WithContext(c).Errorf("searching for latest report: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, GetPipelineReportsResponse{
-		Data:       dataset,
-		TotalCount: totalCount,
-	})
+	respondPipelineReports(c, projection, dataset, totalCount)
 }
 
 type GetPipelineReportByIDResponse struct {
@@ -473,6 +569,8 @@ type GetPipelineReportByIDResponse struct {
 	Data             model.PipelineReport `json:"data"`
 	NBReportsByID    int                  `json:"nbReportsByID"`
 	LatestReportByID model.PipelineReport `json:"latestReportByID"`
+	// Acknowledgement is the acknowledgement muting the pipeline of the report, if any.
+	Acknowledgement *database.Acknowledgement `json:"acknowledgement,omitempty"`
 }
 
 // GetPipelineReportByID returns the latest pipeline report for a specific ID
@@ -488,7 +586,7 @@ func GetPipelineReportByID(c *gin.Context) {
 	id := c.Param("id")
 	data, err := database.SearchReport(c, id)
 	if err != nil {
-		logrus.Errorf("parsing result: %s", err)
+		logrus.WithContext(c).Errorf("parsing result: %s", err)
 		statusCode := http.StatusInternalServerError
 		if errors.Is(err, pgx.ErrNoRows) {
 			statusCode = http.StatusNotFound
@@ -503,7 +601,7 @@ func GetPipelineReportByID(c *gin.Context) {
 
 	nbReportsByID, err := database.SearchNumberOfReportsByPipelineID(c, data.Pipeline.ID)
 	if err != nil {
-		logrus.Errorf("getting number of reports by name: %s", err)
+		logrus.WithContext(c).Errorf("getting number of reports by name: %s", err)
 		c.JSON(
 			http.StatusInternalServerError,
 			DefaultResponseModel{
@@ -514,7 +612,7 @@ func GetPipelineReportByID(c *gin.Context) {
 
 	latestReportByID, err := database.SearchLatestReportByPipelineID(c, data.Pipeline.ID)
 	if err != nil {
-		logrus.Errorf("getting latest report by name: %s", err)
+		logrus.WithContext(c).Errorf("getting latest report by name: %s", err)
 		if errors.Is(err, pgx.ErrNoRows) {
 			c.JSON(
 				http.StatusNotFound,
@@ -534,6 +632,18 @@ func GetPipelineReportByID(c *gin.Context) {
 		return
 	}
 
+	acknowledgement, err := database.FindAcknowledgement(c, data.Pipeline.ID, data.Pipeline.Labels)
+	if err != nil {
+		logrus.WithContext(c).Errorf("getting the acknowledgement of the pipeline: %s", err)
+		c.JSON(
+			http.StatusInternalServerError,
+			DefaultResponseModel{
+				Err: err.Error(),
+			},
+		)
+		return
+	}
+
 	c.JSON(
 		http.StatusOK,
 		GetPipelineReportByIDResponse{
@@ -541,6 +651,7 @@ func GetPipelineReportByID(c *gin.Context) {
 			Data:             *data,
 			NBReportsByID:    nbReportsByID,
 			LatestReportByID: *latestReportByID,
+			Acknowledgement:  acknowledgement,
 		})
 }
 
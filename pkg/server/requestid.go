@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/updatecli/udash/pkg/logging"
+)
+
+const (
+	// requestIDHeader carries the id of a request, from the client or a proxy in front of
+	// udash, and back in the response.
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds the size of an incoming request id, which ends up on every
+	// log line of the request.
+	maxRequestIDLength = 128
+)
+
+// requestID returns a middleware giving every request an id, attached to its context so
+// that every line logged while serving it carries it, and returned in the response.
+//
+// The id sent by the client is kept, so that a request can be followed from a proxy or a
+// frontend which already assigned it one. One is generated otherwise, or when the one sent
+// could be used to forge log lines.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !isValidRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(requestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// isValidRequestID reports whether id is made of printable ASCII characters only, without
+// spaces, and is not too long.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/updatecli/udash/pkg/logging"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, logging.Configure(logging.Options{}))
+
+	logs := logrustest.NewGlobal()
+	t.Cleanup(func() {
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+		require.NoError(t, logging.Configure(logging.Options{}))
+	})
+
+	r := newGinEngine(Options{})
+	// Handlers log through the gin context, as they do when calling pkg/database.
+	r.GET("/api/logged", func(c *gin.Context) {
+		logrus.WithContext(c).Errorf("query failed")
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(id string) *httptest.ResponseRecorder {
+		logs.Reset()
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/logged", nil)
+		if id != "" {
+			req.Header.Set(requestIDHeader, id)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// loggedRequestIDs returns the request id of every line logged.
+	loggedRequestIDs := func() []string {
+		ids := []string{}
+		for _, entry := range logs.AllEntries() {
+			id, _ := entry.Data["request_id"].(string)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	t.Run("incoming id is kept", func(t *testing.T) {
+		w := serve("front-1234")
+
+		assert.Equal(t, "front-1234", w.Header().Get(requestIDHeader))
+		// The line of the handler and the access log line.
+		assert.Equal(t, []string{"front-1234", "front-1234"}, loggedRequestIDs())
+	})
+
+	t.Run("id is generated when none is sent", func(t *testing.T) {
+		w := serve("")
+
+		id := w.Header().Get(requestIDHeader)
+		_, err := uuid.Parse(id)
+		require.NoError(t, err)
+		assert.Equal(t, []string{id, id}, loggedRequestIDs())
+	})
+
+	t.Run("id which could forge log lines is replaced", func(t *testing.T) {
+		for _, id := range []string{"abc\nlevel=error msg=forged", "with space", strings.Repeat("a", maxRequestIDLength+1)} {
+			w := serve(id)
+
+			assert.NotEqual(t, id, w.Header().Get(requestIDHeader))
+			_, err := uuid.Parse(w.Header().Get(requestIDHeader))
+			assert.NoError(t, err)
+		}
+	})
+}
@@ -38,6 +38,10 @@ type SearchSCMsRequest struct {
 	// filter anything out, true only keeps the pipelines with an open action and false only
 	// the ones without.
 	OpenAction *bool `json:"open_action,omitempty"`
+	// Stale filters SCM summaries by whether a pipeline has not reported for longer than
+	// its reporting interval. This is optional: unset does not filter anything out, true
+	// only keeps the stale pipelines and false only the other ones.
+	Stale *bool `json:"stale,omitempty"`
 	// URL is the SCM URL to filter by.
 	URL string `json:"url,omitempty"`
 	// Branch is the SCM branch to filter by.
@@ -65,7 +69,7 @@ func SearchSCMs(c *gin.Context) {
 	queryParams := SearchSCMsRequest{}
 
 	if err := c.ShouldBindJSON(&queryParams); err != nil {
-		logrus.Errorf("failed to read json body: %s", err)
+		logrus.WithContext(c).Errorf("failed to read json body: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -81,7 +85,7 @@ func SearchSCMs(c *gin.Context) {
 
 	rows, totalCount, err := getSCMRows(c, queryParams)
 	if err != nil {
-		logrus.Errorf("searching for scms: %s", err)
+		logrus.WithContext(c).Errorf("searching for scms: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -98,6 +102,7 @@ func SearchSCMs(c *gin.Context) {
 			Labels:     queryParams.Labels,
 			Results:    queryParams.Results,
 			OpenAction: queryParams.OpenAction,
+			Stale:      queryParams.Stale,
 		})
 		return
 	}
@@ -143,7 +148,7 @@ func ListSCMs(c *gin.Context) {
 
 	limit, page, err := getPaginationParamFromURLQuery(c)
 	if err != nil {
-		logrus.Errorf("getting pagination params: %s", err)
+		logrus.WithContext(c).Errorf("getting pagination params: %s", err)
 		c.JSON(http.StatusBadRequest, DefaultResponseModel{
 			Err: ErrInvalidPaginationParams + ": " + err.Error(),
 		})
@@ -171,7 +176,7 @@ func ListSCMs(c *gin.Context) {
 		Page:      page,
 	})
 	if err != nil {
-		logrus.Errorf("searching for scms: %s", err)
+		logrus.WithContext(c).Errorf("searching for scms: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
@@ -241,6 +246,10 @@ type findSCMSummaryParams struct {
 	// OpenAction restricts the summary to the pipelines which carry an open action, or to
 	// the ones which do not. A nil value does not filter anything out.
 	OpenAction *bool
+	// Stale restricts the summary to the pipelines which have not reported for longer than
+	// their reporting interval, or to the ones which have. A nil value does not filter
+	// anything out.
+	Stale *bool
 }
 
 // findSCMSummary returns a summary of all git repositories detected.
@@ -257,9 +266,10 @@ func findSCMSummary(c *gin.Context, params findSCMSummaryParams) {
 		Labels:                 params.Labels,
 		Results:                params.Results,
 		OpenAction:             params.OpenAction,
+		Stale:                  params.Stale,
 	})
 	if err != nil {
-		logrus.Errorf("getting scm summary failed: %s", err)
+		logrus.WithContext(c).Errorf("getting scm summary failed: %s", err)
 		c.JSON(http.StatusInternalServerError, DefaultResponseModel{
 			Err: err.Error(),
 		})
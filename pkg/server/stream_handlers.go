@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/updatecli/udash/pkg/database"
+)
+
+const (
+	// streamKeepAliveInterval is how often a comment is sent on an idle reports stream, so
+	// that the proxies in between do not close it.
+	streamKeepAliveInterval = 30 * time.Second
+	// lastEventIDHeader is the header an EventSource sends the id of the last event it
+	// received with when it reconnects.
+	lastEventIDHeader = "Last-Event-ID"
+)
+
+// StreamPipelineReports streams the reports as they are published.
+// @Summary Stream the published reports
+// @Description Stream the reports published on any replica as Server-Sent Events, one "report" event per report, whose
+// @Description id is the id of the report and whose data describes it without its payload. The query parameters
+// @Description filter the reports as the fields of the reports search do. A client reconnecting with the Last-Event-ID
+// @Description header, or the last_event_id parameter, first receives the reports it missed, up to 1000 of them.
+// @Tags Pipeline Reports
+// @Param scmid query string false "SCM ID, none for the reports targeting no scm"
+// @Param sourceid query string false "Source config ID"
+// @Param conditionid query string false "Condition config ID"
+// @Param targetid query string false "Target config ID"
+// @Param labels query object false "Labels, such as labels[team]=platform"
+// @Param results query []string false "Pipeline results, such as ✗" collectionFormat(multi)
+// @Param open_action query bool false "Whether the report carries an open action"
+// @Param last_event_id query string false "Id of the last report received, when the Last-Event-ID header cannot be set"
+// @Produce text/event-stream
+// @Success 200 {object} database.StreamedReport
+// @Failure 400 {object} DefaultResponseModel
+// @Failure 500 {object} DefaultResponseModel
+// @Router /api/pipeline/reports/stream [get]
+func StreamPipelineReports(c *gin.Context) {
+	filter := database.ReportStreamFilter{
+		ScmID:       c.Query("scmid"),
+		SourceID:    c.Query("sourceid"),
+		ConditionID: c.Query("conditionid"),
+		TargetID:    c.Query("targetid"),
+		Labels:      c.QueryMap("labels"),
+		Results:     c.QueryArray("results"),
+	}
+
+	if value := c.Query("open_action"); value != "" {
+		openAction, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: "invalid open_action parameter, a boolean is expected",
+			})
+			return
+		}
+		filter.OpenAction = &openAction
+	}
+
+	lastEventID := c.GetHeader(lastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	if lastEventID != "" {
+		if _, err := uuid.Parse(lastEventID); err != nil {
+			c.JSON(http.StatusBadRequest, DefaultResponseModel{
+				Err: "invalid last event id, a report id is expected",
+			})
+			return
+		}
+	}
+
+	// Subscribed before the missed reports are read, so that none is inserted in between.
+	// The ones read both ways are only sent once.
+	inserted, unsubscribe := database.SubscribeReports()
+	defer unsubscribe()
+
+	missed := []database.StreamedReport{}
+	if lastEventID != "" {
+		ctx, cancel := database.WithQueryTimeout(c)
+		var err error
+		missed, err = database.ReportsInsertedAfter(ctx, lastEventID, filter)
+		cancel()
+
+		if err != nil {
+			logrus.WithContext(c).Errorf("resuming the reports stream: %s", err)
+			c.JSON(http.StatusInternalServerError, DefaultResponseModel{
+				Err: err.Error(),
+			})
+			return
+		}
+	}
+
+	// The stream lasts as long as the client reads it, the write timeout of the server
+	// would cut it.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logrus.WithContext(c).Debugf("clearing the write deadline of the reports stream: %s", err)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Tells nginx not to buffer the stream.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	sent := make(map[string]bool, len(missed))
+	for _, report := range missed {
+		if err := writeReportEvent(c.Writer, report); err != nil {
+			return
+		}
+		sent[report.ID] = true
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case report, ok := <-inserted:
+			// The subscription ends when the client lags too far behind, or when the
+			// server stops. The client resumes from the last report it received once it
+			// reconnects.
+			if !ok {
+				return
+			}
+
+			if sent[report.ID] || !filter.Matches(report) {
+				continue
+			}
+
+			if err := writeReportEvent(c.Writer, report); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-keepAlive.C:
+			if _, err := io.WriteString(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeReportEvent writes a streamed report as a Server-Sent Event.
+func writeReportEvent(w io.Writer, report database.StreamedReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: report\ndata: %s\n\n", report.ID, data)
+	return err
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		assert.NoError(t, provider.Shutdown(context.Background()))
+	})
+
+	r := newGinEngine(Options{})
+
+	// The handlers hand their gin context to pkg/database, which only sees the span of
+	// the request through the fallback to the request context.
+	var handlerSpan trace.SpanContext
+	r.GET("/api/traced", func(c *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(c)
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/api/traced", "/healthz", "/metrics"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1, "only the API request is traced")
+	assert.Equal(t, "GET /api/traced", spans[0].Name())
+
+	require.True(t, handlerSpan.IsValid())
+	assert.Equal(t, spans[0].SpanContext().TraceID(), handlerSpan.TraceID())
+}
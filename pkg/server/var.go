@@ -21,6 +21,9 @@ var (
 	errMessageType = "error"
 	// successMessageType is used to indicate a successful operation in API responses.
 	successMessageType = "success"
+	// principalContextKey is the gin context key the authentication middlewares store the
+	// identifier of the authenticated caller under.
+	principalContextKey = "principal"
 )
 
 const (
@@ -32,6 +35,11 @@ const (
 	ErrInvalidKeyOnlyParam = "invalid keyonly parameter"
 	// ErrInvalidLatestParam is the error message returned when the latest parameter is invalid.
 	ErrInvalidLatestParam = "invalid latest parameter"
+	// ErrInvalidIncludePayloadParam is the error message returned when the include_payload parameter is invalid.
+	ErrInvalidIncludePayloadParam = "invalid include_payload parameter"
+	// ErrInvalidFieldsParam is the error message returned when the fields parameter names an unknown field,
+	// or contradicts the include_payload one.
+	ErrInvalidFieldsParam = "invalid fields parameter"
 	// ErrInvalidDaysParam is the error message returned when the days parameter is out of range.
 	ErrInvalidDaysParam = "invalid days parameter"
 	// ErrInvalidTimeRangeParams is the error message returned when only one of the time range boundaries is provided.
@@ -51,6 +59,10 @@ const (
 	// would produce more than maxSummaryBuckets entries.
 	ErrTooManyBuckets = "requested time range and granularity produce too many buckets"
 	ErrInvalidJWT     = "JWT is invalid"
+	// ErrTooManyRequests is the error message returned when a client exceeds its rate limit.
+	ErrTooManyRequests = "too many requests"
+	// ErrRequestBodyTooLarge is the error message returned when a request body exceeds the maximum accepted size.
+	ErrRequestBodyTooLarge = "request body too large"
 
 	// summaryMetricResult counts the pipeline reports per Updatecli result. It is the
 	// only metric supported by the reports summary so far.
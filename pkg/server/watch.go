@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// watchFiles calls onChange whenever one of the provided files may have changed.
+//
+// The directories are watched rather than the files themselves: secrets and config maps
+// mounted by Kubernetes are updated by swapping a symlink, and editors often write a new
+// file before renaming it over the old one. A watch on the file would stop firing after the
+// first of those updates. Any write in a watched directory is therefore reported, reading
+// an unchanged file again is cheap.
+//
+// The watch lasts until ctx is done, which closes the watcher and ends its goroutine.
+func watchFiles(ctx context.Context, paths []string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := []string{}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if slices.Contains(dirs, dir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer func() { _ = watcher.Close() }()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+
+				onChange()
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorf("watching %q: %s", paths, err)
+			}
+		}
+	}()
+
+	return nil
+}
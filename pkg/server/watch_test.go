@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched")
+	require.NoError(t, os.WriteFile(path, []byte("first"), 0o600))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	var changes atomic.Int32
+	require.NoError(t, watchFiles(ctx, []string{path}, func() { changes.Add(1) }))
+
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0o600))
+	require.Eventually(t, func() bool {
+		return changes.Load() > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Once ctx is done, the watcher is closed and the changes are no longer reported.
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	seen := changes.Load()
+
+	require.NoError(t, os.WriteFile(path, []byte("third"), 0o600))
+	assert.Never(t, func() bool {
+		return changes.Load() != seen
+	}, 500*time.Millisecond, 50*time.Millisecond)
+}
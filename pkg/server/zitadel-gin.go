@@ -33,6 +33,7 @@ func (i *Interceptor[T]) RequireAuthorization(options ...authorization.CheckOpti
 			return
 		}
 		c.Request = c.Request.WithContext(authorization.WithAuthContext(c.Request.Context(), authCtx))
+		c.Set(principalContextKey, authCtx.UserID())
 		c.Next()
 	}
 }
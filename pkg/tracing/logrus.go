@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logHook adds the ids of the current span to the log lines given a context, as in
+// logrus.WithContext(ctx), so that they can be found from the trace and the other way around.
+type logHook struct{}
+
+func (logHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (logHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	span := trace.SpanContextFromContext(entry.Context)
+	if !span.IsValid() {
+		return nil
+	}
+
+	entry.Data["trace_id"] = span.TraceID().String()
+	entry.Data["span_id"] = span.SpanID().String()
+
+	return nil
+}
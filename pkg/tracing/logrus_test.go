@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogHook(t *testing.T) {
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01},
+		SpanID:  trace.SpanID{0x02},
+	})
+
+	testdata := []struct {
+		name    string
+		ctx     context.Context
+		wantIDs bool
+	}{
+		{name: "no context"},
+		{name: "context without span", ctx: context.Background()},
+		{name: "context with span", ctx: trace.ContextWithSpanContext(context.Background(), span), wantIDs: true},
+	}
+
+	for _, tt := range testdata {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := logrus.NewEntry(logrus.New())
+			if tt.ctx != nil {
+				entry = entry.WithContext(tt.ctx)
+			}
+
+			require.NoError(t, logHook{}.Fire(entry))
+
+			if !tt.wantIDs {
+				assert.NotContains(t, entry.Data, "trace_id")
+				return
+			}
+
+			assert.Equal(t, span.TraceID().String(), entry.Data["trace_id"])
+			assert.Equal(t, span.SpanID().String(), entry.Data["span_id"])
+		})
+	}
+}
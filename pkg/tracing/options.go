@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ProtocolGRPC exports the spans over OTLP/gRPC
+	ProtocolGRPC string = "grpc"
+	// ProtocolHTTP exports the spans over OTLP/HTTP with protobuf payloads
+	ProtocolHTTP string = "http/protobuf"
+
+	// defaultServiceName is the service.name resource attribute of the spans.
+	defaultServiceName = "udash"
+)
+
+// Options defines how the spans are exported.
+type Options struct {
+	// Enabled turns the tracing on.
+	// Default to false
+	Enabled bool
+	// Endpoint is the OTLP collector spans are exported to, such as "otel-collector:4317".
+	// Default to the standard OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_EXPORTER_OTLP_ENDPOINT
+	// environment variables, then to localhost
+	Endpoint string
+	// Protocol is either "grpc" or "http/protobuf".
+	// Default to "http/protobuf"
+	Protocol string
+	// Insecure exports the spans without TLS
+	Insecure bool
+	// ServiceName is the service.name resource attribute of the spans.
+	// Default to "udash"
+	ServiceName string
+	// SampleRatio is the ratio of the traces started by udash which are sampled, from 0 to 1.
+	// The traces started by a caller follow the sampling decision of that caller.
+	// Default to 1
+	SampleRatio *float64
+}
+
+// Init sets the defaults of the unset options, and reads the environment variables.
+func (o *Options) Init() {
+	if !o.Enabled {
+		if enabled := os.Getenv("UDASH_TRACING_ENABLED"); enabled != "" {
+			o.Enabled = strings.EqualFold(enabled, "true")
+		}
+	}
+
+	if o.Endpoint == "" {
+		o.Endpoint = os.Getenv("UDASH_TRACING_ENDPOINT")
+	}
+
+	switch strings.ToLower(o.Protocol) {
+	case "":
+		o.Protocol = ProtocolHTTP
+	case ProtocolGRPC:
+		o.Protocol = ProtocolGRPC
+	case ProtocolHTTP, "http":
+		o.Protocol = ProtocolHTTP
+	default:
+		logrus.Errorf("unsupported tracing protocol %q, accepted values are %q and %q, defaulting to %q",
+			o.Protocol, ProtocolGRPC, ProtocolHTTP, ProtocolHTTP)
+		o.Protocol = ProtocolHTTP
+	}
+
+	if o.ServiceName == "" {
+		o.ServiceName = defaultServiceName
+	}
+
+	if o.SampleRatio == nil {
+		ratio := 1.0
+		o.SampleRatio = &ratio
+	}
+}
@@ -0,0 +1,105 @@
+// Package tracing exports the OpenTelemetry spans of udash over OTLP.
+//
+// The rest of udash only ever uses the global tracer provider through Tracer. Until Start
+// installs an exporting one, that provider is the no-op one, so instrumented code costs next
+// to nothing when the tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/updatecli/udash/pkg/version"
+)
+
+// instrumentationName identifies the spans created by udash itself.
+const instrumentationName = "github.com/updatecli/udash"
+
+// Tracer returns the tracer udash creates its spans with.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start installs the tracer provider exporting the spans, and returns the function flushing
+// the spans still buffered, which must be called before the process exits.
+// It does nothing when the tracing is disabled.
+func Start(ctx context.Context, o Options) (func(context.Context) error, error) {
+	o.Init()
+
+	if !o.Enabled {
+		logrus.Debugln("Tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("creating the %s span exporter: %w", o.Protocol, err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(o.ServiceName),
+			semconv.ServiceVersion(version.Version),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("describing the tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*o.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	logrus.AddHook(logHook{})
+
+	logrus.Infof("Exporting traces over OTLP %s", o.Protocol)
+
+	return provider.Shutdown, nil
+}
+
+// newExporter returns the OTLP exporter of the configured protocol. An empty endpoint is
+// left to the exporter, which then reads the standard OTEL_EXPORTER_OTLP_* variables.
+func newExporter(ctx context.Context, o Options) (*otlptrace.Exporter, error) {
+	switch o.Protocol {
+	case ProtocolGRPC:
+		opts := []otlptracegrpc.Option{}
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(o.Endpoint))
+		}
+		if o.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.New(ctx, opts...)
+	default:
+		opts := []otlptracehttp.Option{}
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(o.Endpoint))
+		}
+		if o.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	}
+}